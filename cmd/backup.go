@@ -0,0 +1,90 @@
+package cmd
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strings"
+
+	log "github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+)
+
+// backupPassphraseEnv is read for the backup passphrase when no passphrase file is given
+const backupPassphraseEnv = "CAKE_BACKUP_PASSPHRASE"
+
+var (
+	backupPassphraseFile string
+	restoreKubeconfig    string
+)
+
+var backupCmd = &cobra.Command{
+	Use:   "backup FILE",
+	Short: "Back up the management cluster's Cluster API objects to an encrypted file",
+	Long: `Backup exports the Cluster API, CAPV and kubeadm objects of the management cluster, with the
+kubeconfig, CA and other secrets of its clusters, the same objects clusterctl move moves. The file is
+encrypted with a key derived from the passphrase in --passphrase-file or $` + backupPassphraseEnv + `.`,
+	Args: cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		passphrase, err := backupPassphrase()
+		if err != nil {
+			log.Fatalf(err.Error())
+		}
+		cluster := newManagementCluster()
+
+		log.WithField("file", args[0]).Info("Backing up management cluster...")
+		err = cluster.Backup(args[0], passphrase)
+		if err != nil {
+			log.Fatalf(err.Error())
+		}
+		log.WithField("file", args[0]).Info("Backup complete.")
+	},
+}
+
+var restoreCmd = &cobra.Command{
+	Use:   "restore FILE",
+	Short: "Restore a management cluster backup into a new cluster",
+	Long: `Restore imports a backup into the cluster in --kubeconfig, installing the Cluster API providers
+first when they aren't installed, and makes it the management cluster in the config file. Clusters
+are restored paused and unpaused once every object is restored.`,
+	Args: cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		passphrase, err := backupPassphrase()
+		if err != nil {
+			log.Fatalf(err.Error())
+		}
+		cluster := newManagementCluster()
+
+		log.WithField("file", args[0]).Info("Restoring management cluster...")
+		err = cluster.Restore(args[0], passphrase, restoreKubeconfig)
+		if err != nil {
+			log.Fatalf(err.Error())
+		}
+		log.WithField("file", args[0]).Info("Restore complete.")
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(backupCmd, restoreCmd)
+
+	for _, c := range []*cobra.Command{backupCmd, restoreCmd} {
+		c.Flags().StringVar(&backupPassphraseFile, "passphrase-file", "", "file containing the backup passphrase (default is $"+backupPassphraseEnv+")")
+	}
+	restoreCmd.Flags().StringVar(&restoreKubeconfig, "kubeconfig", "", "kubeconfig of the cluster to restore into")
+	restoreCmd.MarkFlagRequired("kubeconfig")
+}
+
+// backupPassphrase reads the passphrase from the passphrase file or the environment
+func backupPassphrase() (string, error) {
+	if backupPassphraseFile != "" {
+		p, err := ioutil.ReadFile(backupPassphraseFile)
+		if err != nil {
+			return "", err
+		}
+		return strings.TrimRight(string(p), "\r\n"), nil
+	}
+	if p := os.Getenv(backupPassphraseEnv); p != "" {
+		return p, nil
+	}
+	return "", fmt.Errorf("a backup passphrase is required, use --passphrase-file or $%s", backupPassphraseEnv)
+}
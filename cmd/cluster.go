@@ -0,0 +1,149 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/netapp/cake/pkg/cluster-engine/provisioner"
+	"github.com/netapp/cake/pkg/cluster-engine/provisioner/capv"
+	log "github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+)
+
+var workloadCluster provisioner.WorkloadCluster
+
+var clusterCmd = &cobra.Command{
+	Use:   "cluster",
+	Short: "Manage workload clusters on the management cluster",
+	Long: `Manage workload clusters created by the management cluster. The management cluster
+is found from the ClusterName in the config file, new clusters use its vSphere settings.`,
+}
+
+var clusterCreateCmd = &cobra.Command{
+	Use:   "create NAME",
+	Short: "Create a workload cluster",
+	Long: `Create a workload cluster from the management cluster, its kubeconfig is
+written to ~/.cluster-engine/NAME/kubeconfig`,
+	Args: cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		workloadCluster.ClusterName = args[0]
+		for _, count := range []string{workloadCluster.ControlPlaneMachineCount, workloadCluster.WorkerMachineCount} {
+			if count == "" {
+				continue
+			}
+			if _, err := strconv.Atoi(count); err != nil {
+				log.Fatalf("invalid machine count %q", count)
+			}
+		}
+
+		cluster := newManagementCluster()
+
+		log.WithField("ClusterName", workloadCluster.ClusterName).Info("Creating workload cluster...")
+		err := cluster.CreateWorkloadCluster(workloadCluster)
+		if err != nil {
+			log.Fatalf(err.Error())
+		}
+		log.WithField("ClusterName", workloadCluster.ClusterName).Info("Workload cluster created.")
+	},
+}
+
+var clusterListCmd = &cobra.Command{
+	Use:   "list",
+	Short: "List the clusters on the management cluster",
+	Args:  cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		clusters, err := newManagementCluster().ListClusters()
+		if err != nil {
+			log.Fatalf(err.Error())
+		}
+
+		w := tabwriter.NewWriter(os.Stdout, 0, 8, 2, ' ', 0)
+		fmt.Fprintln(w, "NAME\tNAMESPACE\tPHASE\tCONTROL PLANE READY\tMANAGEMENT")
+		for _, c := range clusters {
+			fmt.Fprintf(w, "%s\t%s\t%s\t%t\t%t\n", c.ClusterName, c.Namespace, c.Phase, c.ControlPlaneReady, c.Management)
+		}
+		w.Flush()
+	},
+}
+
+var clusterGetCmd = &cobra.Command{
+	Use:   "get NAME",
+	Short: "Show a cluster on the management cluster",
+	Args:  cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		c, err := newManagementCluster().GetCluster(args[0])
+		if err != nil {
+			log.Fatalf(err.Error())
+		}
+
+		w := tabwriter.NewWriter(os.Stdout, 0, 8, 2, ' ', 0)
+		fmt.Fprintf(w, "Name:\t%s\n", c.ClusterName)
+		fmt.Fprintf(w, "Namespace:\t%s\n", c.Namespace)
+		fmt.Fprintf(w, "Phase:\t%s\n", c.Phase)
+		fmt.Fprintf(w, "Infrastructure Ready:\t%t\n", c.InfrastructureReady)
+		fmt.Fprintf(w, "Control Plane Ready:\t%t\n", c.ControlPlaneReady)
+		fmt.Fprintf(w, "Management:\t%t\n", c.Management)
+		fmt.Fprintf(w, "Kubeconfig:\t%s\n", c.Kubeconfig)
+		w.Flush()
+	},
+}
+
+var clusterDeleteCmd = &cobra.Command{
+	Use:   "delete NAME",
+	Short: "Delete a workload cluster",
+	Args:  cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		cluster := newManagementCluster()
+
+		log.WithField("ClusterName", args[0]).Info("Deleting workload cluster...")
+		err := cluster.DeleteWorkloadCluster(args[0])
+		if err != nil {
+			log.Fatalf(err.Error())
+		}
+		log.WithField("ClusterName", args[0]).Info("Workload cluster deleted.")
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(clusterCmd)
+	clusterCmd.AddCommand(clusterCreateCmd, clusterListCmd, clusterGetCmd, clusterDeleteCmd)
+
+	clusterCreateCmd.Flags().StringVar(&workloadCluster.KubernetesVersion, "kubernetes-version", "", "Kubernetes version of the cluster (default is KubernetesVersion from the config file)")
+	clusterCreateCmd.Flags().StringVar(&workloadCluster.ControlPlaneMachineCount, "control-plane-machine-count", "", "number of control plane machines (default is ControlPlaneMachineCount from the config file)")
+	clusterCreateCmd.Flags().StringVar(&workloadCluster.WorkerMachineCount, "worker-machine-count", "", "number of worker machines (default is WorkerMachineCount from the config file)")
+}
+
+// newManagementCluster returns the management cluster from the config file,
+// checking the commands it needs are installed and logging its events
+func newManagementCluster() provisioner.Cluster {
+	cluster := capv.NewMgmtCluster(capvConfig())
+	go logEvents(cluster.Events())
+	requireCommands(cluster)
+	return cluster
+}
+
+// requireCommands exits when the commands the cluster needs aren't installed, unless --install-tools installs them,
+// and warns about installed commands with incompatible versions
+func requireCommands(cluster provisioner.Cluster) {
+	missing := cluster.RequiredCommands()
+	if len(missing) > 0 && installTools {
+		var err error
+		missing, err = cluster.InstallCommands(missing)
+		if err != nil {
+			log.Fatalf("ERROR: unable to install the required commands, %v", err)
+		}
+	}
+	if len(missing) > 0 {
+		hint := ", install them or use --install-tools"
+		if installTools {
+			hint = ", they have to be installed"
+		}
+		log.Fatalf("ERROR: the following commands were not found in $PATH: [%v]%s\n", strings.Join(missing, ", "), hint)
+	}
+	for _, warning := range cluster.CommandWarnings() {
+		log.Warn(warning)
+	}
+}
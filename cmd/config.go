@@ -0,0 +1,51 @@
+package cmd
+
+import (
+	"fmt"
+	"io/ioutil"
+
+	"github.com/netapp/cake/pkg/cluster-engine/provisioner/capv"
+	log "github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+)
+
+var (
+	schemaAPIVersion string
+	schemaOutput     string
+)
+
+var configCmd = &cobra.Command{
+	Use:   "config",
+	Short: "Inspect the config file format",
+}
+
+var configSchemaCmd = &cobra.Command{
+	Use:   "schema",
+	Short: "Print the JSON Schema of the config file",
+	Long: `Schema prints the JSON Schema of a config file version, the current version by default, for editors
+and CI to validate config files and complete their settings. Property names in the schema are case sensitive,
+cake reads them case insensitively.`,
+	Args: cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		s, err := capv.ConfigSchema(schemaAPIVersion)
+		if err != nil {
+			log.Fatalf(err.Error())
+		}
+		if schemaOutput == "" {
+			fmt.Print(string(s))
+			return
+		}
+		err = ioutil.WriteFile(schemaOutput, s, 0644)
+		if err != nil {
+			log.Fatalf(err.Error())
+		}
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(configCmd)
+	configCmd.AddCommand(configSchemaCmd)
+
+	configSchemaCmd.Flags().StringVar(&schemaAPIVersion, "api-version", capv.ConfigV1alpha2, "config version of the schema")
+	configSchemaCmd.Flags().StringVarP(&schemaOutput, "output", "o", "", "file to write the schema to instead of stdout")
+}
@@ -6,7 +6,7 @@ import (
 	"io/ioutil"
 	"net/http"
 	"path/filepath"
-	"strings"
+	"sync"
 	"time"
 
 	"github.com/mitchellh/go-homedir"
@@ -20,12 +20,11 @@ import (
 var (
 	logLevel string
 	//cfgFile                         string
-	controlPlaneMachineCount        int
-	workerMachineCount              int
-	controlPlaneMachineCountDefault = 1
-	workerMachineCountDefault       = 2
-	logLevelDefault                 = "info"
-	appName                         = "cluster-engine"
+	logLevelDefault     = "info"
+	keepBootstrap       bool
+	bootstrapKubeconfig string
+	progressPort        int
+	appName             = "cluster-engine"
 )
 
 var capvDeployCmd = &cobra.Command{
@@ -33,30 +32,74 @@ var capvDeployCmd = &cobra.Command{
 	Short: "Launch Cluster API Provider-vSphere (CAPV) Management Cluster",
 	Long:  `Launch Cluster API Provider-vSphere (CAPV) Management Cluster`,
 	Run: func(cmd *cobra.Command, args []string) {
-		runCapvProvisioner(controlPlaneMachineCount, workerMachineCount)
+		runCapvProvisioner()
 	},
 }
 
 var responseBody *progress
 
 type progress struct {
-	Complete bool     `json:"complete"`
-	Messages []string `json:"messages"`
+	// mu guards the progress, the /progress handler reads it while the deployment updates it
+	mu       sync.Mutex
+	Complete bool              `json:"complete"`
+	Messages []string          `json:"messages"`
+	Outputs  map[string]string `json:"outputs,omitempty"`
+}
+
+func (p *progress) addMessage(message string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.Messages = append(p.Messages, message)
+}
+
+func (p *progress) addOutputs(outputs map[string]string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.Outputs == nil {
+		p.Outputs = map[string]string{}
+	}
+	for k, v := range outputs {
+		p.Outputs[k] = v
+	}
+}
+
+func (p *progress) setComplete() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.Complete = true
 }
 
 func init() {
 	rootCmd.AddCommand(capvDeployCmd)
+	capvDeployCmd.Flags().StringVar(&bootstrapKubeconfig, "bootstrap-kubeconfig", "", "kubeconfig of an existing cluster to use as the bootstrap cluster instead of kind")
+	capvDeployCmd.Flags().IntVar(&progressPort, "progress-port", 8081, "port the deployment progress is served on, 0 to not serve it")
+	capvDeployCmd.Flags().BoolVar(&keepBootstrap, "keep-bootstrap", false, "keep the kind bootstrap cluster after CAPv is moved to the permanent management cluster")
 	responseBody = new(progress)
 	responseBody.Messages = []string{}
 }
 
-func getResponseData() progress {
-	return *responseBody
+// getResponseData returns a copy of the progress to encode
+func getResponseData() *progress {
+	responseBody.mu.Lock()
+	defer responseBody.mu.Unlock()
+	data := &progress{
+		Complete: responseBody.Complete,
+		Messages: append([]string{}, responseBody.Messages...),
+	}
+	for k, v := range responseBody.Outputs {
+		if data.Outputs == nil {
+			data.Outputs = map[string]string{}
+		}
+		data.Outputs[k] = v
+	}
+	return data
 }
 
-func serveProgress(logfile string, kubeconfig string) {
+// serveProgress serves the deployment's progress, logs and kubeconfig on the port, the deployment goes on
+// without them when the port is taken
+func serveProgress(port int, logfile string, kubeconfig string) {
 	http.HandleFunc("/progress", func(w http.ResponseWriter, r *http.Request) {
-		json.NewEncoder(w).Encode(responseBody)
+		json.NewEncoder(w).Encode(getResponseData())
 	})
 	http.HandleFunc("/logs", func(w http.ResponseWriter, r *http.Request) {
 		logs, _ := ioutil.ReadFile(logfile)
@@ -69,63 +112,92 @@ func serveProgress(logfile string, kubeconfig string) {
 		}
 		fmt.Fprintf(w, string(kconfig))
 	})
-	log.Fatal(http.ListenAndServe(":8081", nil))
+	err := http.ListenAndServe(fmt.Sprintf(":%d", port), nil)
+	log.Warnf("not serving the deployment progress, %v", err)
 }
 
-func runCapvProvisioner(controlPlaneMachineCount, workerMachineCount int) {
-
-	clusterName := "capv-mgmt-cluster"
-
+// capvConfig decodes the config file into the CAPV provisioner config, a v1alpha1 config is
+// converted to the current version. The config is defaulted and validated.
+func capvConfig() capv.MgmtCluster {
 	C := capv.MgmtCluster{}
 
-	errJ := viper.UnmarshalExact(&C)
+	var errJ error
+	switch viper.GetString("apiVersion") {
+	case capv.ConfigV1alpha1:
+		data, err := ioutil.ReadFile(viper.ConfigFileUsed())
+		if err != nil {
+			log.Fatalf(err.Error())
+		}
+		C, errJ = capv.DecodeV1alpha1(data)
+	default:
+		errJ = viper.UnmarshalExact(&C)
+	}
 	if errJ != nil {
 		log.Fatalf("unable to decode into struct, %v", errJ.Error())
 	}
+	C.SetDefaults()
+	if err := C.Validate(); err != nil {
+		log.Fatalf(err.Error())
+	}
+	return C
+}
+
+// logEvents logs the progress events of a provisioner
+func logEvents(progress chan interface{}) {
+	for {
+		select {
+		case event := <-progress:
+			switch event.(capv.Event).EventType {
+			case "checkpoint":
+				// update rest api
+			case "output":
+				e := event.(capv.Event)
+				log.WithFields(log.Fields{
+					"eventType": e.EventType,
+					"event":     e.Event,
+				}).Info("event received")
+				responseBody.addOutputs(e.Outputs)
+			default:
+				e := event.(capv.Event)
+				log.WithFields(log.Fields{
+					"eventType": e.EventType,
+					"event":     e.Event,
+				}).Info("event received")
+			}
+		}
+	}
+}
+
+func runCapvProvisioner() {
+	C := capvConfig()
+	if keepBootstrap {
+		C.Bootstrap.Keep = true
+	}
+	if bootstrapKubeconfig != "" {
+		C.Bootstrap.Kubeconfig = bootstrapKubeconfig
+	}
 
 	home, errH := homedir.Dir()
 	if errH != nil {
 		log.Fatalf(errH.Error())
 	}
-	kubeconfigLocation := filepath.Join(home, capv.ConfigDir, clusterName, "kubeconfig")
-	go serveProgress(C.LogFile, kubeconfigLocation)
+	kubeconfigLocation := filepath.Join(home, capv.ConfigDir, C.ClusterName, "kubeconfig")
+	if progressPort != 0 {
+		go serveProgress(progressPort, C.LogFile, kubeconfigLocation)
+	}
 
 	start := time.Now()
 	log.Info("Welcome to CAPV Mission Control")
 
-	//cpmCount := strconv.Itoa(controlPlaneMachineCount)
-	//nmCount := strconv.Itoa(workerMachineCount)
-
 	log.WithFields(log.Fields{
-		"ClusterName":              clusterName,
-		"ControlPlaneMachineCount": controlPlaneMachineCount,
-		"workerMachineCount":       workerMachineCount,
+		"ClusterName":              C.ClusterName,
+		"ControlPlaneMachineCount": C.ControlPlaneMachineCount,
+		"WorkerMachineCount":       C.WorkerMachineCount,
 	}).Info("Let's launch a cluster")
 
 	cluster := capv.NewMgmtCluster(C)
-	exist := cluster.RequiredCommands()
-	if len(exist) > 0 {
-		log.Fatalf("ERROR: the following commands were not found in $PATH: [%v]\n", strings.Join(exist, ", "))
-	}
-	progress := cluster.Events()
-
-	go func() {
-		for {
-			select {
-			case event := <-progress:
-				switch event.(capv.Event).EventType {
-				case "checkpoint":
-					// update rest api
-				default:
-					e := event.(capv.Event)
-					log.WithFields(log.Fields{
-						"eventType": e.EventType,
-						"event":     e.Event,
-					}).Info("event received")
-				}
-			}
-		}
-	}()
+	go logEvents(cluster.Events())
+	requireCommands(cluster)
 
 	log.Info("Creating bootstrap cluster...")
 	err := cluster.CreateBootstrap()
@@ -133,19 +205,19 @@ func runCapvProvisioner(controlPlaneMachineCount, workerMachineCount int) {
 		log.Fatalf(err.Error())
 	}
 	log.Info("Bootstrap cluster created.")
-	responseBody.Messages = append(responseBody.Messages, "Bootstrap cluster created")
+	responseBody.addMessage("Bootstrap cluster created")
 
 	log.WithFields(log.Fields{
-		"ClusterName":              clusterName,
-		"ControlPlaneMachineCount": controlPlaneMachineCount,
-		"WorkerMachineCount":       workerMachineCount,
+		"ClusterName":              C.ClusterName,
+		"ControlPlaneMachineCount": C.ControlPlaneMachineCount,
+		"WorkerMachineCount":       C.WorkerMachineCount,
 	}).Info("Installing CAPv into Bootstrap cluster...")
 	err = cluster.InstallControlPlane()
 	if err != nil {
 		log.Fatalf(err.Error())
 	}
 	log.Info("CAPv installed successfully.")
-	responseBody.Messages = append(responseBody.Messages, "CAPv installed successfully")
+	responseBody.addMessage("CAPv installed successfully")
 
 	log.Info("Creating permanent management cluster...")
 	err = cluster.CreatePermanent()
@@ -153,7 +225,7 @@ func runCapvProvisioner(controlPlaneMachineCount, workerMachineCount int) {
 		log.Fatalf(err.Error())
 	}
 	log.Info("Permanent management cluster created.")
-	responseBody.Messages = append(responseBody.Messages, "Permanent management cluster created")
+	responseBody.addMessage("Permanent management cluster created")
 
 	log.Info("Moving CAPv to permanent management cluster...")
 	err = cluster.PivotControlPlane()
@@ -161,7 +233,7 @@ func runCapvProvisioner(controlPlaneMachineCount, workerMachineCount int) {
 		log.Fatalf(err.Error())
 	}
 	log.Info("Move to Permanent management cluster complete.")
-	responseBody.Messages = append(responseBody.Messages, "Move to Permanent management cluster complete")
+	responseBody.addMessage("Move to Permanent management cluster complete")
 
 	log.Info("Installing Addons...")
 	err = cluster.InstallAddons()
@@ -169,14 +241,14 @@ func runCapvProvisioner(controlPlaneMachineCount, workerMachineCount int) {
 		log.Fatalf(err.Error())
 	}
 	log.Info("Addon installation complete.")
-	responseBody.Messages = append(responseBody.Messages, "Addon installation complete")
+	responseBody.addMessage("Addon installation complete")
 
-	responseBody.Complete = true
+	responseBody.setComplete()
 	stop := time.Now()
 	log.WithFields(log.Fields{
-		"ClusterName":              clusterName,
-		"ControlPlaneMachineCount": controlPlaneMachineCount,
-		"WorkerMachineCount":       workerMachineCount,
+		"ClusterName":              C.ClusterName,
+		"ControlPlaneMachineCount": C.ControlPlaneMachineCount,
+		"WorkerMachineCount":       C.WorkerMachineCount,
 		"MissionDuration":          stop.Sub(start).Round(time.Second),
 	}).Info("Mission Complete")
 	time.Sleep(24 * time.Hour)
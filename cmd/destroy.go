@@ -16,36 +16,40 @@ limitations under the License.
 package cmd
 
 import (
-	"fmt"
-
+	"github.com/netapp/cake/pkg/cluster-engine/provisioner/capv"
+	log "github.com/sirupsen/logrus"
 	"github.com/spf13/cobra"
 )
 
+var clusterID string
+
 // destroyCmd represents the destroy command
 var destroyCmd = &cobra.Command{
 	Use:   "destroy",
-	Short: "A brief description of your command",
-	Long: `A longer description that spans multiple lines and likely contains examples
-and usage of using your command. For example:
-
-Cobra is a CLI library for Go that empowers applications.
-This application is a tool to generate the needed files
-to quickly create a Cobra application.`,
+	Short: "Destroy a cluster and everything it created in vSphere",
+	Long: `Destroy deletes every virtual machine, template, folder and resource pool tagged
+in vSphere as owned by the cluster, along with the cluster's local files.
+The cluster ID defaults to the ClusterName in the config file.`,
 	Run: func(cmd *cobra.Command, args []string) {
-		fmt.Println("destroy called")
+		C := capvConfig()
+		if clusterID != "" {
+			C.ClusterName = clusterID
+		}
+
+		cluster := capv.NewMgmtCluster(C)
+		go logEvents(cluster.Events())
+
+		log.WithField("ClusterID", C.ClusterName).Info("Destroying cluster...")
+		err := cluster.Destroy()
+		if err != nil {
+			log.Fatalf(err.Error())
+		}
+		log.WithField("ClusterID", C.ClusterName).Info("Cluster destroyed.")
 	},
 }
 
 func init() {
 	rootCmd.AddCommand(destroyCmd)
 
-	// Here you will define your flags and configuration settings.
-
-	// Cobra supports Persistent Flags which will work for this command
-	// and all subcommands, e.g.:
-	// destroyCmd.PersistentFlags().String("foo", "", "A help for foo")
-
-	// Cobra supports local flags which will only run when this command
-	// is called directly, e.g.:
-	// destroyCmd.Flags().BoolP("toggle", "t", false, "Help message for toggle")
+	destroyCmd.Flags().StringVar(&clusterID, "cluster-id", "", "ID of the cluster to destroy (default is ClusterName from the config file)")
 }
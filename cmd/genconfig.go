@@ -16,36 +16,157 @@ limitations under the License.
 package cmd
 
 import (
+	"bytes"
 	"fmt"
+	"io/ioutil"
+	"os"
+	"strconv"
 
+	"github.com/manifoldco/promptui"
+	"github.com/netapp/cake/pkg/cluster-engine/provisioner/capv"
+	"github.com/netapp/cake/pkg/config/types"
+	log "github.com/sirupsen/logrus"
 	"github.com/spf13/cobra"
+	"gopkg.in/yaml.v3"
+)
+
+var (
+	genconfigOutput  string
+	genconfigCatalog string
+	genconfigForce   bool
 )
 
 // genconfigCmd represents the genconfig command
 var genconfigCmd = &cobra.Command{
 	Use:   "genconfig",
-	Short: "A brief description of your command",
-	Long: `A longer description that spans multiple lines and likely contains examples
-and usage of using your command. For example:
-
-Cobra is a CLI library for Go that empowers applications.
-This application is a tool to generate the needed files
-to quickly create a Cobra application.`,
+	Short: "Generate a config file by answering prompts",
+	Long: `Genconfig prompts for the vSphere connection and placement, the cluster's name, machine counts and
+SSH key, and a Kubernetes version from the catalog, then writes a config file with the catalog's node and
+load balancer templates for that version. Everything else is left at its default.`,
 	Run: func(cmd *cobra.Command, args []string) {
-		fmt.Println("genconfig called")
+		if _, err := os.Stat(genconfigOutput); err == nil && !genconfigForce {
+			log.Fatalf("%s already exists, use --force to overwrite it", genconfigOutput)
+		}
+		file, err := capv.CatalogFile(genconfigCatalog)
+		if err != nil {
+			log.Fatalf(err.Error())
+		}
+		catalog, err := types.LoadCatalog(file)
+		if err != nil {
+			log.Fatalf(err.Error())
+		}
+
+		c, err := promptConfig(catalog)
+		if err != nil {
+			log.Fatalf(err.Error())
+		}
+		if err = c.Validate(); err != nil {
+			log.Fatalf(err.Error())
+		}
+		var out bytes.Buffer
+		enc := yaml.NewEncoder(&out)
+		enc.SetIndent(2)
+		err = enc.Encode(c)
+		if err != nil {
+			log.Fatalf(err.Error())
+		}
+		err = ioutil.WriteFile(genconfigOutput, out.Bytes(), 0600)
+		if err != nil {
+			log.Fatalf(err.Error())
+		}
+		log.WithField("file", genconfigOutput).Info("Config written.")
 	},
 }
 
 func init() {
 	rootCmd.AddCommand(genconfigCmd)
 
-	// Here you will define your flags and configuration settings.
+	genconfigCmd.Flags().StringVarP(&genconfigOutput, "output", "o", "cake.yaml", "config file to write")
+	genconfigCmd.Flags().StringVar(&genconfigCatalog, "catalog", "", "catalog file overriding the default catalog's releases (default is ~/"+capv.ConfigDir+"/catalog.yaml)")
+	genconfigCmd.Flags().BoolVar(&genconfigForce, "force", false, "overwrite the config file if it exists")
+}
+
+// promptConfig prompts for the config, the templates are the catalog's for the chosen version
+func promptConfig(catalog types.Catalog) (capv.MgmtCluster, error) {
+	c := capv.MgmtCluster{}
+	c.SetDefaults()
+	c.Catalog = genconfigCatalog
+	prompts := []struct {
+		label, def string
+		mask       rune
+		value      *string
+		validate   promptui.ValidateFunc
+	}{
+		{label: "Cluster name", value: &c.ClusterName, validate: required},
+		{label: "vCenter server", value: &c.VcenterServer, validate: required},
+		{label: "vSphere username", value: &c.VsphereUsername, validate: required},
+		{label: "vSphere password", mask: '*', value: &c.VspherePassword, validate: required},
+		{label: "Datacenter", value: &c.Datacenter, validate: required},
+		{label: "Datastore", value: &c.Datastore, validate: required},
+		{label: "Management network", value: &c.ManagementNetwork, validate: required},
+		{label: "Resource pool (optional)", value: &c.ResourcePool},
+		{label: "Folder", def: c.Folder, value: &c.Folder, validate: required},
+		{label: "Control plane machines", def: c.ControlPlaneMachineCount, value: &c.ControlPlaneMachineCount, validate: oddCount},
+		{label: "Worker machines", def: c.WorkerMachineCount, value: &c.WorkerMachineCount, validate: count},
+		{label: "SSH authorized key", value: &c.SSHAuthorizedKey, validate: required},
+	}
+	for _, p := range prompts {
+		prompt := promptui.Prompt{
+			Label:    p.label,
+			Default:  p.def,
+			Mask:     p.mask,
+			Validate: p.validate,
+		}
+		v, err := prompt.Run()
+		if err != nil {
+			return c, err
+		}
+		*p.value = v
+	}
 
-	// Cobra supports Persistent Flags which will work for this command
-	// and all subcommands, e.g.:
-	// genconfigCmd.PersistentFlags().String("foo", "", "A help for foo")
+	if len(catalog.Releases) == 0 {
+		return c, fmt.Errorf("the catalog has no Kubernetes versions")
+	}
+	var items []string
+	for _, r := range catalog.Releases {
+		items = append(items, fmt.Sprintf("%s (%s)", r.KubernetesVersion, r.OS))
+	}
+	version := promptui.Select{
+		Label:     "Kubernetes version",
+		Items:     items,
+		CursorPos: len(items) - 1,
+	}
+	i, _, err := version.Run()
+	if err != nil {
+		return c, err
+	}
+	release := catalog.Releases[i]
+	c.KubernetesVersion = release.KubernetesVersion
+	c.NodeTemplate = release.NodeTemplate
+	c.LoadBalancerTemplate = release.LoadBalancerTemplate
+	return c, nil
+}
+
+// required validates a prompt isn't empty
+func required(s string) error {
+	if s == "" {
+		return fmt.Errorf("a value is required")
+	}
+	return nil
+}
+
+// count validates a prompt is a machine count
+func count(s string) error {
+	if n, err := strconv.Atoi(s); err != nil || n < 0 {
+		return fmt.Errorf("%q is not a machine count", s)
+	}
+	return nil
+}
 
-	// Cobra supports local flags which will only run when this command
-	// is called directly, e.g.:
-	// genconfigCmd.Flags().BoolP("toggle", "t", false, "Help message for toggle")
+// oddCount validates a prompt is an odd machine count, for the control plane's etcd quorum
+func oddCount(s string) error {
+	if n, err := strconv.Atoi(s); err != nil || n < 1 || n%2 == 0 {
+		return fmt.Errorf("%q is not an odd machine count", s)
+	}
+	return nil
 }
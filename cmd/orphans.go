@@ -0,0 +1,71 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"text/tabwriter"
+	"time"
+
+	"github.com/netapp/cake/pkg/cluster-engine/provisioner/capv"
+	"github.com/netapp/cake/pkg/platform/vsphere"
+	log "github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+)
+
+var showAllOwned bool
+
+var orphansCmd = &cobra.Command{
+	Use:   "orphans",
+	Short: "Report vSphere objects created by cake deployments that no longer exist locally",
+	Long: `Orphans lists the vSphere objects tagged as owned by a cake cluster ID for which
+there are no local cluster files. Use --all to list the objects of every cluster ID.
+Orphaned objects can be deleted with 'cake destroy --cluster-id <id>'.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		C := capvConfig()
+
+		ctx := context.Background()
+		sm, err := vsphere.NewManagerContext(ctx, C.VcenterServer, C.VsphereUsername, C.VspherePassword)
+		if err != nil {
+			log.Fatalf(err.Error())
+		}
+		defer sm.Close()
+		r := &vsphere.Resource{SessionManager: sm}
+
+		owners, err := r.ListOwners(ctx)
+		if err != nil {
+			log.Fatalf(err.Error())
+		}
+
+		home, err := os.UserHomeDir()
+		if err != nil {
+			log.Fatalf(err.Error())
+		}
+
+		w := tabwriter.NewWriter(os.Stdout, 0, 8, 2, ' ', 0)
+		fmt.Fprintln(w, "CLUSTER ID\tORPHANED\tDEPLOYED\tTYPE\tNAME")
+		for _, owner := range owners {
+			_, err := os.Stat(filepath.Join(home, capv.ConfigDir, owner))
+			orphaned := os.IsNotExist(err)
+			if !orphaned && !showAllOwned {
+				continue
+			}
+
+			owned, err := r.ListOwned(ctx, owner)
+			if err != nil {
+				log.Fatalf(err.Error())
+			}
+			for _, o := range owned {
+				fmt.Fprintf(w, "%s\t%t\t%s\t%s\t%s\n", owner, orphaned, o.DeployedAt.Format(time.RFC3339), o.Reference.Type, o.Name)
+			}
+		}
+		w.Flush()
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(orphansCmd)
+
+	orphansCmd.Flags().BoolVar(&showAllOwned, "all", false, "list the objects of every cluster ID, not only orphans")
+}
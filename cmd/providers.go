@@ -0,0 +1,57 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"text/tabwriter"
+
+	log "github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+)
+
+var providersDryRun bool
+
+var providersCmd = &cobra.Command{
+	Use:   "providers",
+	Short: "Manage the Cluster API providers on the management cluster",
+}
+
+var providersUpgradeCmd = &cobra.Command{
+	Use:   "upgrade",
+	Short: "Upgrade the Cluster API providers on the management cluster",
+	Long: `Upgrade the Cluster API providers on the management cluster to the versions pinned by the
+Components images in the config file, or to the latest release of the current contract when none
+are pinned. The current, available and pinned versions are printed first, --dry-run stops there.`,
+	Args: cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		cluster := newManagementCluster()
+		plan, err := cluster.ProviderUpgradePlan()
+		if err != nil {
+			log.Fatalf(err.Error())
+		}
+
+		w := tabwriter.NewWriter(os.Stdout, 0, 8, 2, ' ', 0)
+		fmt.Fprintln(w, "NAME\tNAMESPACE\tTYPE\tCURRENT VERSION\tNEXT VERSION\tPINNED VERSION")
+		for _, p := range plan {
+			fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%s\n", p.Name, p.Namespace, p.Type, p.CurrentVersion, p.NextVersion, p.PinnedVersion)
+		}
+		w.Flush()
+		if providersDryRun {
+			return
+		}
+
+		log.Info("Upgrading providers...")
+		err = cluster.UpgradeProviders()
+		if err != nil {
+			log.Fatalf(err.Error())
+		}
+		log.Info("Providers upgraded.")
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(providersCmd)
+	providersCmd.AddCommand(providersUpgradeCmd)
+
+	providersUpgradeCmd.Flags().BoolVar(&providersDryRun, "dry-run", false, "only print the provider versions")
+}
@@ -0,0 +1,58 @@
+package cmd
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	"github.com/netapp/cake/pkg/cluster-engine/provisioner/capv"
+	log "github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+)
+
+var (
+	renderOutputDir   string
+	renderShowSecrets bool
+)
+
+var renderCmd = &cobra.Command{
+	Use:   "render",
+	Short: "Write the manifests deploy would apply without creating anything",
+	Long: `Render builds the bootstrap cluster's kind config and every manifest deploy applies from the config
+file, the vSphere credentials secret, the cluster spec, the CNI and the addon manifests and chart values,
+without connecting to vSphere or any cluster. They're written to stdout as a multi document YAML, or as files to --output-dir.
+Passwords are replaced with REDACTED unless --show-secrets is set.`,
+	Args: cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		manifests, err := capv.NewMgmtCluster(capvConfig()).Render(renderShowSecrets)
+		if err != nil {
+			log.Fatalf(err.Error())
+		}
+
+		if renderOutputDir == "" {
+			for _, m := range manifests {
+				fmt.Printf("---\n# %s\n%s", m.Name, m.Contents)
+			}
+			return
+		}
+		err = os.MkdirAll(renderOutputDir, 0755)
+		if err != nil {
+			log.Fatalf(err.Error())
+		}
+		for _, m := range manifests {
+			err = ioutil.WriteFile(filepath.Join(renderOutputDir, m.Name), m.Contents, 0644)
+			if err != nil {
+				log.Fatalf(err.Error())
+			}
+		}
+		log.WithField("dir", renderOutputDir).Infof("Wrote %d manifests.", len(manifests))
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(renderCmd)
+
+	renderCmd.Flags().StringVar(&renderOutputDir, "output-dir", "", "directory to write the manifests to instead of stdout")
+	renderCmd.Flags().BoolVar(&renderShowSecrets, "show-secrets", false, "render passwords instead of REDACTED")
+}
@@ -25,6 +25,7 @@ import (
 )
 
 var cfgFile string
+var installTools bool
 
 // rootCmd represents the base command when called without any subcommands
 var rootCmd = &cobra.Command{
@@ -58,6 +59,7 @@ func init() {
 	// will be global for your application.
 
 	rootCmd.PersistentFlags().StringVar(&cfgFile, "config", "", "config file (default is $HOME/.cake.yaml)")
+	rootCmd.PersistentFlags().BoolVar(&installTools, "install-tools", false, "install missing required commands at their tested versions into ~/.cluster-engine/bin")
 
 	// Cobra also supports local flags, which will only run
 	// when this action is called directly.
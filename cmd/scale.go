@@ -0,0 +1,53 @@
+package cmd
+
+import (
+	"github.com/netapp/cake/pkg/cluster-engine/provisioner"
+	log "github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+var (
+	scaleClusterName              string
+	scaleControlPlaneMachineCount int
+	scaleWorkerMachineCount       int
+	scaleNodePool                 string
+)
+
+var scaleCmd = &cobra.Command{
+	Use:   "scale",
+	Short: "Scale the control plane and worker machines of a cluster",
+	Long: `Scale sets the number of control plane and worker machines of the management cluster,
+or of one of its workload clusters with --cluster, and waits for the nodes to be ready.
+Only the counts given as flags are changed, the control plane count must be odd.`,
+	Args: cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		spec := provisioner.ScaleSpec{ClusterName: scaleClusterName, NodePool: scaleNodePool}
+		if spec.ClusterName == "" {
+			spec.ClusterName = viper.GetString("ClusterName")
+		}
+		if cmd.Flags().Changed("control-plane-machine-count") {
+			spec.ControlPlaneMachineCount = &scaleControlPlaneMachineCount
+		}
+		if cmd.Flags().Changed("worker-machine-count") {
+			spec.WorkerMachineCount = &scaleWorkerMachineCount
+		}
+
+		cluster := newManagementCluster()
+		log.WithField("ClusterName", spec.ClusterName).Info("Scaling cluster...")
+		err := cluster.Scale(spec)
+		if err != nil {
+			log.Fatalf(err.Error())
+		}
+		log.WithField("ClusterName", spec.ClusterName).Info("Cluster scaled.")
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(scaleCmd)
+
+	scaleCmd.Flags().StringVar(&scaleClusterName, "cluster", "", "name of the cluster to scale (default is ClusterName from the config file)")
+	scaleCmd.Flags().IntVar(&scaleControlPlaneMachineCount, "control-plane-machine-count", 0, "number of control plane machines")
+	scaleCmd.Flags().IntVar(&scaleWorkerMachineCount, "worker-machine-count", 0, "number of worker machines in the node pool")
+	scaleCmd.Flags().StringVar(&scaleNodePool, "node-pool", "md-0", "node pool to scale the workers of")
+}
@@ -0,0 +1,35 @@
+package cmd
+
+import (
+	"github.com/netapp/cake/pkg/cluster-engine/provisioner/capv"
+	log "github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+)
+
+var supportBundleOutputDir string
+
+var supportBundleCmd = &cobra.Command{
+	Use:   "support-bundle",
+	Short: "Collect logs and cluster state to debug a deployment",
+	Long: `Support-bundle collects the cake log file, the kind logs, the state of the Cluster API objects
+and the provider controller logs from the bootstrap and permanent clusters, and the vSphere tasks of
+the cluster's virtual machines into a timestamped tar.gz. Passwords, tokens and keys are redacted.
+What can't be collected, like a cluster that's unreachable, is listed in the bundle's errors.txt.`,
+	Args: cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		cluster := capv.NewMgmtCluster(capvConfig())
+		go logEvents(cluster.Events())
+
+		bundle, err := cluster.SupportBundle(supportBundleOutputDir)
+		if err != nil {
+			log.Fatalf(err.Error())
+		}
+		log.WithField("file", bundle).Info("Support bundle written.")
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(supportBundleCmd)
+
+	supportBundleCmd.Flags().StringVar(&supportBundleOutputDir, "output-dir", ".", "directory to write the support bundle to")
+}
@@ -0,0 +1,46 @@
+package cmd
+
+import (
+	"github.com/netapp/cake/pkg/cluster-engine/provisioner"
+	log "github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+var upgradeSpec provisioner.UpgradeSpec
+
+var upgradeCmd = &cobra.Command{
+	Use:   "upgrade",
+	Short: "Upgrade the Kubernetes version of a cluster",
+	Long: `Upgrade rolls the control plane and then the workers of the management cluster, or of one
+of its workload clusters with --cluster, onto a node template for the new Kubernetes version.
+The node template defaults to the current template name with the version replaced, and is
+imported from --ova when it doesn't exist. Only one minor version can be upgraded at a time.`,
+	Args: cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		if upgradeSpec.ClusterName == "" {
+			upgradeSpec.ClusterName = viper.GetString("ClusterName")
+		}
+
+		cluster := newManagementCluster()
+		log.WithFields(log.Fields{
+			"ClusterName":       upgradeSpec.ClusterName,
+			"KubernetesVersion": upgradeSpec.KubernetesVersion,
+		}).Info("Upgrading cluster...")
+		err := cluster.Upgrade(upgradeSpec)
+		if err != nil {
+			log.Fatalf(err.Error())
+		}
+		log.WithField("ClusterName", upgradeSpec.ClusterName).Info("Cluster upgraded.")
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(upgradeCmd)
+
+	upgradeCmd.Flags().StringVar(&upgradeSpec.KubernetesVersion, "to", "", "Kubernetes version to upgrade to, e.g. v1.18.2")
+	upgradeCmd.Flags().StringVar(&upgradeSpec.ClusterName, "cluster", "", "name of the cluster to upgrade (default is ClusterName from the config file)")
+	upgradeCmd.Flags().StringVar(&upgradeSpec.NodeTemplate, "template", "", "node template for the new version")
+	upgradeCmd.Flags().StringVar(&upgradeSpec.NodeTemplateOVA, "ova", "", "OVA path or URL to import when the node template doesn't exist")
+	upgradeCmd.MarkFlagRequired("to")
+}
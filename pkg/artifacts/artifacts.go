@@ -0,0 +1,255 @@
+// Package artifacts downloads the binaries, OVAs and charts cake needs to a local cache, from their URLs or
+// from an artifact repository like Bintray, and verifies their checksums
+package artifacts
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/netapp/cake/pkg/config/types"
+)
+
+const checksumTimeout = 30 * time.Second
+
+// Artifact is a file to fetch
+type Artifact struct {
+	// Location is a URL, a local file or, when it's neither, a path in the repository
+	Location string
+	// Checksum is the hex SHA-256 of the artifact or the location of its sha256sum file, the artifact isn't verified when empty
+	Checksum string
+	// Executable artifacts are made executable once they're verified
+	Executable bool
+}
+
+// Fetcher downloads artifacts to its cache directory. Downloads are cached under the host and path of their URL,
+// a cached artifact is only downloaded again when it doesn't match its checksum.
+type Fetcher struct {
+	// Repository is the artifact repository, its User and Token only authenticate requests for its paths
+	Repository types.BintraySpec
+	CacheDir   string
+	// Progress is told about each download when it's set
+	Progress func(event string)
+}
+
+// NewFetcher returns a fetcher of the repository's artifacts that caches them in cacheDir
+func NewFetcher(repository types.BintraySpec, cacheDir string) *Fetcher {
+	return &Fetcher{Repository: repository, CacheDir: cacheDir}
+}
+
+// IsURL reports whether a location is fetched over HTTP
+func IsURL(location string) bool {
+	return strings.HasPrefix(location, "http://") || strings.HasPrefix(location, "https://")
+}
+
+// URL returns the URL of a location, repository paths are under <Target>/<Subject>/<BasePath>/
+func (f *Fetcher) URL(location string) (string, error) {
+	if IsURL(location) {
+		return location, nil
+	}
+	if f.Repository.Target == "" {
+		return "", fmt.Errorf("%s is not a URL or a file and there's no artifact repository", location)
+	}
+	return strings.TrimSuffix(f.Repository.Target, "/") + path.Join("/", f.Repository.Subject, f.Repository.BasePath, location), nil
+}
+
+// Fetch returns the local path of the artifact, downloading it to the cache when it's not a local file
+func (f *Fetcher) Fetch(a Artifact) (string, error) {
+	if _, err := os.Stat(a.Location); err == nil && !IsURL(a.Location) {
+		if err = f.verify(a.Location, a); err != nil {
+			return "", err
+		}
+		return a.Location, nil
+	}
+	u, err := f.URL(a.Location)
+	if err != nil {
+		return "", err
+	}
+	local, err := f.cachePath(u)
+	if err != nil {
+		return "", err
+	}
+
+	if _, err = os.Stat(local); err == nil {
+		if err = f.verify(local, a); err == nil {
+			return local, nil
+		}
+	}
+	if f.Progress != nil {
+		f.Progress("downloading " + u)
+	}
+	err = os.MkdirAll(filepath.Dir(local), 0755)
+	if err != nil {
+		return "", err
+	}
+	err = f.download(u, local)
+	if err != nil {
+		return "", err
+	}
+	err = f.verify(local, a)
+	if err != nil {
+		os.Remove(local)
+		return "", err
+	}
+	return local, nil
+}
+
+// cachePath returns where a URL is cached, like <CacheDir>/storage.googleapis.com/capv-images/node.ova
+func (f *Fetcher) cachePath(rawURL string) (string, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return "", err
+	}
+	clean := path.Clean("/" + u.Path)
+	if clean == "/" {
+		return "", fmt.Errorf("%s is not a file", rawURL)
+	}
+	return filepath.Join(f.CacheDir, strings.Replace(u.Host, ":", "_", -1), filepath.FromSlash(clean)), nil
+}
+
+// verify checks the file's checksum and makes executable artifacts executable
+func (f *Fetcher) verify(file string, a Artifact) error {
+	if a.Checksum != "" {
+		want, err := f.expectedChecksum(a)
+		if err != nil {
+			return err
+		}
+		got, err := FileChecksum(file)
+		if err != nil {
+			return err
+		}
+		if got != want {
+			return fmt.Errorf("%s checksum is %s, expected %s", a.Location, got, want)
+		}
+	}
+	if a.Executable {
+		return os.Chmod(file, 0755)
+	}
+	return nil
+}
+
+// expectedChecksum returns the hex SHA-256 the checksum is or, for a sha256sum file, the one it lists for the artifact
+// or its first one
+func (f *Fetcher) expectedChecksum(a Artifact) (string, error) {
+	checksum := a.Checksum
+	if _, err := hex.DecodeString(checksum); err != nil || len(checksum) != 2*sha256.Size {
+		u, err := f.URL(checksum)
+		if err != nil {
+			return "", err
+		}
+		resp, err := f.get(u, checksumTimeout)
+		if err != nil {
+			return "", err
+		}
+		defer resp.Body.Close()
+		body, err := ioutil.ReadAll(io.LimitReader(resp.Body, 64*1024))
+		if err != nil {
+			return "", err
+		}
+		checksum = sumFor(string(body), path.Base(a.Location))
+		if checksum == "" {
+			return "", fmt.Errorf("checksum %s is empty", u)
+		}
+	}
+	checksum = strings.ToLower(checksum)
+	if b, err := hex.DecodeString(checksum); err != nil || len(b) != sha256.Size {
+		return "", fmt.Errorf("invalid SHA-256 checksum %q", checksum)
+	}
+	return checksum, nil
+}
+
+// sumFor returns the checksum a sha256sum file has for the file name, or its first checksum
+func sumFor(sums, name string) string {
+	first := ""
+	for _, line := range strings.Split(sums, "\n") {
+		fields := strings.Fields(line)
+		if len(fields) == 0 {
+			continue
+		}
+		if first == "" {
+			first = fields[0]
+		}
+		if len(fields) > 1 && path.Base(strings.TrimPrefix(fields[1], "*")) == name {
+			return fields[0]
+		}
+	}
+	return first
+}
+
+// FileChecksum returns the hex SHA-256 of a file
+func FileChecksum(file string) (string, error) {
+	fd, err := os.Open(file)
+	if err != nil {
+		return "", err
+	}
+	defer fd.Close()
+	h := sha256.New()
+	if _, err = io.Copy(h, fd); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// download downloads the URL to a temporary file next to the destination and renames it when it's complete
+func (f *Fetcher) download(u, dest string) error {
+	resp, err := f.get(u, 0)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	tmp, err := ioutil.TempFile(filepath.Dir(dest), filepath.Base(dest)+".")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	_, err = io.Copy(tmp, resp.Body)
+	if err != nil {
+		tmp.Close()
+		return fmt.Errorf("unable to download %s, %v", u, err)
+	}
+	err = tmp.Close()
+	if err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), dest)
+}
+
+// get requests the URL, with the repository's credentials when it's in the repository
+func (f *Fetcher) get(u string, timeout time.Duration) (*http.Response, error) {
+	req, err := http.NewRequest(http.MethodGet, u, nil)
+	if err != nil {
+		return nil, err
+	}
+	if f.inRepository(u) && f.Repository.User != "" {
+		req.SetBasicAuth(f.Repository.User, f.Repository.Token)
+	}
+	client := &http.Client{Timeout: timeout}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("unable to download %s, %v", u, err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		resp.Body.Close()
+		return nil, fmt.Errorf("unable to download %s, %s", u, resp.Status)
+	}
+	return resp, nil
+}
+
+// inRepository reports whether the URL is under the repository's <Target>/<Subject>/<BasePath>/
+func (f *Fetcher) inRepository(u string) bool {
+	if f.Repository.Target == "" {
+		return false
+	}
+	base, err := f.URL("")
+	return err == nil && strings.HasPrefix(u, strings.TrimSuffix(base, "/")+"/")
+}
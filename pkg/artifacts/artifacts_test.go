@@ -0,0 +1,94 @@
+package artifacts
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/netapp/cake/pkg/config/types"
+)
+
+func TestFetch(t *testing.T) {
+	tool := []byte("#!/bin/sh\necho kind\n")
+	sum := sha256.Sum256(tool)
+	checksum := hex.EncodeToString(sum[:])
+	downloads := map[string]int{}
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		user, token, ok := r.BasicAuth()
+		if strings.HasPrefix(r.URL.Path, "/netapp/") && (!ok || user != "cake" || token != "secret") {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		if !strings.HasPrefix(r.URL.Path, "/netapp/") && ok {
+			t.Errorf("got credentials for %s outside the repository", r.URL.Path)
+		}
+		downloads[r.URL.Path]++
+		switch r.URL.Path {
+		case "/netapp/cake/bin/kind", "/public/kind":
+			w.Write(tool)
+		case "/netapp/cake/bin/SHA256SUMS":
+			w.Write([]byte("0000000000000000000000000000000000000000000000000000000000000000  bin/kubectl\n" + checksum + " *bin/kind\n"))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer s.Close()
+
+	dir, err := ioutil.TempDir("", "fetch_test_")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	host := strings.Replace(s.Listener.Addr().String(), ":", "_", 1)
+
+	f := NewFetcher(types.BintraySpec{Target: s.URL, Subject: "netapp", BasePath: "cake", User: "cake", Token: "secret"}, dir)
+	var events []string
+	f.Progress = func(event string) { events = append(events, event) }
+	a := Artifact{Location: "bin/kind", Checksum: "bin/SHA256SUMS", Executable: true}
+	local, err := f.Fetch(a)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if local != filepath.Join(dir, host, "netapp", "cake", "bin", "kind") {
+		t.Errorf("got path %s", local)
+	}
+	if info, err := os.Stat(local); err != nil || info.Mode().Perm() != 0755 {
+		t.Errorf("got %v, %v, want an executable", info, err)
+	}
+	if _, err = f.Fetch(a); err != nil || downloads["/netapp/cake/bin/kind"] != 1 || len(events) != 1 {
+		t.Errorf("got %v, %d downloads and events %v fetching again, want the cached file", err, downloads["/netapp/cake/bin/kind"], events)
+	}
+
+	ioutil.WriteFile(local, []byte("corrupted"), 0755)
+	if _, err = f.Fetch(a); err != nil || downloads["/netapp/cake/bin/kind"] != 2 {
+		t.Errorf("got %v, %d downloads, want a corrupted file downloaded again", err, downloads["/netapp/cake/bin/kind"])
+	}
+	if _, err = f.Fetch(Artifact{Location: "bin/kind", Checksum: strings.Repeat("0", 64)}); err == nil {
+		t.Error("expected a checksum mismatch")
+	}
+	if _, err = os.Stat(local); !os.IsNotExist(err) {
+		t.Errorf("got %v, want the file that doesn't match removed", err)
+	}
+
+	if _, err = f.Fetch(Artifact{Location: s.URL + "/public/kind", Checksum: checksum}); err != nil {
+		t.Errorf("got %v fetching a URL", err)
+	}
+	if got, err := f.Fetch(Artifact{Location: local + ".missing"}); err == nil {
+		t.Errorf("got %s for a missing file", got)
+	}
+
+	f.Repository.Token = "wrong"
+	if _, err = f.Fetch(Artifact{Location: "bin/other"}); err == nil || !strings.Contains(err.Error(), "401") {
+		t.Errorf("got %v, want an unauthorized error", err)
+	}
+	f.Repository = types.BintraySpec{}
+	if _, err = f.Fetch(Artifact{Location: "bin/kind"}); err == nil {
+		t.Error("expected an error for a repository path without a repository")
+	}
+}
@@ -1,7 +1,6 @@
 package capv
 
 import (
-	"context"
 	"fmt"
 	"os"
 	"path/filepath"
@@ -10,10 +9,6 @@ import (
 	"golang.org/x/sync/errgroup"
 )
 
-const (
-	specWithTrident = "%s-final.yaml"
-)
-
 // InstallAddons installs any optional Addons to a management cluster
 func (m *MgmtCluster) InstallAddons() error {
 	var g errgroup.Group
@@ -31,6 +26,12 @@ func (m *MgmtCluster) InstallAddons() error {
 		}
 		return nil
 	})
+	g.Go(func() error {
+		if m.Addons.Rancher.Enable {
+			return installRancher(m)
+		}
+		return nil
+	})
 
 	return g.Wait()
 }
@@ -83,15 +84,7 @@ func installTrident(m *MgmtCluster) error {
 		return err
 	}
 
-	backend := fmt.Sprintf(
-		elementBackendJSON.Contents,
-		m.Addons.Solidfire.User,
-		m.Addons.Solidfire.Password,
-		m.Addons.Solidfire.MVIP,
-		m.Addons.Solidfire.SVIP,
-		m.ClusterName,
-	)
-	err = writeToDisk(m.ClusterName, elementBackendJSON.Name, []byte(backend), 0644)
+	err = writeToDisk(m.ClusterName, elementBackendJSON.Name, m.tridentBackend(), 0644)
 	if err != nil {
 		return err
 	}
@@ -128,52 +121,14 @@ func installTrident(m *MgmtCluster) error {
 	return err
 }
 
-// injectTridentPrereqs runs a `kubectl kustomize` command to inject trident into CAPI machines
-func injectTridentPrereqs(clusterName, storageNetwork, kubeconfigLocation string, ctx *context.Context) error {
-	var err error
-	var envs map[string]string
-
-	kf := fmt.Sprintf(KustomizationFile.Contents, clusterName, clusterName+"-md-0")
-	err = writeToDisk(clusterName, KustomizationFile.Name, []byte(kf), 0644)
-	if err != nil {
-		return err
-	}
-	po := fmt.Sprintf(PatchFileOne.Contents, storageNetwork)
-	err = writeToDisk(clusterName, PatchFileOne.Name, []byte(po), 0644)
-	if err != nil {
-		return err
-	}
-	err = writeToDisk(clusterName, PatchFileTwo.Name, []byte(PatchFileTwo.Contents), 0644)
-	if err != nil {
-		return err
-	}
-
-	err = writeToDisk(clusterName, PatchFileThree.Name, []byte(PatchFileThree.Contents), 0644)
-	if err != nil {
-		return err
-	}
-
-	if kubeconfigLocation != "" {
-		envs = map[string]string{"KUBECONFIG": kubeconfigLocation}
-	}
-
-	home, err := os.UserHomeDir()
-	if err != nil {
-		return err
-	}
-	loc := filepath.Join(home, ConfigDir, clusterName)
-	args := []string{"kustomize", loc}
-
-	c := cmds.NewCommandLine(envs, string(kubectl), args, ctx)
-
-	stdout, stderr, err := c.Program().Execute()
-	if err != nil || string(stderr) != "" {
-		return fmt.Errorf("err: %v, stderr: %v", err, string(stderr))
-	}
-	err = writeToDisk(clusterName, fmt.Sprintf(specWithTrident, clusterName), stdout, 0644)
-	if err != nil {
-		return err
-	}
-
-	return err
+// tridentBackend returns the Trident backend config for the Solidfire cluster
+func (m *MgmtCluster) tridentBackend() []byte {
+	return []byte(fmt.Sprintf(
+		elementBackendJSON.Contents,
+		m.Addons.Solidfire.User,
+		m.Addons.Solidfire.Password,
+		m.Addons.Solidfire.MVIP,
+		m.Addons.Solidfire.SVIP,
+		m.ClusterName,
+	))
 }
@@ -0,0 +1,560 @@
+package capv
+
+import (
+	"bytes"
+	"compress/gzip"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/netapp/cake/pkg/cmds"
+
+	"golang.org/x/crypto/scrypt"
+)
+
+const (
+	// backupMagic starts every backup file, followed by the scrypt salt, the AES-GCM nonce and the ciphertext
+	backupMagic       = "cakebak1"
+	backupSaltSize    = 16
+	backupKeySize     = 32
+	clusterctlGroup   = "clusterctl.cluster.x-k8s.io"
+	clusterAPIGroup   = "cluster.x-k8s.io"
+	clusterNameLabel  = "cluster.x-k8s.io/cluster-name"
+	providersCRD      = "providers." + clusterctlGroup
+	restoreFilePrefix = "restore-"
+)
+
+// scrypt parameters for the backup key, the recommended ones for interactive use
+const (
+	scryptN = 32768
+	scryptR = 8
+	scryptP = 1
+)
+
+// providerNamespaces are where clusterctl installs the providers
+var providerNamespaces = []string{
+	"capi-system",
+	"capi-webhook-system",
+	"capi-kubeadm-bootstrap-system",
+	"capi-kubeadm-control-plane-system",
+	"capv-system",
+}
+
+// backupArchive is the decrypted contents of a backup
+type backupArchive struct {
+	ClusterName string                   `json:"clusterName"`
+	CreatedAt   time.Time                `json:"createdAt"`
+	Objects     []map[string]interface{} `json:"objects"`
+}
+
+// crdList is the part of a CustomResourceDefinitionList backups need
+type crdList struct {
+	Items []struct {
+		Metadata struct {
+			Name string `json:"name"`
+		} `json:"metadata"`
+		Spec struct {
+			Group string `json:"group"`
+		} `json:"spec"`
+	} `json:"items"`
+}
+
+// objectList is a kubectl List of any kind of object
+type objectList struct {
+	APIVersion string                   `json:"apiVersion,omitempty"`
+	Kind       string                   `json:"kind"`
+	Items      []map[string]interface{} `json:"items"`
+}
+
+// encryptBackup compresses and encrypts the data with AES-GCM, using a key derived from the passphrase with scrypt
+func encryptBackup(data []byte, passphrase string) ([]byte, error) {
+	if passphrase == "" {
+		return nil, fmt.Errorf("a backup passphrase is required")
+	}
+	salt := make([]byte, backupSaltSize)
+	if _, err := io.ReadFull(rand.Reader, salt); err != nil {
+		return nil, err
+	}
+	gcm, err := backupCipher(passphrase, salt)
+	if err != nil {
+		return nil, err
+	}
+	nonce := make([]byte, gcm.NonceSize())
+	if _, err = io.ReadFull(rand.Reader, nonce); err != nil {
+		return nil, err
+	}
+
+	var compressed bytes.Buffer
+	zw := gzip.NewWriter(&compressed)
+	if _, err = zw.Write(data); err != nil {
+		return nil, err
+	}
+	if err = zw.Close(); err != nil {
+		return nil, err
+	}
+
+	out := append([]byte(backupMagic), salt...)
+	out = append(out, nonce...)
+	return gcm.Seal(out, nonce, compressed.Bytes(), []byte(backupMagic)), nil
+}
+
+// decryptBackup reverses encryptBackup
+func decryptBackup(data []byte, passphrase string) ([]byte, error) {
+	if !bytes.HasPrefix(data, []byte(backupMagic)) {
+		return nil, fmt.Errorf("not a cake backup")
+	}
+	data = data[len(backupMagic):]
+	if len(data) < backupSaltSize {
+		return nil, fmt.Errorf("backup is truncated")
+	}
+	salt := data[:backupSaltSize]
+	gcm, err := backupCipher(passphrase, salt)
+	if err != nil {
+		return nil, err
+	}
+	data = data[backupSaltSize:]
+	if len(data) < gcm.NonceSize() {
+		return nil, fmt.Errorf("backup is truncated")
+	}
+	compressed, err := gcm.Open(nil, data[:gcm.NonceSize()], data[gcm.NonceSize():], []byte(backupMagic))
+	if err != nil {
+		return nil, fmt.Errorf("unable to decrypt backup, wrong passphrase or corrupt file")
+	}
+
+	zr, err := gzip.NewReader(bytes.NewReader(compressed))
+	if err != nil {
+		return nil, err
+	}
+	defer zr.Close()
+	return ioutil.ReadAll(zr)
+}
+
+func backupCipher(passphrase string, salt []byte) (cipher.AEAD, error) {
+	key, err := scrypt.Key([]byte(passphrase), salt, scryptN, scryptR, scryptP, backupKeySize)
+	if err != nil {
+		return nil, err
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// backupCRDs returns the names of the Cluster API CRDs installed by clusterctl, leaving out
+// clusterctl's own inventory which clusterctl init recreates
+func backupCRDs(crds crdList) []string {
+	var names []string
+	for _, crd := range crds.Items {
+		group := crd.Spec.Group
+		if group == clusterctlGroup || (group != clusterAPIGroup && !strings.HasSuffix(group, "."+clusterAPIGroup)) {
+			continue
+		}
+		names = append(names, crd.Metadata.Name)
+	}
+	return names
+}
+
+// Backup exports the management cluster's Cluster API, CAPV and CABPK objects, and the secrets of the clusters
+// like their kubeconfigs and CAs, the same objects clusterctl move moves, to a file encrypted with the passphrase
+func (m *MgmtCluster) Backup(file, passphrase string) error {
+	kubeConfig, err := m.managementKubeconfig()
+	if err != nil {
+		return err
+	}
+	envs := map[string]string{
+		"KUBECONFIG": kubeConfig,
+	}
+
+	m.events <- Event{EventType: "progress", Event: "finding the Cluster API resources"}
+	var crds crdList
+	err = kubeGetJSON(envs, &crds, "customresourcedefinitions", "--selector=clusterctl.cluster.x-k8s.io")
+	if err != nil {
+		return err
+	}
+
+	archive := backupArchive{
+		ClusterName: m.ClusterName,
+		CreatedAt:   time.Now().UTC(),
+	}
+	resources := append(backupCRDs(crds), "secrets")
+	for _, resource := range resources {
+		args := []string{resource, "--all-namespaces"}
+		if resource == "secrets" {
+			args = append(args, "--selector="+clusterNameLabel)
+		}
+		var list objectList
+		err = kubeGetJSON(envs, &list, args...)
+		if err != nil {
+			return err
+		}
+		archive.Objects = append(archive.Objects, list.Items...)
+	}
+	m.events <- Event{EventType: "progress", Event: fmt.Sprintf("backing up %d objects", len(archive.Objects))}
+
+	data, err := json.Marshal(archive)
+	if err != nil {
+		return err
+	}
+	out, err := encryptBackup(data, passphrase)
+	if err != nil {
+		return err
+	}
+	err = ioutil.WriteFile(file, out, 0600)
+	if err != nil {
+		return err
+	}
+	m.events <- Event{EventType: "progress", Event: "backup written to " + file}
+	return err
+}
+
+// restoreObject returns a copy of a backed up object ready to be created in a new cluster: the server set
+// metadata and status are removed, owner references point at the new UIDs and clusters are paused
+func restoreObject(obj map[string]interface{}, uids map[string]string) map[string]interface{} {
+	restored := map[string]interface{}{}
+	for k, v := range obj {
+		if k != "status" {
+			restored[k] = v
+		}
+	}
+	metadata := map[string]interface{}{}
+	if md, ok := obj["metadata"].(map[string]interface{}); ok {
+		for k, v := range md {
+			switch k {
+			case "uid", "resourceVersion", "creationTimestamp", "generation", "managedFields", "selfLink", "ownerReferences":
+				continue
+			}
+			metadata[k] = v
+		}
+		var owners []interface{}
+		refs, _ := md["ownerReferences"].([]interface{})
+		for _, r := range refs {
+			ref, ok := r.(map[string]interface{})
+			if !ok {
+				continue
+			}
+			uid, ok := uids[fmt.Sprint(ref["uid"])]
+			if !ok {
+				continue
+			}
+			owner := map[string]interface{}{}
+			for k, v := range ref {
+				owner[k] = v
+			}
+			owner["uid"] = uid
+			owners = append(owners, owner)
+		}
+		if len(owners) > 0 {
+			metadata["ownerReferences"] = owners
+		}
+	}
+	restored["metadata"] = metadata
+
+	if restored["kind"] == "Cluster" && strings.HasPrefix(fmt.Sprint(restored["apiVersion"]), clusterAPIGroup+"/") {
+		spec := map[string]interface{}{}
+		if s, ok := obj["spec"].(map[string]interface{}); ok {
+			for k, v := range s {
+				spec[k] = v
+			}
+		}
+		spec["paused"] = true
+		restored["spec"] = spec
+	}
+	return restored
+}
+
+// objectUID returns the UID of an object
+func objectUID(obj map[string]interface{}) string {
+	md, _ := obj["metadata"].(map[string]interface{})
+	if md == nil || md["uid"] == nil {
+		return ""
+	}
+	return fmt.Sprint(md["uid"])
+}
+
+// objectKey identifies an object by its kind, namespace and name
+func objectKey(obj map[string]interface{}) string {
+	md, _ := obj["metadata"].(map[string]interface{})
+	var namespace, name interface{}
+	if md != nil {
+		namespace, name = md["namespace"], md["name"]
+	}
+	return fmt.Sprintf("%v/%v/%v", obj["kind"], namespace, name)
+}
+
+// restoreOrder groups the objects so every object comes after the owners it references from the backup
+func restoreOrder(objs []map[string]interface{}) ([][]map[string]interface{}, error) {
+	inBackup := map[string]bool{}
+	for _, obj := range objs {
+		if uid := objectUID(obj); uid != "" {
+			inBackup[uid] = true
+		}
+	}
+
+	var groups [][]map[string]interface{}
+	created := map[string]bool{}
+	remaining := objs
+	for len(remaining) > 0 {
+		var group, next []map[string]interface{}
+		for _, obj := range remaining {
+			ready := true
+			md, _ := obj["metadata"].(map[string]interface{})
+			refs, _ := md["ownerReferences"].([]interface{})
+			for _, r := range refs {
+				ref, _ := r.(map[string]interface{})
+				uid := fmt.Sprint(ref["uid"])
+				if inBackup[uid] && !created[uid] {
+					ready = false
+				}
+			}
+			if ready {
+				group = append(group, obj)
+			} else {
+				next = append(next, obj)
+			}
+		}
+		if len(group) == 0 {
+			return nil, fmt.Errorf("owner references between %d objects form a cycle", len(next))
+		}
+		for _, obj := range group {
+			created[objectUID(obj)] = true
+		}
+		groups = append(groups, group)
+		remaining = next
+	}
+	return groups, nil
+}
+
+// Restore imports a backup into a new cluster, which becomes the management cluster. The providers are installed
+// first if they aren't already. Clusters are created paused, so nothing is reconciled until every object is restored.
+func (m *MgmtCluster) Restore(file, passphrase, kubeConfig string) error {
+	data, err := ioutil.ReadFile(file)
+	if err != nil {
+		return err
+	}
+	data, err = decryptBackup(data, passphrase)
+	if err != nil {
+		return err
+	}
+	var archive backupArchive
+	err = json.Unmarshal(data, &archive)
+	if err != nil {
+		return fmt.Errorf("error with unmarshal: %v", err.Error())
+	}
+	if archive.ClusterName != m.ClusterName {
+		return fmt.Errorf("backup is of management cluster %s, not %s", archive.ClusterName, m.ClusterName)
+	}
+	groups, err := restoreOrder(archive.Objects)
+	if err != nil {
+		return err
+	}
+
+	kubeConfig, err = filepath.Abs(kubeConfig)
+	if err != nil {
+		return err
+	}
+	envs := map[string]string{
+		"KUBECONFIG": kubeConfig,
+	}
+	err = m.ensureProviders(kubeConfig)
+	if err != nil {
+		return err
+	}
+	err = m.ensureNamespaces(envs, archive.Objects)
+	if err != nil {
+		return err
+	}
+
+	m.events <- Event{EventType: "progress", Event: fmt.Sprintf("restoring %d objects from the %s backup", len(archive.Objects), archive.CreatedAt.Format(time.RFC3339))}
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return err
+	}
+	uids := map[string]string{}
+	for i, group := range groups {
+		oldUIDs := map[string]string{}
+		list := objectList{APIVersion: "v1", Kind: "List"}
+		for _, obj := range group {
+			oldUIDs[objectKey(obj)] = objectUID(obj)
+			list.Items = append(list.Items, restoreObject(obj, uids))
+		}
+		out, err := json.Marshal(list)
+		if err != nil {
+			return err
+		}
+		fileName := fmt.Sprintf("%s%d.json", restoreFilePrefix, i)
+		err = writeToDisk(m.ClusterName, fileName, out, 0600)
+		if err != nil {
+			return err
+		}
+		args := []string{
+			"create",
+			"--filename=" + filepath.Join(home, ConfigDir, m.ClusterName, fileName),
+			"--output=json",
+		}
+		c := cmds.NewCommandLine(envs, string(kubectl), args, nil)
+		stdout, stderr, err := c.Program().Execute()
+		os.Remove(filepath.Join(home, ConfigDir, m.ClusterName, fileName))
+		if err != nil || string(stderr) != "" {
+			return fmt.Errorf("err: %v, stderr: %v, cmd: %v %v", err, string(stderr), c.CommandName, c.Args)
+		}
+		created, err := createdObjects(stdout)
+		if err != nil {
+			return err
+		}
+		for _, obj := range created {
+			if old := oldUIDs[objectKey(obj)]; old != "" {
+				uids[old] = objectUID(obj)
+			}
+		}
+	}
+
+	m.events <- Event{EventType: "progress", Event: "unpausing the restored clusters"}
+	for _, obj := range archive.Objects {
+		if obj["kind"] != "Cluster" || !strings.HasPrefix(fmt.Sprint(obj["apiVersion"]), clusterAPIGroup+"/") {
+			continue
+		}
+		md, _ := obj["metadata"].(map[string]interface{})
+		paused := false
+		if spec, ok := obj["spec"].(map[string]interface{}); ok && spec["paused"] == true {
+			paused = true
+		}
+		patch, err := json.Marshal(map[string]interface{}{"spec": map[string]interface{}{"paused": paused}})
+		if err != nil {
+			return err
+		}
+		args := []string{
+			"patch",
+			"cluster",
+			fmt.Sprint(md["name"]),
+			"--namespace=" + fmt.Sprint(md["namespace"]),
+			"--type=merge",
+			"--patch=" + string(patch),
+		}
+		err = cmds.GenericExecute(envs, string(kubectl), args, nil)
+		if err != nil {
+			return err
+		}
+	}
+
+	kubeConfigData, err := ioutil.ReadFile(kubeConfig)
+	if err != nil {
+		return err
+	}
+	err = writeToDisk(m.ClusterName, "kubeconfig", kubeConfigData, 0644)
+	if err != nil {
+		return err
+	}
+	m.events <- Event{EventType: "progress", Event: "restored management cluster " + m.ClusterName}
+	return err
+}
+
+// createdObjects decodes the output of kubectl create, a single object or a List
+func createdObjects(out []byte) ([]map[string]interface{}, error) {
+	var list objectList
+	err := json.Unmarshal(out, &list)
+	if err != nil {
+		return nil, fmt.Errorf("error with unmarshal: %v", err.Error())
+	}
+	if list.Kind == "List" {
+		return list.Items, nil
+	}
+	var obj map[string]interface{}
+	err = json.Unmarshal(out, &obj)
+	if err != nil {
+		return nil, fmt.Errorf("error with unmarshal: %v", err.Error())
+	}
+	return []map[string]interface{}{obj}, nil
+}
+
+// ensureProviders installs the providers with clusterctl when they aren't installed in the cluster,
+// and waits for their controllers
+func (m *MgmtCluster) ensureProviders(kubeConfig string) error {
+	envs := map[string]string{
+		"KUBECONFIG": kubeConfig,
+	}
+	crds, err := kubeNames(envs, "customresourcedefinitions", "")
+	if err != nil {
+		return err
+	}
+	for _, crd := range crds {
+		if crd == providersCRD {
+			return nil
+		}
+	}
+
+	m.events <- Event{EventType: "progress", Event: "init capi in the restore cluster"}
+	err = writeToDisk(m.ClusterName, VsphereCredsSecret.Name, m.vsphereCredsSecret(), 0644)
+	if err != nil {
+		return err
+	}
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return err
+	}
+	args := []string{
+		"apply",
+		"--filename=" + filepath.Join(home, ConfigDir, m.ClusterName, VsphereCredsSecret.Name),
+	}
+	err = cmds.GenericExecute(envs, string(kubectl), args, nil)
+	if err != nil {
+		return err
+	}
+	args, err = m.clusterctlInitArgs()
+	if err != nil {
+		return err
+	}
+	err = cmds.GenericExecute(m.clusterctlEnvs(kubeConfig), string(clusterctl), args, nil)
+	if err != nil {
+		return err
+	}
+
+	for _, namespace := range providerNamespaces {
+		args := []string{
+			"wait",
+			"deployments",
+			"--all",
+			"--namespace=" + namespace,
+			"--for=condition=Available",
+			"--timeout=" + (5 * time.Minute).String(),
+		}
+		err = cmds.GenericExecute(envs, string(kubectl), args, nil)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// ensureNamespaces creates the namespaces of the objects that don't exist yet
+func (m *MgmtCluster) ensureNamespaces(envs map[string]string, objs []map[string]interface{}) error {
+	existing, err := kubeNames(envs, "namespaces", "")
+	if err != nil {
+		return err
+	}
+	namespaces := map[string]bool{}
+	for _, ns := range existing {
+		namespaces[ns] = true
+	}
+	for _, obj := range objs {
+		md, _ := obj["metadata"].(map[string]interface{})
+		ns, _ := md["namespace"].(string)
+		if ns == "" || namespaces[ns] {
+			continue
+		}
+		err = cmds.GenericExecute(envs, string(kubectl), []string{"create", "namespace", ns}, nil)
+		if err != nil {
+			return err
+		}
+		namespaces[ns] = true
+	}
+	return nil
+}
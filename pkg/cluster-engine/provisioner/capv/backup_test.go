@@ -0,0 +1,130 @@
+package capv
+
+import (
+	"bytes"
+	"encoding/json"
+	"reflect"
+	"testing"
+)
+
+func TestEncryptBackup(t *testing.T) {
+	data := []byte(`{"clusterName":"capv-mgmt-cluster"}`)
+	encrypted, err := encryptBackup(data, "passphrase")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if bytes.Contains(encrypted, data) {
+		t.Error("backup isn't encrypted")
+	}
+
+	decrypted, err := decryptBackup(encrypted, "passphrase")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(decrypted, data) {
+		t.Errorf("got %s, want %s", decrypted, data)
+	}
+	if _, err = decryptBackup(encrypted, "wrong"); err == nil {
+		t.Error("expected an error with the wrong passphrase")
+	}
+	if _, err = decryptBackup(encrypted[:len(backupMagic)+4], "passphrase"); err == nil {
+		t.Error("expected an error for a truncated backup")
+	}
+	if _, err = encryptBackup(data, ""); err == nil {
+		t.Error("expected an error without a passphrase")
+	}
+}
+
+func TestBackupCRDs(t *testing.T) {
+	var crds crdList
+	err := json.Unmarshal([]byte(`{"items": [
+		{"metadata": {"name": "clusters.cluster.x-k8s.io"}, "spec": {"group": "cluster.x-k8s.io"}},
+		{"metadata": {"name": "vsphereclusters.infrastructure.cluster.x-k8s.io"}, "spec": {"group": "infrastructure.cluster.x-k8s.io"}},
+		{"metadata": {"name": "providers.clusterctl.cluster.x-k8s.io"}, "spec": {"group": "clusterctl.cluster.x-k8s.io"}},
+		{"metadata": {"name": "certificates.cert-manager.io"}, "spec": {"group": "cert-manager.io"}}
+	]}`), &crds)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{"clusters.cluster.x-k8s.io", "vsphereclusters.infrastructure.cluster.x-k8s.io"}
+	if got := backupCRDs(crds); !reflect.DeepEqual(got, want) {
+		t.Errorf("got CRDs %v, want %v", got, want)
+	}
+}
+
+func backupObject(kind, name, uid string, owners ...string) map[string]interface{} {
+	var refs []interface{}
+	for _, owner := range owners {
+		refs = append(refs, map[string]interface{}{"kind": "Owner", "uid": owner})
+	}
+	md := map[string]interface{}{"name": name, "namespace": "default", "uid": uid, "resourceVersion": "1"}
+	if refs != nil {
+		md["ownerReferences"] = refs
+	}
+	return map[string]interface{}{
+		"apiVersion": "cluster.x-k8s.io/v1alpha3",
+		"kind":       kind,
+		"metadata":   md,
+		"spec":       map[string]interface{}{},
+		"status":     map[string]interface{}{"phase": "Provisioned"},
+	}
+}
+
+func TestRestoreOrder(t *testing.T) {
+	cluster := backupObject("Cluster", "c", "1")
+	kcp := backupObject("KubeadmControlPlane", "c", "2", "1")
+	machine := backupObject("Machine", "m", "3", "2")
+	orphan := backupObject("Secret", "s", "4", "deleted")
+
+	groups, err := restoreOrder([]map[string]interface{}{machine, orphan, kcp, cluster})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var names [][]string
+	for _, group := range groups {
+		var g []string
+		for _, obj := range group {
+			g = append(g, objectKey(obj))
+		}
+		names = append(names, g)
+	}
+	want := [][]string{
+		{"Secret/default/s", "Cluster/default/c"},
+		{"KubeadmControlPlane/default/c"},
+		{"Machine/default/m"},
+	}
+	if !reflect.DeepEqual(names, want) {
+		t.Errorf("got restore order %v, want %v", names, want)
+	}
+
+	cycle := []map[string]interface{}{backupObject("Machine", "a", "5", "6"), backupObject("Machine", "b", "6", "5")}
+	if _, err = restoreOrder(cycle); err == nil {
+		t.Error("expected an error for an ownership cycle")
+	}
+}
+
+func TestRestoreObject(t *testing.T) {
+	restored := restoreObject(backupObject("Cluster", "c", "1"), nil)
+	if _, ok := restored["status"]; ok {
+		t.Error("expected the status to be removed")
+	}
+	md := restored["metadata"].(map[string]interface{})
+	if _, ok := md["uid"]; ok {
+		t.Error("expected the uid to be removed")
+	}
+	if _, ok := md["resourceVersion"]; ok {
+		t.Error("expected the resourceVersion to be removed")
+	}
+	if restored["spec"].(map[string]interface{})["paused"] != true {
+		t.Error("expected the cluster to be paused")
+	}
+
+	restored = restoreObject(backupObject("Machine", "m", "3", "2", "deleted"), map[string]string{"2": "new"})
+	refs := restored["metadata"].(map[string]interface{})["ownerReferences"].([]interface{})
+	if len(refs) != 1 || refs[0].(map[string]interface{})["uid"] != "new" {
+		t.Errorf("got owner references %v, want the restored owner's new uid", refs)
+	}
+	if _, ok := restored["spec"].(map[string]interface{})["paused"]; ok {
+		t.Error("expected only clusters to be paused")
+	}
+}
@@ -2,45 +2,325 @@ package capv
 
 import (
 	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
 	"time"
 
 	"github.com/netapp/cake/pkg/cmds"
+
+	"sigs.k8s.io/yaml"
+)
+
+const (
+	kindConfigFile   = "kind-config.yaml"
+	kindConfigAPI    = "kind.x-k8s.io/v1alpha4"
+	bootstrapTimeout = 5 * time.Minute
+	// clusterctlCRDGroup is the API group of the CRD clusterctl records the installed providers in
+	clusterctlCRDGroup = ".clusterctl.cluster.x-k8s.io"
 )
 
-// CreateBootstrap creates the temporary CAPv bootstrap cluster
+// bootstrapResourceTypes are the resources recorded in an existing bootstrap cluster before CAPv is installed
+// in it, the ones clusterctl installed are deleted after the pivot. Namespaces are deleted first to stop the controllers.
+var bootstrapResourceTypes = []string{"namespaces", "customresourcedefinitions"}
+
+// clusterctlSelectors select the providers' and cert-manager's resources clusterctl installs by their labels
+var clusterctlSelectors = []string{"clusterctl.cluster.x-k8s.io", "clusterctl.cluster.x-k8s.io/core"}
+
+// kindConfig is the subset of the kind v1alpha4 Cluster config the bootstrap cluster uses
+type kindConfig struct {
+	Kind                    string     `json:"kind"`
+	APIVersion              string     `json:"apiVersion"`
+	Name                    string     `json:"name"`
+	Nodes                   []kindNode `json:"nodes"`
+	ContainerdConfigPatches []string   `json:"containerdConfigPatches,omitempty"`
+}
+
+type kindNode struct {
+	Role        string      `json:"role"`
+	Image       string      `json:"image,omitempty"`
+	ExtraMounts []kindMount `json:"extraMounts,omitempty"`
+}
+
+type kindMount struct {
+	HostPath      string `json:"hostPath"`
+	ContainerPath string `json:"containerPath"`
+	ReadOnly      bool   `json:"readOnly,omitempty"`
+}
+
+// bootstrapClusterName is the kind cluster name, it's unique per deployment so
+// deployments on the same host don't use each other's bootstrap cluster
+func (m *MgmtCluster) bootstrapClusterName() string {
+	return m.ClusterName + "-bootstrap"
+}
+
+// kindConfig returns the kind config for the bootstrap cluster
+func (m *MgmtCluster) kindConfig() ([]byte, error) {
+	node := kindNode{
+		Role:  "control-plane",
+		Image: m.Bootstrap.NodeImage,
+	}
+	for _, mount := range m.Bootstrap.ExtraMounts {
+		if mount.HostPath == "" || mount.ContainerPath == "" {
+			return nil, fmt.Errorf("bootstrap extra mounts need a HostPath and a ContainerPath")
+		}
+		node.ExtraMounts = append(node.ExtraMounts, kindMount{
+			HostPath:      mount.HostPath,
+			ContainerPath: mount.ContainerPath,
+			ReadOnly:      mount.ReadOnly,
+		})
+	}
+	config := kindConfig{
+		Kind:       "Cluster",
+		APIVersion: kindConfigAPI,
+		Name:       m.bootstrapClusterName(),
+		Nodes:      []kindNode{node},
+	}
+	if len(m.Bootstrap.RegistryMirrors) > 0 {
+		var patch strings.Builder
+		for _, mirror := range m.Bootstrap.RegistryMirrors {
+			if mirror.Registry == "" || mirror.Endpoint == "" {
+				return nil, fmt.Errorf("bootstrap registry mirrors need a Registry and an Endpoint")
+			}
+			fmt.Fprintf(&patch, "[plugins.\"io.containerd.grpc.v1.cri\".registry.mirrors.%q]\n", mirror.Registry)
+			fmt.Fprintf(&patch, "  endpoint = [%q]\n", mirror.Endpoint)
+		}
+		config.ContainerdConfigPatches = []string{patch.String()}
+	}
+	return yaml.Marshal(config)
+}
+
+// proxyEnvs returns the proxy environment for kind, which passes it to the node containers
+func (m *MgmtCluster) proxyEnvs() map[string]string {
+	envs := map[string]string{}
+	proxies := map[string]string{
+		"HTTP_PROXY":  m.Bootstrap.HTTPProxy,
+		"HTTPS_PROXY": m.Bootstrap.HTTPSProxy,
+		"NO_PROXY":    m.Bootstrap.NoProxy,
+	}
+	for k, v := range proxies {
+		if v != "" {
+			envs[k] = v
+			envs[strings.ToLower(k)] = v
+		}
+	}
+	if len(envs) == 0 {
+		return nil
+	}
+	return envs
+}
+
+// kindClusters returns the names of the kind clusters on the host
+func kindClusters() ([]string, error) {
+	args := []string{
+		"get",
+		"clusters",
+	}
+	c := cmds.NewCommandLine(nil, string(kind), args, nil)
+	stdout, stderr, err := c.Program().Execute()
+	if err != nil {
+		return nil, fmt.Errorf("err: %v, stderr: %v, cmd: %v %v", err, string(stderr), c.CommandName, c.Args)
+	}
+	return strings.Fields(string(stdout)), nil
+}
+
+// CreateBootstrap creates the temporary CAPv bootstrap cluster, it's a kind cluster or helper VM named after the
+// deployment with its kubeconfig written to the cluster's directory, or the existing cluster in the Bootstrap Kubeconfig
 func (m *MgmtCluster) CreateBootstrap() error {
 	var err error
 
-	m.events <- Event{EventType: "progress", Event: "kind create cluster (bootstrap cluster)"}
+	if m.Bootstrap.Kubeconfig != "" && m.Bootstrap.HelperVM.Enable {
+		return fmt.Errorf("the bootstrap cluster can be an existing cluster or a helper VM, not both")
+	}
+	if m.Bootstrap.Kubeconfig != "" {
+		return m.useExistingBootstrap()
+	}
+	if m.Bootstrap.HelperVM.Enable {
+		return m.createHelperVM()
+	}
+
+	name := m.bootstrapClusterName()
+	clusters, err := kindClusters()
+	if err != nil {
+		return err
+	}
+	for _, c := range clusters {
+		if c == name {
+			return fmt.Errorf("bootstrap cluster %s already exists, delete it with `kind delete cluster --name=%s`", name, name)
+		}
+	}
 
+	config, err := m.kindConfig()
+	if err != nil {
+		return err
+	}
+	err = writeToDisk(m.ClusterName, kindConfigFile, config, 0644)
+	if err != nil {
+		return err
+	}
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return err
+	}
+	clusterDir := filepath.Join(home, ConfigDir, m.ClusterName)
+
+	m.events <- Event{EventType: "progress", Event: "kind create cluster (bootstrap cluster " + name + ")"}
 	args := []string{
 		"create",
 		"cluster",
+		"--name=" + name,
+		"--config=" + filepath.Join(clusterDir, kindConfigFile),
+		"--kubeconfig=" + filepath.Join(clusterDir, bootstrapKubeconfig),
+		"--wait=" + bootstrapTimeout.String(),
 	}
-	err = cmds.GenericExecute(nil, string(kind), args, nil)
+	return cmds.GenericExecute(m.proxyEnvs(), string(kind), args, nil)
+}
+
+// useExistingBootstrap copies the existing cluster's kubeconfig to the cluster's directory and records its
+// namespaces and CRDs, it fails when Cluster API is already installed in it
+func (m *MgmtCluster) useExistingBootstrap() error {
+	m.events <- Event{EventType: "progress", Event: "using existing bootstrap cluster from " + m.Bootstrap.Kubeconfig}
+	kubeConfig, err := ioutil.ReadFile(m.Bootstrap.Kubeconfig)
+	if err != nil {
+		return fmt.Errorf("unable to read bootstrap kubeconfig, %v", err)
+	}
+	err = writeToDisk(m.ClusterName, bootstrapKubeconfig, kubeConfig, 0644)
+	if err != nil {
+		return err
+	}
+	home, err := os.UserHomeDir()
 	if err != nil {
 		return err
 	}
+	envs := map[string]string{
+		"KUBECONFIG": filepath.Join(home, ConfigDir, m.ClusterName, bootstrapKubeconfig),
+	}
 
-	m.events <- Event{EventType: "progress", Event: "getting and writing bootstrap cluster kubeconfig to disk"}
-	args = []string{
+	m.bootstrapResources = map[string][]string{}
+	for _, resource := range bootstrapResourceTypes {
+		names, err := kubeNames(envs, resource, "")
+		if err != nil {
+			return err
+		}
+		m.bootstrapResources[resource] = names
+	}
+	for _, crd := range m.bootstrapResources["customresourcedefinitions"] {
+		if strings.HasSuffix(crd, clusterctlCRDGroup) {
+			return fmt.Errorf("Cluster API is already installed in the bootstrap cluster, it can't be shared by deployments")
+		}
+	}
+	return nil
+}
+
+// kubeNames returns the names of a cluster scoped resource, only the ones matching the label selector when it's set
+func kubeNames(envs map[string]string, resource, selector string) ([]string, error) {
+	args := []string{
 		"get",
-		"kubeconfig",
+		resource,
+		"--output=jsonpath={.items[*].metadata.name}",
 	}
-	c := cmds.NewCommandLine(nil, string(kind), args, nil)
+	if selector != "" {
+		args = append(args, "--selector="+selector)
+	}
+	c := cmds.NewCommandLine(envs, string(kubectl), args, nil)
 	stdout, stderr, err := c.Program().Execute()
 	if err != nil || string(stderr) != "" {
-		return fmt.Errorf("err: %v, stderr: %v", err, string(stderr))
+		return nil, fmt.Errorf("err: %v, stderr: %v, cmd: %v %v", err, string(stderr), c.CommandName, c.Args)
+	}
+	return strings.Fields(string(stdout)), nil
+}
+
+// installedResources returns the names in after that aren't in before, once each
+func installedResources(before, after []string) []string {
+	existing := map[string]bool{}
+	for _, name := range before {
+		existing[name] = true
+	}
+	var installed []string
+	for _, name := range after {
+		if !existing[name] {
+			installed = append(installed, name)
+			existing[name] = true
+		}
 	}
+	return installed
+}
 
-	err = writeToDisk(m.ClusterName, bootstrapKubeconfig, []byte(stdout), 0644)
+// deleteBootstrap deletes the kind bootstrap cluster or helper VM, or what was installed in an existing one, and its kubeconfig
+func (m *MgmtCluster) deleteBootstrap() error {
+	if m.Bootstrap.Kubeconfig != "" {
+		return m.cleanExistingBootstrap()
+	}
+	if m.Bootstrap.HelperVM.Enable {
+		return m.deleteHelperVM()
+	}
+
+	name := m.bootstrapClusterName()
+	m.events <- Event{EventType: "progress", Event: "kind delete cluster (bootstrap cluster " + name + ")"}
+
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return err
+	}
+	kubeConfig := filepath.Join(home, ConfigDir, m.ClusterName, bootstrapKubeconfig)
+	args := []string{
+		"delete",
+		"cluster",
+		"--name=" + name,
+		"--kubeconfig=" + kubeConfig,
+	}
+	err = cmds.GenericExecute(nil, string(kind), args, nil)
 	if err != nil {
 		return err
 	}
+	err = os.Remove(kubeConfig)
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
 
-	// TODO wait for cluster components to be running
-	m.events <- Event{EventType: "progress", Event: "sleeping 20 seconds, need to fix this"}
-	time.Sleep(20 * time.Second)
+// cleanExistingBootstrap deletes the namespaces and CRDs clusterctl installed in the existing bootstrap cluster,
+// the ones with its labels that weren't there before, and removes the copy of its kubeconfig
+func (m *MgmtCluster) cleanExistingBootstrap() error {
+	if m.bootstrapResources == nil {
+		return fmt.Errorf("the existing bootstrap cluster's resources weren't recorded, not cleaning it up")
+	}
+	m.events <- Event{EventType: "progress", Event: "deleting the namespaces and CRDs clusterctl installed in the existing bootstrap cluster"}
 
-	return err
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return err
+	}
+	kubeConfig := filepath.Join(home, ConfigDir, m.ClusterName, bootstrapKubeconfig)
+	envs := map[string]string{
+		"KUBECONFIG": kubeConfig,
+	}
+	for _, resource := range bootstrapResourceTypes {
+		var labeled []string
+		for _, selector := range clusterctlSelectors {
+			names, err := kubeNames(envs, resource, selector)
+			if err != nil {
+				return err
+			}
+			labeled = append(labeled, names...)
+		}
+		installed := installedResources(m.bootstrapResources[resource], labeled)
+		if len(installed) == 0 {
+			continue
+		}
+		args := append([]string{"delete", resource}, installed...)
+		args = append(args, "--ignore-not-found", "--timeout="+bootstrapTimeout.String())
+		err = cmds.GenericExecute(envs, string(kubectl), args, nil)
+		if err != nil {
+			return err
+		}
+	}
+
+	err = os.Remove(kubeConfig)
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
 }
@@ -0,0 +1,76 @@
+package capv
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestKindConfig(t *testing.T) {
+	m := testCluster()
+	m.Bootstrap = Bootstrap{
+		NodeImage: "kindest/node:v1.17.0",
+		RegistryMirrors: []RegistryMirror{
+			{Registry: "docker.io", Endpoint: "https://mirror.example.com:5000"},
+			{Registry: "gcr.io", Endpoint: "https://mirror.example.com:5001"},
+		},
+		ExtraMounts: []Mount{{HostPath: "/etc/ssl/certs", ContainerPath: "/etc/ssl/certs", ReadOnly: true}},
+	}
+
+	out, err := m.kindConfig()
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := `apiVersion: kind.x-k8s.io/v1alpha4
+containerdConfigPatches:
+- |
+  [plugins."io.containerd.grpc.v1.cri".registry.mirrors."docker.io"]
+    endpoint = ["https://mirror.example.com:5000"]
+  [plugins."io.containerd.grpc.v1.cri".registry.mirrors."gcr.io"]
+    endpoint = ["https://mirror.example.com:5001"]
+kind: Cluster
+name: ` + m.ClusterName + `-bootstrap
+nodes:
+- extraMounts:
+  - containerPath: /etc/ssl/certs
+    hostPath: /etc/ssl/certs
+    readOnly: true
+  image: kindest/node:v1.17.0
+  role: control-plane
+`
+	if string(out) != want {
+		t.Errorf("got kind config\n%s\nwant\n%s", out, want)
+	}
+
+	m.Bootstrap.ExtraMounts = []Mount{{HostPath: "/tmp"}}
+	if _, err = m.kindConfig(); err == nil {
+		t.Error("expected an error for a mount without a ContainerPath")
+	}
+}
+
+func TestProxyEnvs(t *testing.T) {
+	m := testCluster()
+	if envs := m.proxyEnvs(); envs != nil {
+		t.Errorf("got proxy envs %v without a proxy", envs)
+	}
+
+	m.Bootstrap.HTTPSProxy = "http://proxy.example.com:3128"
+	envs := m.proxyEnvs()
+	if len(envs) != 2 || envs["HTTPS_PROXY"] != m.Bootstrap.HTTPSProxy || envs["https_proxy"] != m.Bootstrap.HTTPSProxy {
+		t.Errorf("got proxy envs %v", envs)
+	}
+}
+
+func TestInstalledResources(t *testing.T) {
+	before := []string{"default", "kube-system", "cert-manager"}
+	after := []string{"capi-system", "cert-manager", "default", "capv-system", "kube-system"}
+	want := []string{"capi-system", "capv-system"}
+	if got := installedResources(before, after); !reflect.DeepEqual(got, want) {
+		t.Errorf("got installed resources %v, want %v", got, want)
+	}
+	if got := installedResources(before, append(after, "capi-system")); !reflect.DeepEqual(got, want) {
+		t.Errorf("got installed resources %v, want each once", got)
+	}
+	if got := installedResources(before, before); got != nil {
+		t.Errorf("got installed resources %v, want none", got)
+	}
+}
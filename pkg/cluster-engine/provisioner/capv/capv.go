@@ -2,9 +2,13 @@ package capv
 
 import (
 	"os"
+	"time"
 
 	"github.com/netapp/cake/pkg/cluster-engine/provisioner"
 	"github.com/netapp/cake/pkg/cmds"
+	"github.com/netapp/cake/pkg/config/types"
+	"github.com/netapp/cake/pkg/ipam"
+	"github.com/netapp/cake/pkg/platform/vsphere"
 )
 
 // NewMgmtCluster creates a new cluster interface with a full config from the client
@@ -12,38 +16,63 @@ func NewMgmtCluster(clusterConfig MgmtCluster) provisioner.Cluster {
 	mc := new(MgmtCluster)
 	mc = &clusterConfig
 	mc.events = make(chan interface{})
+	mc.deployedAt = time.Now()
 	if mc.LogFile != "" {
 		cmds.FileLogLocation = mc.LogFile
 		os.Truncate(mc.LogFile, 0)
 	}
+	// commands installed by --install-tools are found before the ones in the PATH
+	if dir, err := BinDir(); err == nil {
+		cmds.PrependPath(dir)
+	}
 
 	return mc
 }
 
 // MgmtCluster spec for CAPV
 type MgmtCluster struct {
+	// APIVersion is the config version, ConfigV1alpha2, and Kind is ConfigKind
+	APIVersion              string `yaml:"apiVersion" jsonschema:"enum=cake.netapp.io/v1alpha2"`
+	Kind                    string `yaml:"kind" jsonschema:"enum=Config"`
 	provisioner.MgmtCluster `yaml:",inline" mapstructure:",squash"`
 	Vsphere                 `yaml:",inline" mapstructure:",squash"`
-	Addons                  Addons `yaml:"Addons"`
-	events                  chan interface{}
+	Addons                  Addons                       `yaml:"Addons"`
+	Sizes                   map[string]types.MachineSize `yaml:"Sizes"`
+	Components              types.ComponentSpec          `yaml:"Components"`
+	NodePools               []NodePool                   `yaml:"NodePools"`
+	Bootstrap               Bootstrap                    `yaml:"Bootstrap"`
+	IPAM                    types.IPAMConfig             `yaml:"IPAM"`
+	Bintray                 types.BintraySpec            `yaml:"Bintray"`
+	// Catalog is a file of Kubernetes releases that override the default catalog's, ~/.cluster-engine/catalog.yaml by default
+	Catalog    string `yaml:"Catalog"`
+	events     chan interface{}
+	deployedAt time.Time
+	// bootstrapResources are the namespaces and CRDs in an existing bootstrap cluster before CAPv is installed
+	bootstrapResources map[string][]string
+	// loadBalancerAddress is the load balancer's reserved address with static addresses, it's set when the spec is written
+	loadBalancerAddress *ipam.Address
 }
 
 type Vsphere struct {
-	Datacenter        string `yaml:"Datacenter"`
-	Datastore         string `yaml:"Datastore"`
+	Datacenter        string `yaml:"Datacenter" jsonschema:"required"`
+	Datastore         string `yaml:"Datastore" jsonschema:"required"`
 	Folder            string `yaml:"Folder"`
-	ManagementNetwork string `yaml:"ManagementNetwork"`
+	ManagementNetwork string `yaml:"ManagementNetwork" jsonschema:"required"`
 	WorkloadNetwork   string `yaml:"WorkloadNetwork"`
 	StorageNetwork    string `yaml:"StorageNetwork"`
 	ResourcePool      string `yaml:"ResourcePool"`
-	VcenterServer     string `yaml:"VcenterServer"`
-	VsphereUsername   string `yaml:"VsphereUsername"`
+	VcenterServer     string `yaml:"VcenterServer" jsonschema:"required"`
+	VsphereUsername   string `yaml:"VsphereUsername" jsonschema:"required"`
 	VspherePassword   string `yaml:"VspherePassword"`
+
+	// ResourcePoolAllocation is applied when the resource pool has to be created
+	ResourcePoolAllocation vsphere.ResourceAllocation `yaml:"ResourcePoolAllocation"`
 }
 
 type Addons struct {
 	Solidfire     Solidfire     `yaml:"Solidfire"`
 	Observability Observability `yaml:"Observability"`
+	Rancher       Rancher       `yaml:"Rancher"`
 }
 
 type Solidfire struct {
@@ -55,12 +84,99 @@ type Solidfire struct {
 }
 
 type Observability struct {
-	Enable          bool   `yaml:"Enabled"`
+	Enable          bool   `yaml:"Enable"`
 	ArchiveLocation string `yaml:"ArchiveLocation"`
 }
 
+// Rancher installs Rancher server on the management cluster, the Hostname must resolve to the cluster's nodes
+type Rancher struct {
+	Enable   bool   `yaml:"Enable"`
+	Hostname string `yaml:"Hostname"`
+	// TLSSource is "rancher" for a self-signed certificate (the default), "secret" for the
+	// provided TLSCert and TLSKey, or "privateCA" for a provided certificate signed by CACert
+	TLSSource string `yaml:"TLSSource" jsonschema:"enum=,enum=rancher,enum=secret,enum=privateCA"`
+	TLSCert   string `yaml:"TLSCert"`
+	TLSKey    string `yaml:"TLSKey"`
+	CACert    string `yaml:"CACert"`
+	// BootstrapPassword is set for the admin user, a random one is generated when empty
+	BootstrapPassword string `yaml:"BootstrapPassword"`
+	Version           string `yaml:"Version"`
+}
+
+// NodePool is a MachineDeployment of workers with its own size, node template and networks.
+// When no NodePools are set the workers are a single "md-0" pool of WorkerMachineCount machines.
+type NodePool struct {
+	Name     string `yaml:"Name"`
+	Replicas int    `yaml:"Replicas"`
+	// Size is a machine size profile, WorkerSize is used when empty
+	Size string `yaml:"Size"`
+	// Template is the node template to clone, NodeTemplate is used when empty
+	Template string `yaml:"Template"`
+	// Networks are attached to the nodes after the ManagementNetwork
+	Networks []string          `yaml:"Networks"`
+	Labels   map[string]string `yaml:"Labels"`
+	Taints   []Taint           `yaml:"Taints"`
+	// Storage nodes get a NIC on the StorageNetwork and the iSCSI tools Trident needs
+	Storage bool `yaml:"Storage"`
+}
+
+// Bootstrap configures the temporary kind cluster CAPv is installed in before it's moved to the
+// permanent management cluster. The cluster is named "<ClusterName>-bootstrap".
+type Bootstrap struct {
+	// Kubeconfig of an existing cluster to use instead of kind, only the namespaces
+	// and CRDs installed in it are deleted after the pivot
+	Kubeconfig string `yaml:"Kubeconfig"`
+	// HelperVM runs the bootstrap cluster in a VM cloned in vSphere instead of kind
+	HelperVM HelperVM `yaml:"HelperVM"`
+	// NodeImage is the kind node image, kind's default is used when empty
+	NodeImage       string           `yaml:"NodeImage"`
+	RegistryMirrors []RegistryMirror `yaml:"RegistryMirrors"`
+	HTTPProxy       string           `yaml:"HTTPProxy"`
+	HTTPSProxy      string           `yaml:"HTTPSProxy"`
+	NoProxy         string           `yaml:"NoProxy"`
+	ExtraMounts     []Mount          `yaml:"ExtraMounts"`
+	// Keep leaves the bootstrap cluster running after the pivot, it's deleted by default
+	Keep bool `yaml:"Keep"`
+}
+
+// HelperVM is a VM cloned from a node template that installs a single node cluster when it boots,
+// it's named "<ClusterName>-bootstrap" and deleted after the pivot unless the bootstrap cluster is kept
+type HelperVM struct {
+	Enable bool `yaml:"Enable"`
+	// Distribution is "kubeadm" (the default) for templates with kubeadm installed, like the CAPV node templates, or "k3s"
+	Distribution string `yaml:"Distribution" jsonschema:"enum=,enum=kubeadm,enum=k3s"`
+	// Template is the node template to clone, NodeTemplate is used when empty
+	Template string `yaml:"Template"`
+	// Size is a machine size profile, the template's hardware is kept when empty
+	Size string `yaml:"Size"`
+	// Version is the k3s release to install, the latest stable release when empty
+	Version string `yaml:"Version"`
+}
+
+// RegistryMirror is the endpoint containerd pulls a registry's images from, Registry is like "docker.io"
+type RegistryMirror struct {
+	Registry string `yaml:"Registry"`
+	Endpoint string `yaml:"Endpoint"`
+}
+
+// Mount is a host path mounted into the bootstrap cluster's node
+type Mount struct {
+	HostPath      string `yaml:"HostPath"`
+	ContainerPath string `yaml:"ContainerPath"`
+	ReadOnly      bool   `yaml:"ReadOnly"`
+}
+
+// Taint is set on a node pool's nodes, Effect is NoSchedule, PreferNoSchedule or NoExecute
+type Taint struct {
+	Key    string `yaml:"Key"`
+	Value  string `yaml:"Value"`
+	Effect string `yaml:"Effect" jsonschema:"enum=NoSchedule,enum=PreferNoSchedule,enum=NoExecute"`
+}
+
 // Event spec
 type Event struct {
 	EventType string
 	Event     string
+	// Outputs are values for the user, like URLs and credentials, sent with "output" events
+	Outputs map[string]string
 }
@@ -0,0 +1,132 @@
+package capv
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/netapp/cake/pkg/artifacts"
+	"github.com/netapp/cake/pkg/config/types"
+)
+
+const (
+	// catalogFile in the config directory overrides releases of the default catalog
+	catalogFile = "catalog.yaml"
+	// cacheDir in the config directory keeps the verified OVAs, charts and tools downloaded by cake
+	cacheDir = "cache"
+)
+
+// CatalogFile returns the local catalog file, the file in the config or ~/.cluster-engine/catalog.yaml
+func CatalogFile(file string) (string, error) {
+	if file != "" {
+		return file, nil
+	}
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(home, ConfigDir, catalogFile), nil
+}
+
+// catalog returns the default catalog with the local catalog file's releases
+func (m *MgmtCluster) catalog() (types.Catalog, error) {
+	file, err := CatalogFile(m.Catalog)
+	if err != nil {
+		return types.Catalog{}, err
+	}
+	return types.LoadCatalog(file)
+}
+
+// resolveTemplates defaults the node and load balancer templates to the catalog's templates for the Kubernetes
+// version and checks the node templates are for that version. It returns the version's release, which is empty
+// when the catalog doesn't have the version.
+func (m *MgmtCluster) resolveTemplates() (types.KubernetesRelease, error) {
+	catalog, err := m.catalog()
+	if err != nil {
+		return types.KubernetesRelease{}, err
+	}
+	release, ok := catalog.Lookup(m.KubernetesVersion)
+	if m.NodeTemplate == "" {
+		if !ok {
+			return release, fmt.Errorf("Kubernetes version %s is not in the catalog, a NodeTemplate must be set, the catalog has %s",
+				m.KubernetesVersion, strings.Join(catalog.Versions(), ", "))
+		}
+		m.NodeTemplate = release.NodeTemplate
+	}
+	if m.LoadBalancerTemplate == "" {
+		m.LoadBalancerTemplate = release.LoadBalancerTemplate
+	}
+
+	templates := []string{m.NodeTemplate}
+	for _, pool := range m.NodePools {
+		templates = append(templates, pool.Template)
+	}
+	if h := m.Bootstrap.HelperVM; h.Enable && h.Distribution != k3sDistribution {
+		templates = append(templates, h.Template)
+	}
+	for _, t := range templates {
+		if t == "" {
+			continue
+		}
+		if err = catalog.CheckTemplate(t, m.KubernetesVersion); err != nil {
+			return release, err
+		}
+	}
+	return release, nil
+}
+
+// ensureTemplates resolves the node and load balancer templates and imports the catalog's OVAs for the ones
+// missing in vSphere. Templates that aren't the catalog's must already exist.
+func (m *MgmtCluster) ensureTemplates() error {
+	release, err := m.resolveTemplates()
+	if err != nil {
+		return err
+	}
+
+	m.events <- Event{EventType: "progress", Event: "checking node template " + m.NodeTemplate}
+	ova, checksum := "", ""
+	if m.NodeTemplate == release.NodeTemplate {
+		ova, checksum = release.OVA, release.Checksum
+	}
+	err = m.ensureNodeTemplate(m.NodeTemplate, ova, checksum)
+	if err != nil {
+		return err
+	}
+	if m.LoadBalancerTemplate == "" {
+		return nil
+	}
+
+	m.events <- Event{EventType: "progress", Event: "checking load balancer template " + m.LoadBalancerTemplate}
+	ova, checksum = "", ""
+	if m.LoadBalancerTemplate == release.LoadBalancerTemplate {
+		ova, checksum = release.LoadBalancerOVA, release.LoadBalancerChecksum
+	}
+	return m.ensureNodeTemplate(m.LoadBalancerTemplate, ova, checksum)
+}
+
+// fetcher returns a fetcher of the configured artifact repository that caches downloads in ~/.cluster-engine/cache/
+func (m *MgmtCluster) fetcher() (*artifacts.Fetcher, error) {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return nil, err
+	}
+	f := artifacts.NewFetcher(m.Bintray, filepath.Join(home, ConfigDir, cacheDir))
+	f.Progress = func(event string) {
+		m.events <- Event{EventType: "progress", Event: event}
+	}
+	return f, nil
+}
+
+// verifiedOVA returns the path of the OVA once its checksum is verified. Remote OVAs, and OVAs that are paths in the
+// artifact repository, are downloaded to the cache first. Without a checksum a URL or local OVA is returned as is.
+func (m *MgmtCluster) verifiedOVA(ova, checksum string) (string, error) {
+	if _, err := os.Stat(ova); checksum == "" && (err == nil || artifacts.IsURL(ova)) {
+		return ova, nil
+	}
+	f, err := m.fetcher()
+	if err != nil {
+		return "", err
+	}
+	return f.Fetch(artifacts.Artifact{Location: ova, Checksum: checksum})
+}
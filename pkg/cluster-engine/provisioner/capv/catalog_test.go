@@ -0,0 +1,96 @@
+package capv
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestResolveTemplates(t *testing.T) {
+	m := testCluster()
+	m.Catalog = filepath.Join("testdata", "missing-catalog.yaml")
+	m.NodeTemplate = ""
+	m.LoadBalancerTemplate = ""
+	release, err := m.resolveTemplates()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if m.NodeTemplate != "ubuntu-1804-kube-v1.17.3" || m.LoadBalancerTemplate != release.LoadBalancerTemplate || release.OVA == "" {
+		t.Errorf("got node template %s and load balancer template %s from release %+v", m.NodeTemplate, m.LoadBalancerTemplate, release)
+	}
+
+	m.NodePools = []NodePool{{Name: "gpu", Template: "ubuntu-1804-kube-v1.16.8"}}
+	if _, err = m.resolveTemplates(); err == nil {
+		t.Error("expected an error for a node pool template of another version")
+	}
+
+	m = testCluster()
+	m.Catalog = filepath.Join("testdata", "missing-catalog.yaml")
+	m.KubernetesVersion = "v1.18.0"
+	m.NodeTemplate = ""
+	if _, err = m.resolveTemplates(); err == nil {
+		t.Error("expected an error for a version that isn't in the catalog without a node template")
+	}
+	m.NodeTemplate = "custom-kube-v1.18.0"
+	if _, err = m.resolveTemplates(); err != nil {
+		t.Errorf("got an error for a custom node template, %v", err)
+	}
+}
+
+func TestVerifiedOVA(t *testing.T) {
+	ova := []byte("not really an ova")
+	sum := sha256.Sum256(ova)
+	checksum := hex.EncodeToString(sum[:])
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/node.ova":
+			w.Write(ova)
+		case "/node.ova.sha256":
+			w.Write([]byte(checksum + "  node.ova\n"))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer s.Close()
+
+	home, err := ioutil.TempDir("", "verified_ova_test_")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(home)
+	defer os.Setenv("HOME", os.Getenv("HOME"))
+	os.Setenv("HOME", home)
+
+	m := testCluster()
+	m.events = make(chan interface{}, 10)
+	local, err := m.verifiedOVA(s.URL+"/node.ova", s.URL+"/node.ova.sha256")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if local != filepath.Join(home, ConfigDir, cacheDir, strings.Replace(s.Listener.Addr().String(), ":", "_", 1), "node.ova") {
+		t.Errorf("got OVA path %s", local)
+	}
+	if got, _ := ioutil.ReadFile(local); string(got) != string(ova) {
+		t.Errorf("got OVA contents %q", got)
+	}
+
+	if _, err = m.verifiedOVA(local, checksum); err != nil {
+		t.Errorf("got an error verifying the downloaded OVA, %v", err)
+	}
+	ioutil.WriteFile(local, []byte("corrupted"), 0644)
+	if _, err = m.verifiedOVA(local, checksum); err == nil {
+		t.Error("expected a checksum mismatch")
+	}
+	if _, err = m.verifiedOVA(s.URL+"/node.ova", "not-a-checksum"); err == nil {
+		t.Error("expected an error for an invalid checksum")
+	}
+	if got, err := m.verifiedOVA(s.URL+"/node.ova", ""); err != nil || got != s.URL+"/node.ova" {
+		t.Errorf("got %s, %v without a checksum", got, err)
+	}
+}
@@ -0,0 +1,225 @@
+package capv
+
+import (
+	"fmt"
+	"net"
+	"net/url"
+	"path"
+	"strconv"
+	"strings"
+
+	"github.com/netapp/cake/pkg/config/schema"
+	"github.com/netapp/cake/pkg/config/types"
+
+	"k8s.io/apimachinery/pkg/util/version"
+	"sigs.k8s.io/yaml"
+)
+
+const (
+	// ConfigKind is the kind of every version of the config file
+	ConfigKind = "Config"
+	// ConfigV1alpha1 is the types.ConfigSpec config, it's converted to the current version when it's read
+	ConfigV1alpha1 = "cake.netapp.io/v1alpha1"
+	// ConfigV1alpha2 is the current config version, MgmtCluster
+	ConfigV1alpha2 = "cake.netapp.io/v1alpha2"
+
+	defaultControlPlaneMachineCount = "1"
+	defaultWorkerMachineCount       = "2"
+)
+
+// DecodeV1alpha1 reads a v1alpha1 config and converts it to the current version
+func DecodeV1alpha1(data []byte) (MgmtCluster, error) {
+	var spec types.ConfigSpec
+	err := yaml.UnmarshalStrict(data, &spec)
+	if err != nil {
+		return MgmtCluster{}, fmt.Errorf("invalid %s config, %v", ConfigV1alpha1, err)
+	}
+	return ConvertV1alpha1(spec)
+}
+
+// ConvertV1alpha1 converts a v1alpha1 config to the current version. The v1alpha1 IDs of the datacenter,
+// datastore and resource pool are used as their names, the network names are used over their IDs, and the
+// proxy becomes the bootstrap cluster's HTTP and HTTPS proxy. The NKS registration settings have no equivalent.
+func ConvertV1alpha1(spec types.ConfigSpec) (MgmtCluster, error) {
+	if spec.Provider != "" && !strings.EqualFold(spec.Provider, "capv") && !strings.EqualFold(spec.Provider, "vsphere") {
+		return MgmtCluster{}, fmt.Errorf("unsupported provider %q, only capv is supported", spec.Provider)
+	}
+	opt := spec.OptionalConfiguration
+	m := MgmtCluster{}
+	m.APIVersion = ConfigV1alpha2
+	m.Kind = ConfigKind
+
+	m.VcenterServer = spec.VCenterURL
+	m.VsphereUsername = spec.VCenterUser
+	m.VspherePassword = spec.VCenterPassword
+	m.Datacenter = spec.DatacenterID
+	m.Datastore = spec.DatastoreID
+	m.ResourcePool = spec.ResourcePoolID
+	m.ManagementNetwork = firstOf(spec.ManagementNetworkName, spec.ManagementNetworkID)
+	m.WorkloadNetwork = firstOf(spec.WorkloadNetworkName, spec.WorkloadNetworkID)
+	m.StorageNetwork = firstOf(spec.StorageNetworkName, spec.StorageNetworkID)
+
+	m.ClusterName = opt.Cluster.Name
+	m.KubernetesVersion = opt.Cluster.KubernetesVersion
+	m.KubernetesPodCidr = opt.Cluster.KubernetesPodCidr
+	m.KubernetesServiceCidr = opt.Cluster.KubernetesServiceCidr
+	if opt.Cluster.MasterCount != 0 {
+		m.ControlPlaneMachineCount = strconv.Itoa(opt.Cluster.MasterCount)
+	}
+	if opt.Cluster.WorkerCount != 0 {
+		m.WorkerMachineCount = strconv.Itoa(opt.Cluster.WorkerCount)
+	}
+	m.ControlPlaneSize = opt.Cluster.MasterSize
+	m.WorkerSize = opt.Cluster.WorkerSize
+	m.Sizes = opt.Sizes
+
+	m.NodeTemplate = opt.OVA.NodeTemplate
+	m.LoadBalancerTemplate = opt.OVA.LoadbalancerTemplate
+	m.Components = opt.Components
+	m.Bintray = opt.Bintray
+	m.IPAM = spec.IPAM
+	m.Bootstrap.Keep = opt.DisableCleanup
+
+	m.Addons.Solidfire = Solidfire(spec.Solidfire)
+	m.Addons.Observability = Observability{Enable: opt.Observability.Enabled, ArchiveLocation: opt.Observability.ArchiveLocation}
+
+	if p := spec.ProxySettings; p.Enable {
+		proxy := url.URL{Scheme: "http", Host: net.JoinHostPort(p.HostIp, strconv.Itoa(p.Port))}
+		if p.Username != "" {
+			proxy.User = url.UserPassword(p.Username, p.Password)
+		}
+		m.Bootstrap.HTTPProxy = proxy.String()
+		m.Bootstrap.HTTPSProxy = proxy.String()
+	}
+	return m, nil
+}
+
+// firstOf returns the first value that isn't empty
+func firstOf(values ...string) string {
+	for _, v := range values {
+		if v != "" {
+			return v
+		}
+	}
+	return ""
+}
+
+// SetDefaults fills in the settings the config leaves empty
+func (m *MgmtCluster) SetDefaults() {
+	if m.APIVersion == "" {
+		m.APIVersion = ConfigV1alpha2
+	}
+	if m.Kind == "" {
+		m.Kind = ConfigKind
+	}
+	if m.ControlPlaneMachineCount == "" {
+		m.ControlPlaneMachineCount = defaultControlPlaneMachineCount
+	}
+	if m.WorkerMachineCount == "" && len(m.NodePools) == 0 {
+		m.WorkerMachineCount = defaultWorkerMachineCount
+	}
+	if m.KubernetesPodCidr == "" {
+		m.KubernetesPodCidr = defaultPodCidr
+	}
+	if m.Folder == "" {
+		m.Folder = path.Join(vsphereBaseFolder, vsphereWorkloadFolder)
+	}
+	if m.IPAM.Provider == "" {
+		m.IPAM.Provider = types.DHCP
+	}
+}
+
+// Validate checks the config, it returns every problem found
+func (m *MgmtCluster) Validate() error {
+	var problems []string
+	add := func(format string, a ...interface{}) {
+		problems = append(problems, fmt.Sprintf(format, a...))
+	}
+
+	if m.APIVersion != ConfigV1alpha2 || m.Kind != ConfigKind {
+		add("apiVersion %q and kind %q must be %s and %s", m.APIVersion, m.Kind, ConfigV1alpha2, ConfigKind)
+	}
+	required := []struct{ name, value string }{
+		{"ClusterName", m.ClusterName},
+		{"VcenterServer", m.VcenterServer},
+		{"VsphereUsername", m.VsphereUsername},
+		{"Datacenter", m.Datacenter},
+		{"Datastore", m.Datastore},
+		{"ManagementNetwork", m.ManagementNetwork},
+	}
+	for _, field := range required {
+		if field.value == "" {
+			add("%s is required", field.name)
+		}
+	}
+	if m.ClusterName != "" && !nodePoolNameFormat.MatchString(m.ClusterName) {
+		add("invalid ClusterName %q, it must be lowercase alphanumeric or '-'", m.ClusterName)
+	}
+	if _, err := version.ParseSemantic(m.KubernetesVersion); err != nil || !strings.HasPrefix(m.KubernetesVersion, "v") {
+		add("invalid KubernetesVersion %q, it must be like v1.17.3", m.KubernetesVersion)
+	}
+	if n, err := strconv.Atoi(m.ControlPlaneMachineCount); err != nil || n < 1 || n%2 == 0 {
+		add("invalid ControlPlaneMachineCount %q, it must be an odd number", m.ControlPlaneMachineCount)
+	}
+	for _, cidr := range []string{m.KubernetesPodCidr, m.KubernetesServiceCidr} {
+		if _, _, err := net.ParseCIDR(cidr); cidr != "" && err != nil {
+			add("invalid CIDR %q", cidr)
+		}
+	}
+
+	pools, err := m.nodePools()
+	if err != nil {
+		add("%v", err)
+	} else if _, _, err = m.machineSizes(pools); err != nil {
+		add("%v", err)
+	}
+
+	if m.Bootstrap.Kubeconfig != "" && m.Bootstrap.HelperVM.Enable {
+		add("the bootstrap cluster can be an existing cluster or a helper VM, not both")
+	}
+	if _, err = m.Bootstrap.HelperVM.distribution(); err != nil {
+		add("%v", err)
+	}
+	for _, mount := range m.Bootstrap.ExtraMounts {
+		if mount.HostPath == "" || mount.ContainerPath == "" {
+			add("bootstrap ExtraMounts need a HostPath and ContainerPath")
+		}
+	}
+
+	if m.Addons.Observability.Enable {
+		add("the Observability addon is not supported yet")
+	}
+	if m.Addons.Solidfire.Enable && m.StorageNetwork == "" {
+		add("the Solidfire addon requires a StorageNetwork")
+	}
+	if r := m.Addons.Rancher; r.Enable {
+		if err = r.validate(); err != nil {
+			add("%v", err)
+		}
+	}
+
+	switch m.IPAM.Provider {
+	case types.DHCP:
+	case types.MNodeIPService, types.Infoblox:
+		// addresses are only assigned while cake runs, machines created later, like remediated ones, would never get one
+		add("IPAM Provider %s is not supported yet, use %s", m.IPAM.Provider, types.DHCP)
+	default:
+		add("unknown IPAM Provider %q, must be one of %s, %s or %s", m.IPAM.Provider, types.DHCP, types.MNodeIPService, types.Infoblox)
+	}
+
+	if len(problems) > 0 {
+		return fmt.Errorf("invalid config: %s", strings.Join(problems, "; "))
+	}
+	return nil
+}
+
+// ConfigSchema returns the JSON Schema of a config version
+func ConfigSchema(apiVersion string) ([]byte, error) {
+	switch apiVersion {
+	case ConfigV1alpha1:
+		return schema.Marshal("cake config "+ConfigV1alpha1, types.ConfigSpec{})
+	case ConfigV1alpha2:
+		return schema.Marshal("cake config "+ConfigV1alpha2, MgmtCluster{})
+	}
+	return nil, fmt.Errorf("unknown config apiVersion %q, must be %s or %s", apiVersion, ConfigV1alpha1, ConfigV1alpha2)
+}
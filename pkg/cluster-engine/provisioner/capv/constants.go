@@ -6,4 +6,5 @@ const (
 	vsphereBaseFolder     = "nks"
 	bootstrapKubeconfig   = "bootstrap.kubeconfig"
 	appName               = ".cluster-engine"
+	calicoManifest        = "https://docs.projectcalico.org/v3.12/manifests/calico.yaml"
 )
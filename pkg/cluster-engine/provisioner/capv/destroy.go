@@ -0,0 +1,58 @@
+package capv
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// Destroy deletes every vSphere object owned by the cluster and the cluster's local files. While the management
+// cluster is up its machines are tagged first, the ones created by remediation aren't tagged yet.
+func (m *MgmtCluster) Destroy() error {
+	if kubeConfig, err := m.managementKubeconfig(); err == nil {
+		err = m.tagMachines(kubeConfig, m.ClusterName)
+		if err != nil {
+			log.Warnf("unable to tag the virtual machines of %s, only the tagged ones are deleted, %v", m.ClusterName, err)
+		}
+	}
+	return m.destroyOwned()
+}
+
+// destroyOwned deletes the vSphere objects tagged as owned by the cluster and the cluster's local files
+func (m *MgmtCluster) destroyOwned() error {
+	var err error
+
+	m.events <- Event{EventType: "progress", Event: "deleting vSphere objects owned by " + m.ClusterName}
+	ctx := context.Background()
+	r, err := m.vsphereResource(ctx)
+	if err != nil {
+		return err
+	}
+	defer r.SessionManager.Close()
+
+	controlPlaneRule, loadBalancerRule := m.antiAffinityRuleNames()
+	err = r.DeleteRules(ctx, controlPlaneRule, loadBalancerRule)
+	if err != nil {
+		return err
+	}
+
+	err = r.DeleteOwned(ctx, m.ClusterName)
+	if err != nil {
+		return err
+	}
+	for _, owner := range []string{m.ClusterName, m.bootstrapClusterName()} {
+		err = m.releaseAddresses(owner)
+		if err != nil {
+			return err
+		}
+	}
+
+	m.events <- Event{EventType: "progress", Event: "removing local cluster files"}
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return err
+	}
+	return os.RemoveAll(filepath.Join(home, ConfigDir, m.ClusterName))
+}
@@ -5,10 +5,13 @@ import (
 	"compress/gzip"
 	"io"
 	"io/ioutil"
-	"net/http"
 	"os"
+	"path"
 	"path/filepath"
 	"strings"
+	"time"
+
+	"github.com/netapp/cake/pkg/artifacts"
 )
 
 type fileOnDisk struct {
@@ -81,69 +84,6 @@ parameters:
 	}
 ]
 }`,
-	}
-	KustomizationFile = fileOnDisk{
-		Name: "kustomization.yaml",
-		Contents: `apiVersion: kustomize.config.k8s.io/v1beta1
-kind: Kustomization
-resources:
-- %[1]s-base.yaml
-patchesJson6902:
-- target:
-    group: infrastructure.cluster.x-k8s.io
-    version: v1alpha3
-    kind: VSphereMachineTemplate
-    name: %[1]s
-  path: patch1.yaml
-- target:
-    group: controlplane.cluster.x-k8s.io
-    version: v1alpha3
-    kind: KubeadmControlPlane
-    name: %[1]s
-  path: patch2.yaml
-- target:
-    group: bootstrap.cluster.x-k8s.io
-    version: v1alpha3
-    kind: KubeadmConfigTemplate
-    name: %[2]s
-  path: patch3.yaml
-`,
-	}
-	PatchFileOne = fileOnDisk{
-		Name: "patch1.yaml",
-		Contents: `- op: add
-  path: /spec/template/spec/network/devices/-
-  value:
-    dhcp4: true
-    networkName: %s`,
-	}
-	PatchFileTwo = fileOnDisk{
-		Name: "patch2.yaml",
-		Contents: `- op: add
-  path: /spec/kubeadmConfigSpec/postKubeadmCommands
-  value:
-    - apt-get update
-    - apt-get install -y open-iscsi lsscsi sg3-utils multipath-tools scsitools
-    - echo "defaults {\n    user_friendly_names yes\n    find_multipaths yes\n}" > /etc/multipath.conf
-    - systemctl enable multipath-tools.service
-    - service multipath-tools restart
-    - systemctl enable open-iscsi.service
-    - service open-iscsi start
-`,
-	}
-	PatchFileThree = fileOnDisk{
-		Name: "patch3.yaml",
-		Contents: `- op: add
-  path: /spec/template/spec/postKubeadmCommands
-  value:
-    - apt-get update
-    - apt-get install -y open-iscsi lsscsi sg3-utils multipath-tools scsitools
-    - echo "defaults {\n    user_friendly_names yes\n    find_multipaths yes\n}" > /etc/multipath.conf
-    - systemctl enable multipath-tools.service
-    - service multipath-tools restart
-    - systemctl enable open-iscsi.service
-    - service open-iscsi start
-`,
 	}
 	VsphereCredsSecret = fileOnDisk{
 		Name: "vsphere-creds.yaml",
@@ -164,6 +104,24 @@ stringData:
   username: "%s"
   password: '%s'`,
 	}
+	// rancherNamespaces are created before installing Rancher so its TLS secrets can be added first
+	rancherNamespaces = fileOnDisk{
+		Name: "rancher-namespaces.yaml",
+		Contents: `apiVersion: v1
+kind: Namespace
+metadata:
+  name: cert-manager
+---
+apiVersion: v1
+kind: Namespace
+metadata:
+  name: ingress-nginx
+---
+apiVersion: v1
+kind: Namespace
+metadata:
+  name: cattle-system`,
+	}
 )
 
 // writeToDisk writes the files to the hidden dir in the home directory
@@ -181,24 +139,53 @@ func writeToDisk(dirname string, fileName string, specFile []byte, perms os.File
 	return err
 }
 
-func downloadFile(URL, fileName string, fileLocation string) error {
-	response, err := http.Get(URL)
-	if err != nil {
-	}
-	defer response.Body.Close()
+// tarFile is a file written to an archive by writeTar
+type tarFile struct {
+	Name     string
+	Contents []byte
+}
 
-	fpath := filepath.Join(fileLocation, fileName)
-	file, err := os.Create(fpath)
-	if err != nil {
-		return err
+// writeTar writes the files to a gzipped tar archive, the reverse of extractTar.
+// Directory entries are added for the files' parents so extractTar can create them.
+func writeTar(w io.Writer, files []tarFile, modTime time.Time) error {
+	gzw := gzip.NewWriter(w)
+	tw := tar.NewWriter(gzw)
+	dirs := map[string]bool{}
+	for _, f := range files {
+		var parents []string
+		for dir := path.Dir(f.Name); dir != "." && dir != "/" && !dirs[dir]; dir = path.Dir(dir) {
+			parents = append([]string{dir}, parents...)
+			dirs[dir] = true
+		}
+		for _, dir := range parents {
+			header := &tar.Header{
+				Name:     dir + "/",
+				Mode:     0755,
+				ModTime:  modTime,
+				Typeflag: tar.TypeDir,
+			}
+			if err := tw.WriteHeader(header); err != nil {
+				return err
+			}
+		}
+		header := &tar.Header{
+			Name:     f.Name,
+			Mode:     0644,
+			Size:     int64(len(f.Contents)),
+			ModTime:  modTime,
+			Typeflag: tar.TypeReg,
+		}
+		if err := tw.WriteHeader(header); err != nil {
+			return err
+		}
+		if _, err := tw.Write(f.Contents); err != nil {
+			return err
+		}
 	}
-	defer file.Close()
-
-	_, err = io.Copy(file, response.Body)
-	if err != nil {
+	if err := tw.Close(); err != nil {
 		return err
 	}
-	return nil
+	return gzw.Close()
 }
 
 func extractTar(dst string, r io.Reader) (string, error) {
@@ -268,29 +255,11 @@ func extractLocalArchive(archiveLocation, dir string) (string, error) {
 	return targetDir, err
 }
 
-func extractRemoteArchive(archiveLocation, dir string) (string, error) {
-	var err error
-	var targetDir string
-
-	if !strings.HasSuffix(dir, "/") {
-		dir = dir + "/"
-	}
-	loc, err := os.Stat(dir)
-	if err != nil || !loc.IsDir() {
-		return targetDir, err
-	}
-	err = downloadFile(archiveLocation, filepath.Base(archiveLocation), dir)
-	if err != nil {
-		return targetDir, err
-	}
-	archive, err := os.Open(dir + filepath.Base(archiveLocation))
-	if err != nil {
-		return targetDir, err
-	}
-	targetDir, err = extractTar(dir, archive)
+// extractRemoteArchive fetches the archive, verified when it has a checksum, and extracts it into dir
+func extractRemoteArchive(f *artifacts.Fetcher, a artifacts.Artifact, dir string) (string, error) {
+	archive, err := f.Fetch(a)
 	if err != nil {
-		return targetDir, err
+		return "", err
 	}
-
-	return targetDir, err
+	return extractLocalArchive(archive, dir)
 }
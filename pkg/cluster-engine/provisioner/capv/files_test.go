@@ -6,7 +6,10 @@ import (
 	"os"
 	"path/filepath"
 	"testing"
+	"time"
 
+	"github.com/netapp/cake/pkg/artifacts"
+	"github.com/netapp/cake/pkg/config/types"
 	log "github.com/sirupsen/logrus"
 )
 
@@ -42,10 +45,46 @@ func TestExtractRemoteArchive(t *testing.T) {
 	}
 	defer os.RemoveAll(dir)
 
-	targetDir, err := extractRemoteArchive(url, dir)
+	f := artifacts.NewFetcher(types.BintraySpec{}, filepath.Join(dir, "cache"))
+	targetDir, err := extractRemoteArchive(f, artifacts.Artifact{Location: url}, dir)
 	if err != nil {
 		t.Fatal(err.Error())
 	}
 	// TODO add some actual tests
 	fmt.Println(targetDir)
 }
+
+func TestWriteTar(t *testing.T) {
+	files := []tarFile{
+		{Name: "bundle/cake.log", Contents: []byte("log")},
+		{Name: "bundle/bootstrap/pods.txt", Contents: []byte("pods")},
+	}
+	archive, err := ioutil.TempFile("", "write_tar_test_")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(archive.Name())
+	err = writeTar(archive, files, time.Now())
+	archive.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	dir, err := ioutil.TempDir("", "write_tar_test_")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	if _, err = extractLocalArchive(archive.Name(), dir); err != nil {
+		t.Fatal(err)
+	}
+	for _, f := range files {
+		contents, err := ioutil.ReadFile(filepath.Join(dir, f.Name))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(contents) != string(f.Contents) {
+			t.Errorf("%s: got %q, want %q", f.Name, contents, f.Contents)
+		}
+	}
+}
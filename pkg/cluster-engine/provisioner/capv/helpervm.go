@@ -0,0 +1,333 @@
+package capv
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"text/template"
+	"time"
+
+	"github.com/netapp/cake/pkg/cmds"
+	"github.com/netapp/cake/pkg/config/types"
+	"github.com/netapp/cake/pkg/platform/vsphere"
+	log "github.com/sirupsen/logrus"
+	"github.com/vmware/govmomi/find"
+	"github.com/vmware/govmomi/object"
+
+	"golang.org/x/crypto/ssh"
+)
+
+const (
+	helperVMKeyFile     = "bootstrap-vm.key"
+	kubeadmDistribution = "kubeadm"
+	k3sDistribution     = "k3s"
+	helperVMTimeout     = 15 * time.Minute
+	apiServerPort       = "6443"
+)
+
+// helperVMKubeconfigs is where each distribution writes its admin kubeconfig on the helper VM
+var helperVMKubeconfigs = map[string]string{
+	kubeadmDistribution: "/etc/kubernetes/admin.conf",
+	k3sDistribution:     "/etc/rancher/k3s/k3s.yaml",
+}
+
+// kubeconfigServer matches the API server addresses in a kubeconfig
+var kubeconfigServer = regexp.MustCompile(`(?m)^(\s*server:\s*).*$`)
+
+// helperVMBootScripts install a single node cluster on the helper VM. The kubeadm one expects a node
+// template with kubeadm and the cluster's images on it, like the CAPV templates. The k3s one downloads k3s.
+var helperVMBootScripts = map[string]string{
+	kubeadmDistribution: `#!/bin/bash
+set -e
+kubeadm init --kubernetes-version={{.KubernetesVersion}} --pod-network-cidr={{.PodCidr}} --skip-token-print
+export KUBECONFIG=/etc/kubernetes/admin.conf
+kubectl taint nodes --all node-role.kubernetes.io/master-
+kubectl apply --filename={{.CNI}}
+`,
+	k3sDistribution: `#!/bin/bash
+set -e
+curl -sfL https://get.k3s.io | INSTALL_K3S_VERSION="{{.Version}}" sh -s - --write-kubeconfig-mode=600
+`,
+}
+
+// distribution returns the helper VM's Kubernetes distribution, kubeadm by default
+func (h HelperVM) distribution() (string, error) {
+	switch h.Distribution {
+	case "", kubeadmDistribution:
+		return kubeadmDistribution, nil
+	case k3sDistribution:
+		return k3sDistribution, nil
+	}
+	return "", fmt.Errorf("invalid helper VM distribution %q, must be %s or %s", h.Distribution, kubeadmDistribution, k3sDistribution)
+}
+
+// helperVMBootScript returns the boot script that installs the bootstrap cluster on the helper VM
+func (m *MgmtCluster) helperVMBootScript() (string, error) {
+	distribution, err := m.Bootstrap.HelperVM.distribution()
+	if err != nil {
+		return "", err
+	}
+	podCidr := m.KubernetesPodCidr
+	if podCidr == "" {
+		podCidr = defaultPodCidr
+	}
+	values := map[string]string{
+		"KubernetesVersion": m.KubernetesVersion,
+		"PodCidr":           podCidr,
+		"CNI":               calicoManifest,
+		"Version":           m.Bootstrap.HelperVM.Version,
+	}
+
+	t, err := template.New(distribution).Parse(helperVMBootScripts[distribution])
+	if err != nil {
+		return "", err
+	}
+	script := new(bytes.Buffer)
+	err = t.Execute(script, values)
+	if err != nil {
+		return "", fmt.Errorf("unable to template helper VM boot script, %v", err)
+	}
+	return script.String(), nil
+}
+
+// newSSHKey generates the key pair used to reach the helper VM, returning
+// the PEM encoded private key and the public key in authorized_keys format
+func newSSHKey() ([]byte, string, error) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		return nil, "", err
+	}
+	pub, err := ssh.NewPublicKey(&key.PublicKey)
+	if err != nil {
+		return nil, "", err
+	}
+	private := pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(key)})
+	return private, strings.TrimSpace(string(ssh.MarshalAuthorizedKey(pub))), nil
+}
+
+// sshOutput runs the command on the host and returns its stdout. The host key isn't
+// checked, the helper VM was just cloned so there's no known key to check it against.
+func sshOutput(host, user string, privateKey []byte, command string) ([]byte, error) {
+	signer, err := ssh.ParsePrivateKey(privateKey)
+	if err != nil {
+		return nil, err
+	}
+	config := &ssh.ClientConfig{
+		User:            user,
+		Auth:            []ssh.AuthMethod{ssh.PublicKeys(signer)},
+		HostKeyCallback: ssh.InsecureIgnoreHostKey(),
+		Timeout:         10 * time.Second,
+	}
+	client, err := ssh.Dial("tcp", net.JoinHostPort(host, "22"), config)
+	if err != nil {
+		return nil, err
+	}
+	defer client.Close()
+	session, err := client.NewSession()
+	if err != nil {
+		return nil, err
+	}
+	defer session.Close()
+
+	var stderr bytes.Buffer
+	session.Stderr = &stderr
+	out, err := session.Output(command)
+	if err != nil {
+		return nil, fmt.Errorf("err: %v, stderr: %v, cmd: %v", err, stderr.String(), command)
+	}
+	return out, nil
+}
+
+// setKubeconfigServer points the kubeconfig's clusters at the API server on the host
+func setKubeconfigServer(kubeconfig []byte, host string) []byte {
+	server := "https://" + net.JoinHostPort(host, apiServerPort)
+	return kubeconfigServer.ReplaceAll(kubeconfig, []byte("${1}"+server))
+}
+
+// findInfrastructure resolves the configured datastore, resource pool, folder and management network
+func (m *MgmtCluster) findInfrastructure(ctx context.Context, r *vsphere.Resource) error {
+	client, err := r.SessionManager.GetClientContext(ctx)
+	if err != nil {
+		return err
+	}
+	finder := find.NewFinder(client.Client, true)
+	finder.SetDatacenter(r.Datacenter)
+	if r.Datastore, err = finder.Datastore(ctx, m.Datastore); err != nil {
+		return fmt.Errorf("unable to find datastore %s, %v", m.Datastore, err)
+	}
+	if r.ResourcePool, err = finder.ResourcePoolOrDefault(ctx, m.ResourcePool); err != nil {
+		return fmt.Errorf("unable to find resource pool %s, %v", m.ResourcePool, err)
+	}
+	if r.Folder, err = finder.FolderOrDefault(ctx, m.Folder); err != nil {
+		return fmt.Errorf("unable to find folder %s, %v", m.Folder, err)
+	}
+	if r.Network, err = finder.Network(ctx, m.ManagementNetwork); err != nil {
+		return fmt.Errorf("unable to find network %s, %v", m.ManagementNetwork, err)
+	}
+	return nil
+}
+
+// createHelperVM clones the node template into a VM that installs a single node cluster when it boots,
+// then fetches the cluster's kubeconfig over SSH and writes it as the bootstrap kubeconfig
+func (m *MgmtCluster) createHelperVM() error {
+	h := m.Bootstrap.HelperVM
+	distribution, err := h.distribution()
+	if err != nil {
+		return err
+	}
+	bootScript, err := m.helperVMBootScript()
+	if err != nil {
+		return err
+	}
+	var size *types.MachineSize
+	if h.Size != "" {
+		s, err := types.LookupMachineSize(h.Size, m.Sizes)
+		if err != nil {
+			return fmt.Errorf("helper VM size: %v", err)
+		}
+		size = &s
+	}
+	privateKey, authorizedKey, err := newSSHKey()
+	if err != nil {
+		return fmt.Errorf("unable to generate helper VM SSH key, %v", err)
+	}
+	err = writeToDisk(m.ClusterName, helperVMKeyFile, privateKey, 0600)
+	if err != nil {
+		return err
+	}
+
+	m.events <- Event{EventType: "progress", Event: "creating vSphere folder and resource pool"}
+	err = m.ensureInventory()
+	if err != nil {
+		return err
+	}
+	err = m.ensureTemplates()
+	if err != nil {
+		return err
+	}
+	nodeTemplate := h.Template
+	if nodeTemplate == "" {
+		nodeTemplate = m.NodeTemplate
+	}
+
+	ctx := context.Background()
+	r, err := m.vsphereResource(ctx)
+	if err != nil {
+		return err
+	}
+	defer r.SessionManager.Close()
+	err = m.findInfrastructure(ctx, r)
+	if err != nil {
+		return err
+	}
+	t, err := r.SessionManager.GetVMContext(ctx, r.Datacenter, nodeTemplate)
+	if err != nil {
+		return fmt.Errorf("unable to find node template %s, %v", nodeTemplate, err)
+	}
+
+	name := m.bootstrapClusterName()
+	m.events <- Event{EventType: "progress", Event: fmt.Sprintf("cloning %s into bootstrap VM %s (%s)", nodeTemplate, name, distribution)}
+	networks, err := m.helperVMNetworks(ctx, r.Network)
+	if err != nil {
+		return err
+	}
+	vm, err := r.CloneTemplate(t, name, bootScript, authorizedKey, sshUser, networks, size)
+	if err == nil {
+		err = m.waitForHelperVM(ctx, vm, distribution, privateKey)
+	}
+	if err != nil {
+		if deleteErr := m.deleteHelperVM(); deleteErr != nil {
+			log.Warnf("unable to clean up bootstrap VM %s, %v", name, deleteErr)
+		}
+		return err
+	}
+	return nil
+}
+
+// waitForHelperVM fetches the kubeconfig of the helper VM's cluster over SSH and waits for its node to be ready
+func (m *MgmtCluster) waitForHelperVM(ctx context.Context, vm *object.VirtualMachine, distribution string, privateKey []byte) error {
+	name := m.bootstrapClusterName()
+	ipCtx, cancel := context.WithTimeout(ctx, helperVMTimeout)
+	defer cancel()
+	ip, err := vm.WaitForIP(ipCtx, true)
+	if err != nil {
+		return fmt.Errorf("bootstrap VM %s didn't get an IP address, %v", name, err)
+	}
+
+	m.events <- Event{EventType: "progress", Event: "waiting for the bootstrap cluster on " + ip}
+	var kubeConfig []byte
+	err = waitFor(helperVMTimeout, 15*time.Second, func() error {
+		kubeConfig, err = sshOutput(ip, sshUser, privateKey, "sudo cat "+helperVMKubeconfigs[distribution])
+		return err
+	})
+	if err != nil {
+		return fmt.Errorf("unable to fetch the bootstrap VM's kubeconfig, %v", err)
+	}
+	err = writeToDisk(m.ClusterName, bootstrapKubeconfig, setKubeconfigServer(kubeConfig, ip), 0644)
+	if err != nil {
+		return err
+	}
+
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return err
+	}
+	envs := map[string]string{
+		"KUBECONFIG": filepath.Join(home, ConfigDir, m.ClusterName, bootstrapKubeconfig),
+	}
+	return waitFor(helperVMTimeout, 15*time.Second, func() error {
+		args := []string{
+			"wait",
+			"nodes",
+			"--all",
+			"--for=condition=Ready",
+			"--timeout=30s",
+		}
+		return cmds.GenericExecute(envs, string(kubectl), args, nil)
+	})
+}
+
+// deleteHelperVM deletes the helper VM, its SSH key and the bootstrap kubeconfig
+func (m *MgmtCluster) deleteHelperVM() error {
+	name := m.bootstrapClusterName()
+	m.events <- Event{EventType: "progress", Event: "deleting bootstrap VM " + name}
+
+	ctx := context.Background()
+	r, err := m.vsphereResource(ctx)
+	if err != nil {
+		return err
+	}
+	defer r.SessionManager.Close()
+	vm, err := r.SessionManager.GetVMContext(ctx, r.Datacenter, name)
+	if err == nil {
+		err = vsphere.DeleteVM(vm)
+	}
+	if _, ok := err.(*find.NotFoundError); err != nil && !ok {
+		return fmt.Errorf("unable to delete bootstrap VM %s, %v", name, err)
+	}
+	err = m.releaseAddresses(name)
+	if err != nil {
+		return err
+	}
+
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return err
+	}
+	for _, file := range []string{helperVMKeyFile, bootstrapKubeconfig} {
+		err = os.Remove(filepath.Join(home, ConfigDir, m.ClusterName, file))
+		if err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+	return nil
+}
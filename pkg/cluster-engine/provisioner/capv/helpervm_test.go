@@ -0,0 +1,66 @@
+package capv
+
+import (
+	"strings"
+	"testing"
+
+	"golang.org/x/crypto/ssh"
+)
+
+func TestHelperVMBootScript(t *testing.T) {
+	m := testCluster()
+	script, err := m.helperVMBootScript()
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := "kubeadm init --kubernetes-version=" + m.KubernetesVersion + " --pod-network-cidr=" + defaultPodCidr + " "
+	if !strings.Contains(script, want) {
+		t.Errorf("expected %q in the kubeadm boot script\n%s", want, script)
+	}
+
+	m.Bootstrap.HelperVM = HelperVM{Distribution: k3sDistribution, Version: "v1.17.4+k3s1"}
+	script, err = m.helperVMBootScript()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(script, `INSTALL_K3S_VERSION="v1.17.4+k3s1"`) {
+		t.Errorf("expected the k3s version in the k3s boot script\n%s", script)
+	}
+
+	m.Bootstrap.HelperVM.Distribution = "microk8s"
+	if _, err = m.helperVMBootScript(); err == nil {
+		t.Error("expected an error for an unknown distribution")
+	}
+}
+
+func TestNewSSHKey(t *testing.T) {
+	private, authorized, err := newSSHKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	signer, err := ssh.ParsePrivateKey(private)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pub, _, _, _, err := ssh.ParseAuthorizedKey([]byte(authorized))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(pub.Marshal()) != string(signer.PublicKey().Marshal()) {
+		t.Error("authorized key doesn't match the private key")
+	}
+}
+
+func TestSetKubeconfigServer(t *testing.T) {
+	kubeconfig := `apiVersion: v1
+clusters:
+- cluster:
+    certificate-authority-data: ZGF0YQ==
+    server: https://127.0.0.1:6443
+  name: default
+`
+	want := strings.Replace(kubeconfig, "https://127.0.0.1:6443", "https://10.0.0.5:6443", 1)
+	if got := string(setKubeconfigServer([]byte(kubeconfig), "10.0.0.5")); got != want {
+		t.Errorf("got kubeconfig\n%s\nwant\n%s", got, want)
+	}
+}
@@ -18,12 +18,7 @@ func (m *MgmtCluster) InstallControlPlane() error {
 	}
 	secretSpecLocation := filepath.Join(home, ConfigDir, m.ClusterName, VsphereCredsSecret.Name)
 
-	secretSpecContents := fmt.Sprintf(
-		VsphereCredsSecret.Contents,
-		m.VsphereUsername,
-		m.VspherePassword,
-	)
-	err = writeToDisk(m.ClusterName, VsphereCredsSecret.Name, []byte(secretSpecContents), 0644)
+	err = writeToDisk(m.ClusterName, VsphereCredsSecret.Name, m.vsphereCredsSecret(), 0644)
 	if err != nil {
 		return err
 	}
@@ -43,25 +38,22 @@ func (m *MgmtCluster) InstallControlPlane() error {
 		return err
 	}
 
-	m.events <- Event{EventType: "progress", Event: "init capi in the bootstrap cluster"}
-	envs = map[string]string{
-		"VSPHERE_PASSWORD":           m.VspherePassword,
-		"VSPHERE_USERNAME":           m.VsphereUsername,
-		"VSPHERE_SERVER":             m.VcenterServer,
-		"VSPHERE_DATACENTER":         m.Datacenter,
-		"VSPHERE_DATASTORE":          m.Datastore,
-		"VSPHERE_NETWORK":            m.ManagementNetwork,
-		"VSPHERE_RESOURCE_POOL":      m.ResourcePool,
-		"VSPHERE_FOLDER":             m.Folder,
-		"VSPHERE_TEMPLATE":           m.NodeTemplate,
-		"VSPHERE_HAPROXY_TEMPLATE":   m.LoadBalancerTemplate,
-		"VSPHERE_SSH_AUTHORIZED_KEY": m.SSHAuthorizedKey,
-		"KUBECONFIG":                 kubeConfig,
-		"GITHUB_TOKEN":               "",
+	m.events <- Event{EventType: "progress", Event: "creating vSphere folder and resource pool"}
+	err = m.ensureInventory()
+	if err != nil {
+		return err
+	}
+	err = m.ensureTemplates()
+	if err != nil {
+		return err
 	}
-	args = []string{
-		"init",
-		"--infrastructure=vsphere",
+
+	m.events <- Event{EventType: "progress", Event: "init capi in the bootstrap cluster"}
+	envs = m.clusterctlEnvs(kubeConfig)
+	envs["GITHUB_TOKEN"] = ""
+	args, err = m.clusterctlInitArgs()
+	if err != nil {
+		return err
 	}
 
 	err = cmds.GenericExecute(envs, string(clusterctl), args, nil)
@@ -73,25 +65,46 @@ func (m *MgmtCluster) InstallControlPlane() error {
 	time.Sleep(30 * time.Second)
 
 	m.events <- Event{EventType: "progress", Event: "writing CAPv spec file out"}
-	args = []string{
-		"config",
-		"cluster",
-		m.ClusterName,
-		"--infrastructure=vsphere",
-		"--kubernetes-version=" + m.KubernetesVersion,
-		"--control-plane-machine-count=" + m.ControlPlaneMachineCount,
-		"--worker-machine-count=" + m.WorkerMachineCount,
+	err = m.writeSpec()
+	if err != nil {
+		return err
 	}
-	c := cmds.NewCommandLine(envs, string(clusterctl), args, nil)
-	stdout, stderr, err := c.Program().Execute()
-	if err != nil || string(stderr) != "" {
-		return fmt.Errorf("err: %v, stderr: %v, cmd: %v %v", err, string(stderr), c.CommandName, c.Args)
+	time.Sleep(5 * time.Second)
+	return err
+}
+
+// clusterctlEnvs returns the environment clusterctl needs to init the vSphere provider
+func (m *MgmtCluster) clusterctlEnvs(kubeConfig string) map[string]string {
+	return map[string]string{
+		"VSPHERE_PASSWORD": m.VspherePassword,
+		"VSPHERE_USERNAME": m.VsphereUsername,
+		"KUBECONFIG":       kubeConfig,
 	}
+}
 
-	err = writeToDisk(m.ClusterName, m.ClusterName+"-base"+".yaml", []byte(stdout), 0644)
+// writeSpec generates the cluster's spec, with the load balancer's reserved address, and writes it to <cluster>-base.yaml
+func (m *MgmtCluster) writeSpec() error {
+	err := m.reserveLoadBalancerAddress()
 	if err != nil {
 		return err
 	}
-	time.Sleep(5 * time.Second)
-	return err
+	spec, err := m.clusterSpec()
+	if err != nil {
+		return err
+	}
+	return writeToDisk(m.ClusterName, specFileName(m.ClusterName), spec, 0644)
+}
+
+// specFileName is the name of the cluster's spec file
+func specFileName(clusterName string) string {
+	return clusterName + "-base.yaml"
+}
+
+// vsphereCredsSecret returns the secret CAPV reads its vCenter credentials from
+func (m *MgmtCluster) vsphereCredsSecret() []byte {
+	return []byte(fmt.Sprintf(
+		VsphereCredsSecret.Contents,
+		m.VsphereUsername,
+		m.VspherePassword,
+	))
 }
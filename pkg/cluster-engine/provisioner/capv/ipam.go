@@ -0,0 +1,195 @@
+package capv
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/netapp/cake/pkg/config/types"
+	"github.com/netapp/cake/pkg/ipam"
+	"github.com/netapp/cake/pkg/platform/vsphere"
+	log "github.com/sirupsen/logrus"
+	"github.com/vmware/govmomi/object"
+	v3 "sigs.k8s.io/cluster-api-provider-vsphere/api/v1alpha3"
+)
+
+// addressInterval is how often new machines are given addresses, CAPV powers a VM on once it's cloned
+const addressInterval = 5 * time.Second
+
+// staticAddresses is true when the management network addresses come from the IPAM provider instead of DHCP
+func (m *MgmtCluster) staticAddresses() bool {
+	return m.IPAM.Provider != "" && m.IPAM.Provider != types.DHCP
+}
+
+// ipamClient returns a client of the IPAM provider for the owner's reservations
+func (m *MgmtCluster) ipamClient(owner string) (ipam.Client, error) {
+	switch m.IPAM.Provider {
+	case types.MNodeIPService:
+		return ipam.NewMNodeClient(m.IPAM.MNode, owner)
+	}
+	return nil, fmt.Errorf("IPAM Provider %s doesn't reserve addresses", m.IPAM.Provider)
+}
+
+// helperVMNetworks returns the helper VM's NIC on the management network with a reserved address,
+// or nil for a DHCP NIC
+func (m *MgmtCluster) helperVMNetworks(ctx context.Context, network object.NetworkReference) ([]vsphere.NetworkAttachment, error) {
+	if !m.staticAddresses() {
+		return nil, nil
+	}
+	name := m.bootstrapClusterName()
+	c, err := m.ipamClient(name)
+	if err != nil {
+		return nil, err
+	}
+	a, err := c.Reserve(ctx, name, m.ManagementNetwork)
+	if err != nil {
+		return nil, err
+	}
+	return []vsphere.NetworkAttachment{{
+		Network:     network,
+		IPAddress:   a.IP,
+		Netmask:     a.Netmask(),
+		Gateway:     a.Gateway,
+		NameServers: a.Nameservers,
+	}}, nil
+}
+
+// loadBalancerReservation is the name of the address reserved for the cluster's HAProxy load balancer
+func loadBalancerReservation(clusterName string) string {
+	return clusterName + "-lb"
+}
+
+// reserveLoadBalancerAddress reserves the load balancer's management address, CAPV creates its VM from the
+// HAProxyLoadBalancer so it can't be patched in like the machines' addresses
+func (m *MgmtCluster) reserveLoadBalancerAddress() error {
+	if !m.staticAddresses() {
+		return nil
+	}
+	c, err := m.ipamClient(m.ClusterName)
+	if err != nil {
+		return err
+	}
+	a, err := c.Reserve(context.Background(), loadBalancerReservation(m.ClusterName), m.ManagementNetwork)
+	if err != nil {
+		return err
+	}
+	m.loadBalancerAddress = &a
+	return nil
+}
+
+// assignMachineAddresses reserves an address for each of the cluster's VSphereMachines waiting for one on the
+// management network and patches it into the machine, CAPV copies it into the VM's metadata before powering it on.
+// The addresses of machines that are gone, scaled down or replaced by an upgrade, are released, the load balancer's is kept.
+func (m *MgmtCluster) assignMachineAddresses(envs map[string]string, clusterName string) error {
+	var machines v3.VSphereMachineList
+	err := kubeGetJSON(envs, &machines, "vspheremachines", "--selector=cluster.x-k8s.io/cluster-name="+clusterName)
+	if err != nil {
+		return err
+	}
+	ctx := context.Background()
+	c, err := m.ipamClient(clusterName)
+	if err != nil {
+		return err
+	}
+
+	current := map[string]bool{}
+	for _, machine := range machines.Items {
+		current[machine.Name] = true
+		devices := machine.Spec.Network.Devices
+		if machine.DeletionTimestamp != nil || len(devices) == 0 || !needsAddress(devices[0]) {
+			continue
+		}
+		a, err := c.Reserve(ctx, machine.Name, devices[0].NetworkName)
+		if err != nil {
+			return err
+		}
+		devices[0].IPAddrs = []string{a.CIDR()}
+		devices[0].Gateway4 = a.Gateway
+		devices[0].Nameservers = a.Nameservers
+		patch := map[string]interface{}{
+			"spec": map[string]interface{}{
+				"network": map[string]interface{}{
+					"devices": devices,
+				},
+			},
+		}
+		err = kubePatch(envs, "vspheremachine", machine.Name, patch)
+		if err != nil {
+			return err
+		}
+		m.events <- Event{EventType: "progress", Event: fmt.Sprintf("assigned %s to machine %s", a.IP, machine.Name)}
+	}
+
+	reserved, err := c.List(ctx)
+	if err != nil {
+		return err
+	}
+	for _, a := range reserved {
+		if !current[a.Name] && a.Name != loadBalancerReservation(clusterName) {
+			err = c.Release(ctx, a.Name)
+			if err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// needsAddress is true for a static NIC without an address
+func needsAddress(device v3.NetworkDeviceSpec) bool {
+	return !device.DHCP4 && !device.DHCP6 && len(device.IPAddrs) == 0
+}
+
+// whileAssigningAddresses runs fn, giving the cluster's new machines addresses every few seconds until it returns
+func (m *MgmtCluster) whileAssigningAddresses(envs map[string]string, clusterName string, fn func() error) error {
+	if !m.staticAddresses() {
+		return fn()
+	}
+	done := make(chan struct{})
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		ticker := time.NewTicker(addressInterval)
+		defer ticker.Stop()
+		for {
+			err := m.assignMachineAddresses(envs, clusterName)
+			if err != nil {
+				log.Warnf("unable to assign addresses to the machines of %s, %v", clusterName, err)
+			}
+			select {
+			case <-done:
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+	err := fn()
+	close(done)
+	wg.Wait()
+	return err
+}
+
+// releaseAddresses releases every address reserved by the owner
+func (m *MgmtCluster) releaseAddresses(owner string) error {
+	if !m.staticAddresses() {
+		return nil
+	}
+	ctx := context.Background()
+	c, err := m.ipamClient(owner)
+	if err != nil {
+		return err
+	}
+	reserved, err := c.List(ctx)
+	if err != nil {
+		return err
+	}
+	for _, a := range reserved {
+		err = c.Release(ctx, a.Name)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
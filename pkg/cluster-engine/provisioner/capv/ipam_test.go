@@ -0,0 +1,57 @@
+package capv
+
+import (
+	"context"
+	"testing"
+
+	"github.com/netapp/cake/pkg/config/types"
+	"github.com/netapp/cake/pkg/ipam/ipamtest"
+)
+
+func TestStaticAddresses(t *testing.T) {
+	s := ipamtest.NewMNodeServer()
+	defer s.Close()
+
+	m := testCluster()
+	m.ManagementNetwork = ipamtest.Network
+	if networks, err := m.helperVMNetworks(context.Background(), nil); err != nil || networks != nil {
+		t.Errorf("got helper VM networks %+v, %v with DHCP", networks, err)
+	}
+	if !m.cloneSpec(m.NodeTemplate).Network.Devices[0].DHCP4 {
+		t.Error("expected DHCP on the management network")
+	}
+
+	m.IPAM = types.IPAMConfig{Provider: types.MNodeIPService, MNode: s.Config()}
+	if device := m.cloneSpec(m.NodeTemplate).Network.Devices[0]; !needsAddress(device) {
+		t.Errorf("got management NIC %+v, want it to wait for an address", device)
+	}
+	networks, err := m.helperVMNetworks(context.Background(), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(networks) != 1 || networks[0].DHCP4 || networks[0].IPAddress != "10.20.0.10" ||
+		networks[0].Netmask != "255.255.255.0" || networks[0].Gateway != "10.20.0.1" {
+		t.Errorf("got helper VM networks %+v", networks)
+	}
+	if a, ok := s.Reservations()[m.bootstrapClusterName()]; !ok || a.Owner != m.bootstrapClusterName() {
+		t.Errorf("got reservations %+v, want the helper VM's", s.Reservations())
+	}
+
+	if err = m.reserveLoadBalancerAddress(); err != nil {
+		t.Fatal(err)
+	}
+	if device := m.haproxyLoadBalancer().Spec.VirtualMachineConfiguration.Network.Devices[0]; len(device.IPAddrs) != 1 ||
+		device.IPAddrs[0] != "10.20.0.11/24" || device.Gateway4 != "10.20.0.1" || device.DHCP4 {
+		t.Errorf("got load balancer NIC %+v, want its reserved address", device)
+	}
+	if a, ok := s.Reservations()[loadBalancerReservation(m.ClusterName)]; !ok || a.Owner != m.ClusterName {
+		t.Errorf("got reservations %+v, want the load balancer's", s.Reservations())
+	}
+
+	if err = m.releaseAddresses(m.ClusterName); err != nil || len(s.Reservations()) != 1 {
+		t.Errorf("got reservations %+v, %v, want another owner's left", s.Reservations(), err)
+	}
+	if err = m.releaseAddresses(m.bootstrapClusterName()); err != nil || len(s.Reservations()) != 0 {
+		t.Errorf("got reservations %+v, %v after release", s.Reservations(), err)
+	}
+}
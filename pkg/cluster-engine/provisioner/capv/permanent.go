@@ -14,22 +14,24 @@ import (
 
 // CreatePermanent creates the permanent CAPv management cluster
 func (m *MgmtCluster) CreatePermanent() error {
-	var err error
-	var capiConfig string
 	home, err := os.UserHomeDir()
 	if err != nil {
 		return err
 	}
 	kubeConfig := filepath.Join(home, ConfigDir, m.ClusterName, bootstrapKubeconfig)
-	if m.Addons.Solidfire.Enable {
-		err = injectTridentPrereqs(m.ClusterName, m.StorageNetwork, kubeConfig, nil)
-		if err != nil {
-			return err
-		}
-		capiConfig = filepath.Join(home, ConfigDir, m.ClusterName, m.ClusterName+"-final"+".yaml")
-	} else {
-		capiConfig = filepath.Join(home, ConfigDir, m.ClusterName, m.ClusterName+"-base"+".yaml")
+
+	return m.createCluster(kubeConfig)
+}
+
+// createCluster applies the cluster's spec to the managing cluster at kubeConfig, waits for the
+// machines and nodes, installs the CNI, and tags and spreads out the cluster's virtual machines
+func (m *MgmtCluster) createCluster(kubeConfig string) error {
+	var err error
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return err
 	}
+	capiConfig := filepath.Join(home, ConfigDir, m.ClusterName, specFileName(m.ClusterName))
 
 	envs := map[string]string{
 		"KUBECONFIG": kubeConfig,
@@ -46,6 +48,7 @@ func (m *MgmtCluster) CreatePermanent() error {
 	args = []string{
 		"get",
 		"machine",
+		"--selector=cluster.x-k8s.io/cluster-name=" + m.ClusterName,
 	}
 	timeout := 15 * time.Minute
 	grepString := "Running"
@@ -53,15 +56,20 @@ func (m *MgmtCluster) CreatePermanent() error {
 	if err != nil {
 		return err
 	}
-	workerCount, err := strconv.Atoi(m.WorkerMachineCount)
+	pools, err := m.nodePools()
 	if err != nil {
 		return err
 	}
-	grepNum := controlCount + workerCount
+	grepNum := controlCount
+	for _, pool := range pools {
+		grepNum += pool.Replicas
+	}
 	if err != nil {
 		return err
 	}
-	err = kubeRetry(nil, args, timeout, grepString, grepNum, nil, m.events)
+	err = m.whileAssigningAddresses(envs, m.ClusterName, func() error {
+		return kubeRetry(envs, args, timeout, grepString, grepNum, nil, m.events)
+	})
 	if err != nil {
 		return err
 	}
@@ -84,13 +92,13 @@ func (m *MgmtCluster) CreatePermanent() error {
 	}
 
 	// apply cni
-	permanentKubeconfig := filepath.Join(home, ConfigDir, m.ClusterName, "kubeconfig")
+	clusterKubeconfig := filepath.Join(home, ConfigDir, m.ClusterName, "kubeconfig")
 	envs = map[string]string{
-		"KUBECONFIG": permanentKubeconfig,
+		"KUBECONFIG": clusterKubeconfig,
 	}
 	args = []string{
 		"apply",
-		"--filename=https://docs.projectcalico.org/v3.12/manifests/calico.yaml",
+		"--filename=" + calicoManifest,
 	}
 	err = cmds.GenericExecute(envs, string(kubectl), args, nil)
 	if err != nil {
@@ -107,6 +115,15 @@ func (m *MgmtCluster) CreatePermanent() error {
 	if err != nil {
 		return err
 	}
+
+	err = m.tagMachines(kubeConfig, m.ClusterName)
+	if err != nil {
+		return err
+	}
+	err = m.applyAntiAffinityRules(kubeConfig)
+	if err != nil {
+		return err
+	}
 	time.Sleep(5 * time.Second)
 	return err
 }
@@ -8,7 +8,8 @@ import (
 	"github.com/netapp/cake/pkg/cmds"
 )
 
-// PivotControlPlane moves CAPv from the bootstrap cluster to the permanent management cluster
+// PivotControlPlane moves CAPv from the bootstrap cluster to the permanent management cluster,
+// then deletes the bootstrap cluster unless it's kept
 func (m *MgmtCluster) PivotControlPlane() error {
 	var err error
 
@@ -40,24 +41,11 @@ func (m *MgmtCluster) PivotControlPlane() error {
 		return err
 	}
 
-	envs = map[string]string{
-		"VSPHERE_PASSWORD":           m.VspherePassword,
-		"VSPHERE_USERNAME":           m.VsphereUsername,
-		"VSPHERE_SERVER":             m.VcenterServer,
-		"VSPHERE_DATACENTER":         m.Datacenter,
-		"VSPHERE_DATASTORE":          m.Datastore,
-		"VSPHERE_NETWORK":            m.ManagementNetwork,
-		"VSPHERE_RESOURCE_POOL":      m.ResourcePool,
-		"VSPHERE_FOLDER":             m.Folder,
-		"VSPHERE_TEMPLATE":           m.NodeTemplate,
-		"VSPHERE_HAPROXY_TEMPLATE":   m.LoadBalancerTemplate,
-		"VSPHERE_SSH_AUTHORIZED_KEY": m.SSHAuthorizedKey,
-		"KUBECONFIG":                 permanentKubeConfig,
-	}
+	envs = m.clusterctlEnvs(permanentKubeConfig)
 
-	args = []string{
-		"init",
-		"--infrastructure=vsphere",
+	args, err = m.clusterctlInitArgs()
+	if err != nil {
+		return err
 	}
 	err = cmds.GenericExecute(envs, string(clusterctl), args, nil)
 	if err != nil {
@@ -91,5 +79,10 @@ func (m *MgmtCluster) PivotControlPlane() error {
 		return err
 	}
 	time.Sleep(5 * time.Second)
-	return err
+
+	if m.Bootstrap.Keep {
+		m.events <- Event{EventType: "progress", Event: "keeping bootstrap cluster " + m.bootstrapClusterName()}
+		return err
+	}
+	return m.deleteBootstrap()
 }
@@ -0,0 +1,209 @@
+package capv
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/netapp/cake/pkg/cluster-engine/provisioner"
+	"github.com/netapp/cake/pkg/cmds"
+)
+
+const (
+	coreProvider           = "CoreProvider"
+	bootstrapProvider      = "BootstrapProvider"
+	controlPlaneProvider   = "ControlPlaneProvider"
+	infrastructureProvider = "InfrastructureProvider"
+)
+
+var (
+	providerVersion     = regexp.MustCompile(`^v\d+\.\d+\.\d+`)
+	planManagementGroup = regexp.MustCompile(`Management group: ([^,\s]+)`)
+	planContract        = regexp.MustCompile(`for the (\S+) API Version`)
+)
+
+// providerFlags are the clusterctl flags and provider names for each provider type
+var providerFlags = map[string]struct{ flag, name string }{
+	coreProvider:           {"--core", "cluster-api"},
+	bootstrapProvider:      {"--bootstrap", "kubeadm"},
+	controlPlaneProvider:   {"--control-plane", "kubeadm"},
+	infrastructureProvider: {"--infrastructure", "vsphere"},
+}
+
+// imageVersion returns the version tag of a provider image, or an empty string when the image isn't set
+func imageVersion(image string) (string, error) {
+	if image == "" {
+		return "", nil
+	}
+	i := strings.LastIndex(image, ":")
+	if i < 0 || strings.Contains(image[i:], "/") || strings.Contains(image, "@") {
+		return "", fmt.Errorf("provider image %s has no version tag", image)
+	}
+	tag := image[i+1:]
+	if !providerVersion.MatchString(tag) {
+		return "", fmt.Errorf("provider image %s tag %s is not a release version", image, tag)
+	}
+	return tag, nil
+}
+
+// pinnedVersions returns the provider versions pinned by the components config, keyed by provider type.
+// The kubeadm control plane provider is released with the core provider so it follows the CAPI image.
+func (m *MgmtCluster) pinnedVersions() (map[string]string, error) {
+	images := map[string]string{
+		coreProvider:           m.Components.CAPIImage,
+		bootstrapProvider:      m.Components.CABPKImage,
+		controlPlaneProvider:   m.Components.CAPIImage,
+		infrastructureProvider: m.Components.CAPVImage,
+	}
+	versions := map[string]string{}
+	for providerType, image := range images {
+		v, err := imageVersion(image)
+		if err != nil {
+			return nil, err
+		}
+		if v != "" {
+			versions[providerType] = v
+		}
+	}
+	return versions, nil
+}
+
+// clusterctlInitArgs returns the clusterctl init arguments, pinning the provider versions from the components config
+func (m *MgmtCluster) clusterctlInitArgs() ([]string, error) {
+	versions, err := m.pinnedVersions()
+	if err != nil {
+		return nil, err
+	}
+
+	args := []string{"init"}
+	for _, providerType := range []string{coreProvider, bootstrapProvider, controlPlaneProvider, infrastructureProvider} {
+		v, ok := versions[providerType]
+		if !ok {
+			continue
+		}
+		p := providerFlags[providerType]
+		args = append(args, p.flag+"="+p.name+":"+v)
+	}
+	if _, ok := versions[infrastructureProvider]; !ok {
+		args = append(args, "--infrastructure=vsphere")
+	}
+	return args, nil
+}
+
+// parseUpgradePlan reads the management group, contract and providers from `clusterctl upgrade plan`
+func parseUpgradePlan(plan string) (string, string, []provisioner.ProviderUpgrade, error) {
+	group := planManagementGroup.FindStringSubmatch(plan)
+	contract := planContract.FindStringSubmatch(plan)
+	if group == nil || contract == nil {
+		return "", "", nil, fmt.Errorf("no management group found in upgrade plan")
+	}
+
+	var providers []provisioner.ProviderUpgrade
+	var inTable bool
+	for _, line := range strings.Split(plan, "\n") {
+		fields := strings.Fields(line)
+		switch {
+		case len(fields) > 0 && fields[0] == "NAME":
+			inTable = true
+		case len(fields) == 0:
+			inTable = false
+		case inTable && len(fields) >= 5:
+			providers = append(providers, provisioner.ProviderUpgrade{
+				Name:           fields[0],
+				Namespace:      fields[1],
+				Type:           fields[2],
+				CurrentVersion: fields[3],
+				NextVersion:    strings.Join(fields[4:], " "),
+			})
+		}
+	}
+	return group[1], contract[1], providers, nil
+}
+
+// upgradePlan runs `clusterctl upgrade plan` against the permanent cluster
+func (m *MgmtCluster) upgradePlan() (string, string, []provisioner.ProviderUpgrade, error) {
+	kubeConfig, err := m.managementKubeconfig()
+	if err != nil {
+		return "", "", nil, err
+	}
+	envs := map[string]string{
+		"KUBECONFIG": kubeConfig,
+	}
+	args := []string{
+		"upgrade",
+		"plan",
+	}
+	c := cmds.NewCommandLine(envs, string(clusterctl), args, nil)
+	stdout, stderr, err := c.Program().Execute()
+	if err != nil || string(stderr) != "" {
+		return "", "", nil, fmt.Errorf("err: %v, stderr: %v, cmd: %v %v", err, string(stderr), c.CommandName, c.Args)
+	}
+	return parseUpgradePlan(string(stdout))
+}
+
+// ProviderUpgradePlan returns the current, latest available and pinned versions of the providers on the management cluster
+func (m *MgmtCluster) ProviderUpgradePlan() ([]provisioner.ProviderUpgrade, error) {
+	_, _, providers, err := m.upgradePlan()
+	if err != nil {
+		return nil, err
+	}
+	versions, err := m.pinnedVersions()
+	if err != nil {
+		return nil, err
+	}
+	for i := range providers {
+		if v, ok := versions[providers[i].Type]; ok {
+			providers[i].PinnedVersion = v
+		}
+	}
+	return providers, nil
+}
+
+// UpgradeProviders upgrades the providers on the management cluster to the versions pinned
+// in the components config, or to the latest release of the current contract when none are pinned
+func (m *MgmtCluster) UpgradeProviders() error {
+	group, contract, providers, err := m.upgradePlan()
+	if err != nil {
+		return err
+	}
+	versions, err := m.pinnedVersions()
+	if err != nil {
+		return err
+	}
+
+	args := []string{
+		"upgrade",
+		"apply",
+		"--management-group=" + group,
+	}
+	if len(versions) == 0 {
+		args = append(args, "--contract="+contract)
+	}
+	for _, p := range providers {
+		v, ok := versions[p.Type]
+		if !ok || v == p.CurrentVersion {
+			continue
+		}
+		f := providerFlags[p.Type]
+		args = append(args, f.flag+"="+p.Namespace+"/"+f.name+":"+v)
+	}
+	if len(versions) > 0 && len(args) == 3 {
+		m.events <- Event{EventType: "progress", Event: "providers are already at the pinned versions"}
+		return nil
+	}
+
+	kubeConfig, err := m.managementKubeconfig()
+	if err != nil {
+		return err
+	}
+	envs := map[string]string{
+		"KUBECONFIG": kubeConfig,
+	}
+	m.events <- Event{EventType: "progress", Event: "upgrading providers in management group " + group}
+	err = cmds.GenericExecute(envs, string(clusterctl), args, nil)
+	if err != nil {
+		return err
+	}
+	m.events <- Event{EventType: "progress", Event: "providers upgraded"}
+	return err
+}
@@ -0,0 +1,76 @@
+package capv
+
+import (
+	"reflect"
+	"testing"
+)
+
+const upgradePlan = `Checking new release availability...
+
+Management group: capi-system/cluster-api, latest release available for the v1alpha3 API Version of Cluster API (contract):
+
+NAME                     NAMESPACE                           TYPE                     CURRENT VERSION   NEXT VERSION
+bootstrap-kubeadm        capi-kubeadm-bootstrap-system       BootstrapProvider        v0.3.3            v0.3.6
+control-plane-kubeadm    capi-kubeadm-control-plane-system   ControlPlaneProvider     v0.3.3            v0.3.6
+cluster-api              capi-system                         CoreProvider             v0.3.3            v0.3.6
+infrastructure-vsphere   capv-system                         InfrastructureProvider   v0.6.4            Already up to date
+
+You can now apply the upgrade by executing the following command:
+
+   upgrade apply --management-group capi-system/cluster-api  --contract v1alpha3
+`
+
+func TestParseUpgradePlan(t *testing.T) {
+	group, contract, providers, err := parseUpgradePlan(upgradePlan)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if group != "capi-system/cluster-api" || contract != "v1alpha3" {
+		t.Errorf("got management group %s and contract %s", group, contract)
+	}
+	if len(providers) != 4 {
+		t.Fatalf("got %d providers, want 4", len(providers))
+	}
+	if p := providers[0]; p.Name != "bootstrap-kubeadm" || p.Namespace != "capi-kubeadm-bootstrap-system" ||
+		p.Type != bootstrapProvider || p.CurrentVersion != "v0.3.3" || p.NextVersion != "v0.3.6" {
+		t.Errorf("got provider %+v", p)
+	}
+	if p := providers[3]; p.NextVersion != "Already up to date" {
+		t.Errorf("got next version %q, want Already up to date", p.NextVersion)
+	}
+
+	if _, _, _, err = parseUpgradePlan("no providers"); err == nil {
+		t.Errorf("expected an error without a management group")
+	}
+}
+
+func TestClusterctlInitArgs(t *testing.T) {
+	m := &MgmtCluster{}
+	args, err := m.clusterctlInitArgs()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"init", "--infrastructure=vsphere"}; !reflect.DeepEqual(args, want) {
+		t.Errorf("got %v, want %v", args, want)
+	}
+
+	m.Components.CAPIImage = "us.gcr.io/k8s-artifacts-prod/cluster-api/cluster-api-controller:v0.3.3"
+	m.Components.CAPVImage = "registry.local:5000/cluster-api-provider-vsphere/manager:v0.6.3"
+	args, err = m.clusterctlInitArgs()
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{"init", "--core=cluster-api:v0.3.3", "--control-plane=kubeadm:v0.3.3", "--infrastructure=vsphere:v0.6.3"}
+	if !reflect.DeepEqual(args, want) {
+		t.Errorf("got %v, want %v", args, want)
+	}
+
+	m.Components.CABPKImage = "registry.local:5000/kubeadm-bootstrap-controller"
+	if _, err = m.clusterctlInitArgs(); err == nil {
+		t.Errorf("expected an image without a tag to be rejected")
+	}
+	m.Components.CABPKImage = "kubeadm-bootstrap-controller:latest"
+	if _, err = m.clusterctlInitArgs(); err == nil {
+		t.Errorf("expected an image without a release tag to be rejected")
+	}
+}
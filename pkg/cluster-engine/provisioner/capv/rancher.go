@@ -0,0 +1,513 @@
+package capv
+
+import (
+	"bytes"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/netapp/cake/pkg/artifacts"
+	"github.com/netapp/cake/pkg/cmds"
+
+	v1 "k8s.io/api/core/v1"
+	"sigs.k8s.io/yaml"
+)
+
+const (
+	rancherChartRepo         = "https://releases.rancher.com/server-charts/stable"
+	rancherDefaultVersion    = "2.4.3"
+	ingressNginxChartRepo    = "https://kubernetes.github.io/ingress-nginx"
+	ingressNginxVersion      = "2.3.0"
+	certManagerChartRepo     = "https://charts.jetstack.io"
+	certManagerVersion       = "v0.12.0"
+	certManagerCRDs          = "https://raw.githubusercontent.com/jetstack/cert-manager/release-0.12/deploy/manifests/00-crds.yaml"
+	rancherAdminUser         = "admin"
+	rancherDefaultPassword   = "admin"
+	rancherTimeout           = 15 * time.Minute
+	rancherTLSSelfSigned     = "rancher"
+	rancherTLSSecret         = "secret"
+	rancherTLSPrivateCA      = "privateCA"
+	rancherIngressSecretName = "tls-rancher-ingress"
+	ingressNginxValuesFile   = "ingress-nginx-values.yaml"
+	rancherValuesFile        = "rancher-values.yaml"
+	// chartsPath in the artifact repository has the chart archives
+	chartsPath = "charts"
+)
+
+// validate checks the Rancher addon config
+func (r *Rancher) validate() error {
+	if r.Hostname == "" {
+		return fmt.Errorf("rancher addon requires a Hostname")
+	}
+	switch r.TLSSource {
+	case "", rancherTLSSelfSigned:
+	case rancherTLSSecret:
+		if r.TLSCert == "" || r.TLSKey == "" {
+			return fmt.Errorf("rancher TLSSource %s requires TLSCert and TLSKey", r.TLSSource)
+		}
+	case rancherTLSPrivateCA:
+		if r.TLSCert == "" || r.TLSKey == "" || r.CACert == "" {
+			return fmt.Errorf("rancher TLSSource %s requires TLSCert, TLSKey and CACert", r.TLSSource)
+		}
+	default:
+		return fmt.Errorf("unknown rancher TLSSource %s, must be one of %s, %s or %s", r.TLSSource, rancherTLSSelfSigned, rancherTLSSecret, rancherTLSPrivateCA)
+	}
+	return nil
+}
+
+func (r *Rancher) selfSigned() bool {
+	return r.TLSSource == "" || r.TLSSource == rancherTLSSelfSigned
+}
+
+// values returns the Rancher chart values
+func (r *Rancher) values() map[string]interface{} {
+	source := rancherTLSSecret
+	if r.selfSigned() {
+		source = rancherTLSSelfSigned
+	}
+	values := map[string]interface{}{
+		"hostname": r.Hostname,
+		"ingress": map[string]interface{}{
+			"tls": map[string]interface{}{
+				"source": source,
+			},
+		},
+	}
+	if r.TLSSource == rancherTLSPrivateCA {
+		values["privateCA"] = true
+	}
+	return values
+}
+
+// ingressNginxValues returns the ingress-nginx chart values, the Rancher hostname
+// resolves to the nodes so the ingress controller listens on the host network
+func ingressNginxValues() map[string]interface{} {
+	return map[string]interface{}{
+		"controller": map[string]interface{}{
+			"kind":        "DaemonSet",
+			"hostNetwork": true,
+			"dnsPolicy":   "ClusterFirstWithHostNet",
+			"service": map[string]interface{}{
+				"type": "ClusterIP",
+			},
+		},
+	}
+}
+
+// writeValues writes chart values to the cluster's directory and returns the file's location
+func writeValues(clusterName, fileName string, values map[string]interface{}) (string, error) {
+	out, err := yaml.Marshal(values)
+	if err != nil {
+		return "", fmt.Errorf("unable to write %s, %v", fileName, err)
+	}
+	err = writeToDisk(clusterName, fileName, out, 0644)
+	if err != nil {
+		return "", err
+	}
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(home, ConfigDir, clusterName, fileName), nil
+}
+
+// chartReference returns the chart helm installs, the artifact repository's charts/<name>-<version>.tgz verified
+// against its charts/SHA256SUMS when there is one, or <repo>/<name> from the public chart repository added to helm
+func (m *MgmtCluster) chartReference(repo, name, version string) (string, error) {
+	if m.Bintray.Target == "" {
+		return repo + "/" + name, nil
+	}
+	f, err := m.fetcher()
+	if err != nil {
+		return "", err
+	}
+	return f.Fetch(artifacts.Artifact{
+		Location: path.Join(chartsPath, name+"-"+version+".tgz"),
+		Checksum: path.Join(chartsPath, "SHA256SUMS"),
+	})
+}
+
+// installRancher installs an ingress controller, cert-manager when needed, and the Rancher
+// chart onto the permanent cluster, then sets the admin password through the Rancher API
+func installRancher(m *MgmtCluster) error {
+	m.events <- Event{EventType: "progress", Event: "installing the rancher addon"}
+	var err error
+	r := m.Addons.Rancher
+	if err = r.validate(); err != nil {
+		return err
+	}
+	selfSigned := r.selfSigned()
+	version := r.Version
+	if version == "" {
+		version = rancherDefaultVersion
+	}
+
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return err
+	}
+	permanentKubeConfig := filepath.Join(home, ConfigDir, m.ClusterName, "kubeconfig")
+	envs := map[string]string{
+		"KUBECONFIG": permanentKubeConfig,
+	}
+
+	repos := map[string]string{
+		"rancher-stable": rancherChartRepo,
+		"ingress-nginx":  ingressNginxChartRepo,
+	}
+	if selfSigned {
+		repos["jetstack"] = certManagerChartRepo
+	}
+	if m.Bintray.Target == "" {
+		for name, url := range repos {
+			err = cmds.GenericExecute(envs, string(helm), []string{"repo", "add", name, url}, nil)
+			if err != nil {
+				return err
+			}
+		}
+		err = cmds.GenericExecute(envs, string(helm), []string{"repo", "update"}, nil)
+		if err != nil {
+			return err
+		}
+	}
+
+	err = writeToDisk(m.ClusterName, rancherNamespaces.Name, []byte(rancherNamespaces.Contents), 0644)
+	if err != nil {
+		return err
+	}
+	args := []string{
+		"apply",
+		"--filename=" + filepath.Join(home, ConfigDir, m.ClusterName, rancherNamespaces.Name),
+	}
+	err = cmds.GenericExecute(envs, string(kubectl), args, nil)
+	if err != nil {
+		return err
+	}
+
+	m.events <- Event{EventType: "progress", Event: "installing the nginx ingress controller"}
+	values, err := writeValues(m.ClusterName, ingressNginxValuesFile, ingressNginxValues())
+	if err != nil {
+		return err
+	}
+	chart, err := m.chartReference("ingress-nginx", "ingress-nginx", ingressNginxVersion)
+	if err != nil {
+		return err
+	}
+	args = []string{
+		"upgrade",
+		"--install",
+		"ingress-nginx",
+		chart,
+		"--namespace=ingress-nginx",
+		"--version=" + ingressNginxVersion,
+		"--values=" + values,
+		"--wait",
+	}
+	err = cmds.GenericExecute(envs, string(helm), args, nil)
+	if err != nil {
+		return err
+	}
+
+	if selfSigned {
+		m.events <- Event{EventType: "progress", Event: "installing cert-manager"}
+		args = []string{
+			"apply",
+			"--validate=false",
+			"--filename=" + certManagerCRDs,
+		}
+		err = cmds.GenericExecute(envs, string(kubectl), args, nil)
+		if err != nil {
+			return err
+		}
+		chart, err = m.chartReference("jetstack", "cert-manager", certManagerVersion)
+		if err != nil {
+			return err
+		}
+		args = []string{
+			"upgrade",
+			"--install",
+			"cert-manager",
+			chart,
+			"--namespace=cert-manager",
+			"--version=" + certManagerVersion,
+			"--wait",
+		}
+		err = cmds.GenericExecute(envs, string(helm), args, nil)
+		if err != nil {
+			return err
+		}
+	} else {
+		err = kubeCreateOrApply(envs,
+			"secret",
+			"tls",
+			rancherIngressSecretName,
+			"--namespace=cattle-system",
+			"--cert="+r.TLSCert,
+			"--key="+r.TLSKey,
+		)
+		if err != nil {
+			return err
+		}
+	}
+	if r.TLSSource == rancherTLSPrivateCA {
+		err = kubeCreateOrApply(envs,
+			"secret",
+			"generic",
+			"tls-ca",
+			"--namespace=cattle-system",
+			"--from-file=cacerts.pem="+r.CACert,
+		)
+		if err != nil {
+			return err
+		}
+	}
+
+	m.events <- Event{EventType: "progress", Event: "installing rancher " + version}
+	values, err = writeValues(m.ClusterName, rancherValuesFile, r.values())
+	if err != nil {
+		return err
+	}
+	chart, err = m.chartReference("rancher-stable", "rancher", version)
+	if err != nil {
+		return err
+	}
+	args = []string{
+		"upgrade",
+		"--install",
+		"rancher",
+		chart,
+		"--namespace=cattle-system",
+		"--version=" + version,
+		"--values=" + values,
+		"--wait",
+		"--timeout=" + rancherTimeout.String(),
+	}
+	err = cmds.GenericExecute(envs, string(helm), args, nil)
+	if err != nil {
+		return err
+	}
+
+	m.events <- Event{EventType: "progress", Event: "waiting for the rancher API"}
+	client, err := rancherHTTPClient(envs, r)
+	if err != nil {
+		return err
+	}
+	serverURL := "https://" + r.Hostname
+	api := &rancherAPI{url: serverURL, client: client}
+	err = waitFor(rancherTimeout, 10*time.Second, api.ping)
+	if err != nil {
+		return fmt.Errorf("rancher API did not answer at %s, %v", serverURL, err)
+	}
+
+	password := r.BootstrapPassword
+	if password == "" {
+		password, err = randomPassword()
+		if err != nil {
+			return err
+		}
+	}
+	err = setRancherAdmin(api, password, serverURL)
+	if err != nil {
+		return err
+	}
+
+	m.events <- Event{
+		EventType: "output",
+		Event:     "rancher is available at " + serverURL,
+		Outputs: map[string]string{
+			"rancherURL":      serverURL,
+			"rancherUsername": rancherAdminUser,
+			"rancherPassword": password,
+		},
+	}
+	m.events <- Event{EventType: "progress", Event: "rancher addon install complete"}
+	return err
+}
+
+// rancherHTTPClient returns a client trusting the CA that signed the Rancher certificate,
+// the self-signed CA is read from the cluster once Rancher has generated it
+func rancherHTTPClient(envs map[string]string, r Rancher) (*http.Client, error) {
+	var ca []byte
+	var err error
+
+	switch r.TLSSource {
+	case "", rancherTLSSelfSigned:
+		args := []string{
+			"--namespace=cattle-system",
+			"--output=json",
+			"get",
+			"secret",
+			"tls-rancher",
+		}
+		err = waitFor(rancherTimeout, 10*time.Second, func() error {
+			secret, err := kubeGet(envs, args, v1.Secret{}, nil)
+			if err != nil {
+				return err
+			}
+			ca = secret.(v1.Secret).Data["tls.crt"]
+			return nil
+		})
+		if err != nil {
+			return nil, fmt.Errorf("unable to get the rancher CA, %v", err)
+		}
+	case rancherTLSPrivateCA:
+		ca, err = ioutil.ReadFile(r.CACert)
+		if err != nil {
+			return nil, fmt.Errorf("unable to read CACert, %v", err)
+		}
+	default:
+		return &http.Client{Timeout: 30 * time.Second}, nil
+	}
+
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(ca) {
+		return nil, fmt.Errorf("no certificates found in the rancher CA")
+	}
+	return &http.Client{
+		Timeout: 30 * time.Second,
+		Transport: &http.Transport{
+			TLSClientConfig: &tls.Config{RootCAs: pool},
+		},
+	}, nil
+}
+
+// setRancherAdmin changes the default admin password and sets the server URL, when a previous
+// run already changed the password the admin logs in with the new one instead
+func setRancherAdmin(api *rancherAPI, password, serverURL string) error {
+	err := api.login(rancherAdminUser, rancherDefaultPassword)
+	if err == nil {
+		err = api.changePassword(rancherDefaultPassword, password)
+		if err != nil {
+			return err
+		}
+	} else {
+		if loginErr := api.login(rancherAdminUser, password); loginErr != nil {
+			return fmt.Errorf("unable to login to rancher with the default or bootstrap password, %v", err)
+		}
+	}
+
+	return api.setServerURL(serverURL)
+}
+
+// rancherAPI is a minimal client for the Rancher v3 API
+type rancherAPI struct {
+	url    string
+	client *http.Client
+	token  string
+}
+
+// ping checks the Rancher server answers
+func (a *rancherAPI) ping() error {
+	resp, err := a.client.Get(a.url + "/ping")
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	body, _ := ioutil.ReadAll(resp.Body)
+	if resp.StatusCode != http.StatusOK || strings.TrimSpace(string(body)) != "pong" {
+		return fmt.Errorf("unexpected ping response, status: %v, body: %s", resp.Status, body)
+	}
+	return nil
+}
+
+func (a *rancherAPI) login(username, password string) error {
+	body := map[string]string{
+		"username":     username,
+		"password":     password,
+		"responseType": "json",
+	}
+	var token struct {
+		Token string `json:"token"`
+	}
+	err := a.do(http.MethodPost, "/v3-public/localProviders/local?action=login", body, &token)
+	if err != nil {
+		return err
+	}
+	if token.Token == "" {
+		return fmt.Errorf("rancher login returned no token")
+	}
+	a.token = token.Token
+	return nil
+}
+
+func (a *rancherAPI) changePassword(current, password string) error {
+	body := map[string]string{
+		"currentPassword": current,
+		"newPassword":     password,
+	}
+	return a.do(http.MethodPost, "/v3/users?action=changepassword", body, nil)
+}
+
+func (a *rancherAPI) setServerURL(serverURL string) error {
+	body := map[string]string{
+		"name":  "server-url",
+		"value": serverURL,
+	}
+	return a.do(http.MethodPut, "/v3/settings/server-url", body, nil)
+}
+
+func (a *rancherAPI) do(method, path string, body interface{}, out interface{}) error {
+	payload, err := json.Marshal(body)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequest(method, a.url+path, bytes.NewReader(payload))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if a.token != "" {
+		req.Header.Set("Authorization", "Bearer "+a.token)
+	}
+
+	resp, err := a.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	respBody, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("rancher API %s %s failed, status: %v", method, strings.Split(path, "?")[0], resp.Status)
+	}
+	if out != nil {
+		return json.Unmarshal(respBody, out)
+	}
+	return nil
+}
+
+// randomPassword generates a password for the rancher admin
+func randomPassword() (string, error) {
+	b := make([]byte, 18)
+	if _, err := rand.Read(b); err != nil {
+		return "", fmt.Errorf("unable to generate password, %v", err)
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+// waitFor retries fn every interval until it succeeds or the timeout passes
+func waitFor(timeout, interval time.Duration, fn func() error) error {
+	deadline := time.Now().Add(timeout)
+	for {
+		err := fn()
+		if err == nil {
+			return nil
+		}
+		if time.Now().After(deadline) {
+			return err
+		}
+		time.Sleep(interval)
+	}
+}
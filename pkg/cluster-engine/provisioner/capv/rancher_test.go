@@ -0,0 +1,147 @@
+package capv
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/netapp/cake/pkg/config/types"
+)
+
+// fakeRancher serves the parts of the Rancher API used to set up the admin
+type fakeRancher struct {
+	password  string
+	serverURL string
+}
+
+func (f *fakeRancher) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	var body map[string]string
+	json.NewDecoder(r.Body).Decode(&body)
+
+	switch r.URL.Path {
+	case "/ping":
+		w.Write([]byte("pong"))
+	case "/v3-public/localProviders/local":
+		if body["username"] != rancherAdminUser || body["password"] != f.password {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		w.WriteHeader(http.StatusCreated)
+		json.NewEncoder(w).Encode(map[string]string{"token": "token-" + f.password})
+	case "/v3/users":
+		if r.Header.Get("Authorization") != "Bearer token-"+f.password || body["currentPassword"] != f.password {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		f.password = body["newPassword"]
+	case "/v3/settings/server-url":
+		if r.Header.Get("Authorization") == "" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		f.serverURL = body["value"]
+	default:
+		w.WriteHeader(http.StatusNotFound)
+	}
+}
+
+func TestSetRancherAdmin(t *testing.T) {
+	fake := &fakeRancher{password: rancherDefaultPassword}
+	s := httptest.NewTLSServer(fake)
+	defer s.Close()
+
+	api := &rancherAPI{url: s.URL, client: s.Client()}
+	if err := api.ping(); err != nil {
+		t.Fatal(err)
+	}
+	if err := setRancherAdmin(api, "bootstrap", "https://rancher.example.com"); err != nil {
+		t.Fatal(err)
+	}
+	if fake.password != "bootstrap" || fake.serverURL != "https://rancher.example.com" {
+		t.Errorf("got password %q and server url %q", fake.password, fake.serverURL)
+	}
+
+	// a second run logs in with the bootstrap password
+	api = &rancherAPI{url: s.URL, client: s.Client()}
+	if err := setRancherAdmin(api, "bootstrap", "https://rancher.example.com"); err != nil {
+		t.Fatal(err)
+	}
+	api = &rancherAPI{url: s.URL, client: s.Client()}
+	if err := setRancherAdmin(api, "wrong", "https://rancher.example.com"); err == nil {
+		t.Errorf("expected login with the wrong password to fail")
+	}
+}
+
+func TestRancherValidate(t *testing.T) {
+	tests := []struct {
+		name    string
+		rancher Rancher
+		valid   bool
+	}{
+		{"self-signed", Rancher{Hostname: "rancher.example.com"}, true},
+		{"no hostname", Rancher{}, false},
+		{"secret", Rancher{Hostname: "r", TLSSource: "secret", TLSCert: "tls.crt", TLSKey: "tls.key"}, true},
+		{"secret without key", Rancher{Hostname: "r", TLSSource: "secret", TLSCert: "tls.crt"}, false},
+		{"private ca without ca", Rancher{Hostname: "r", TLSSource: "privateCA", TLSCert: "tls.crt", TLSKey: "tls.key"}, false},
+		{"unknown source", Rancher{Hostname: "r", TLSSource: "letsEncrypt"}, false},
+	}
+	for _, tt := range tests {
+		err := tt.rancher.validate()
+		if (err == nil) != tt.valid {
+			t.Errorf("%s: got err %v, want valid %v", tt.name, err, tt.valid)
+		}
+	}
+}
+
+func TestChartReference(t *testing.T) {
+	sums := strings.Repeat("0", 64) + "  ingress-nginx-2.3.0.tgz\n" +
+		"cc57fc1903e444cf6a726490b43b27ee9f87facc037f86872201847c565b45fb  rancher-2.4.3.tgz\n"
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if user, token, _ := r.BasicAuth(); user != "cake" || token != "secret" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		switch r.URL.Path {
+		case "/netapp/cake/charts/rancher-2.4.3.tgz", "/netapp/cake/charts/ingress-nginx-2.3.0.tgz":
+			w.Write([]byte("chart"))
+		case "/netapp/cake/charts/SHA256SUMS":
+			w.Write([]byte(sums))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer s.Close()
+
+	home, err := ioutil.TempDir("", "chart_reference_test_")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(home)
+	defer os.Setenv("HOME", os.Getenv("HOME"))
+	os.Setenv("HOME", home)
+
+	m := testCluster()
+	m.events = make(chan interface{}, 10)
+	if chart, err := m.chartReference("rancher-stable", "rancher", "2.4.3"); err != nil || chart != "rancher-stable/rancher" {
+		t.Errorf("got chart %s, %v without an artifact repository", chart, err)
+	}
+	m.Bintray = types.BintraySpec{Target: s.URL, Subject: "netapp", BasePath: "cake", User: "cake", Token: "secret"}
+	chart, err := m.chartReference("rancher-stable", "rancher", "2.4.3")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, _ := ioutil.ReadFile(chart); string(got) != "chart" || !strings.HasPrefix(chart, filepath.Join(home, ConfigDir, cacheDir)) {
+		t.Errorf("got chart %s with %q", chart, got)
+	}
+	if _, err = m.chartReference("jetstack", "cert-manager", certManagerVersion); err == nil {
+		t.Error("expected an error for a chart missing in the repository")
+	}
+	if _, err = m.chartReference("ingress-nginx", "ingress-nginx", "2.3.0"); err == nil || !strings.Contains(err.Error(), "checksum") {
+		t.Errorf("got %v, want an error for a chart that doesn't match its checksum", err)
+	}
+}
@@ -0,0 +1,79 @@
+package capv
+
+import (
+	"github.com/netapp/cake/pkg/cluster-engine/provisioner"
+
+	"sigs.k8s.io/yaml"
+)
+
+// redacted replaces passwords in rendered manifests
+const redacted = "REDACTED"
+
+// Render returns the kind config, when kind is the bootstrap cluster, and every manifest deploy applies, in order, without connecting to
+// vSphere or any cluster. Templates are resolved from the catalog like deploy does. Manifests applied from a URL are a comment naming it. Passwords are
+// replaced unless showSecrets is set.
+func (m *MgmtCluster) Render(showSecrets bool) ([]provisioner.Manifest, error) {
+	c := *m
+	if !showSecrets {
+		c.VspherePassword = redacted
+		c.Addons.Solidfire.Password = redacted
+	}
+
+	_, err := c.resolveTemplates()
+	if err != nil {
+		return nil, err
+	}
+	spec, err := c.clusterSpec()
+	if err != nil {
+		return nil, err
+	}
+	var manifests []provisioner.Manifest
+	if c.Bootstrap.Kubeconfig == "" && !c.Bootstrap.HelperVM.Enable {
+		kindConfig, err := c.kindConfig()
+		if err != nil {
+			return nil, err
+		}
+		manifests = append(manifests, provisioner.Manifest{Name: kindConfigFile, Contents: kindConfig})
+	}
+	manifests = append(manifests,
+		provisioner.Manifest{Name: VsphereCredsSecret.Name, Contents: c.vsphereCredsSecret()},
+		provisioner.Manifest{Name: specFileName(c.ClusterName), Contents: spec},
+		remoteManifest("calico.yaml", calicoManifest),
+	)
+
+	if c.Addons.Solidfire.Enable {
+		manifests = append(manifests,
+			provisioner.Manifest{Name: elementBackendJSON.Name, Contents: c.tridentBackend()},
+			provisioner.Manifest{Name: elementStorageClass.Name, Contents: []byte(elementStorageClass.Contents + "\n")},
+		)
+	}
+
+	if r := c.Addons.Rancher; r.Enable {
+		if err = r.validate(); err != nil {
+			return nil, err
+		}
+		ingressValues, err := yaml.Marshal(ingressNginxValues())
+		if err != nil {
+			return nil, err
+		}
+		manifests = append(manifests,
+			provisioner.Manifest{Name: rancherNamespaces.Name, Contents: []byte(rancherNamespaces.Contents + "\n")},
+			provisioner.Manifest{Name: ingressNginxValuesFile, Contents: ingressValues},
+		)
+		if r.selfSigned() {
+			manifests = append(manifests, remoteManifest("cert-manager-crds.yaml", certManagerCRDs))
+		}
+		rancherValues, err := yaml.Marshal(r.values())
+		if err != nil {
+			return nil, err
+		}
+		manifests = append(manifests, provisioner.Manifest{Name: rancherValuesFile, Contents: rancherValues})
+	}
+
+	return manifests, nil
+}
+
+// remoteManifest is a manifest that's applied from a URL
+func remoteManifest(name, url string) provisioner.Manifest {
+	return provisioner.Manifest{Name: name, Contents: []byte("# applied from " + url + "\n")}
+}
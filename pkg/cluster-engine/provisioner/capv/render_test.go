@@ -0,0 +1,59 @@
+package capv
+
+import (
+	"bytes"
+	"reflect"
+	"testing"
+)
+
+func TestRender(t *testing.T) {
+	m := testCluster()
+	m.VspherePassword = "vsphere-password"
+	m.StorageNetwork = "storage"
+	m.Addons.Solidfire = Solidfire{Enable: true, User: "admin", Password: "solidfire-password", MVIP: "10.0.0.1", SVIP: "10.0.1.1"}
+	m.Addons.Rancher = Rancher{Enable: true, Hostname: "rancher.example.com"}
+
+	manifests, err := m.Render(false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var names []string
+	for _, manifest := range manifests {
+		names = append(names, manifest.Name)
+		for _, password := range []string{m.VspherePassword, m.Addons.Solidfire.Password} {
+			if bytes.Contains(manifest.Contents, []byte(password)) {
+				t.Errorf("%s: contains a password", manifest.Name)
+			}
+		}
+	}
+	want := []string{
+		kindConfigFile,
+		VsphereCredsSecret.Name,
+		specFileName(clusterName),
+		"calico.yaml",
+		elementBackendJSON.Name,
+		elementStorageClass.Name,
+		rancherNamespaces.Name,
+		ingressNginxValuesFile,
+		"cert-manager-crds.yaml",
+		rancherValuesFile,
+	}
+	if !reflect.DeepEqual(names, want) {
+		t.Errorf("got manifests %v, want %v", names, want)
+	}
+
+	manifests, err = m.Render(true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Contains(manifests[1].Contents, []byte(m.VspherePassword)) {
+		t.Errorf("expected the vSphere password with showSecrets")
+	}
+	spec, err := m.clusterSpec()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(manifests[2].Contents, spec) {
+		t.Errorf("expected the rendered spec to be the cluster spec")
+	}
+}
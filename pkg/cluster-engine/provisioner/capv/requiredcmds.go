@@ -18,16 +18,20 @@ var RequiredCommands = cmds.ProvisionerCommands{Name: "required CAPV bootstrap c
 
 // RequiredCommands checks the PATH for required commands
 func (mc *MgmtCluster) RequiredCommands() []string {
-	kd := cmds.NewCommandLine(nil, string(kind), nil, nil)
-	RequiredCommands.AddCommand(kd.CommandName, kd)
 	c := cmds.NewCommandLine(nil, string(clusterctl), nil, nil)
 	RequiredCommands.AddCommand(c.CommandName, c)
 	k := cmds.NewCommandLine(nil, string(kubectl), nil, nil)
 	RequiredCommands.AddCommand(k.CommandName, k)
-	d := cmds.NewCommandLine(nil, string(docker), nil, nil)
-	RequiredCommands.AddCommand(d.CommandName, d)
 
-	if mc.Addons.Observability.Enable {
+	// an existing bootstrap cluster or a helper VM doesn't need kind or docker
+	if mc.Bootstrap.Kubeconfig == "" && !mc.Bootstrap.HelperVM.Enable {
+		kd := cmds.NewCommandLine(nil, string(kind), nil, nil)
+		RequiredCommands.AddCommand(kd.CommandName, kd)
+		d := cmds.NewCommandLine(nil, string(docker), nil, nil)
+		RequiredCommands.AddCommand(d.CommandName, d)
+	}
+
+	if mc.Addons.Observability.Enable || mc.Addons.Rancher.Enable {
 		h := cmds.NewCommandLine(nil, string(helm), nil, nil)
 		RequiredCommands.AddCommand(h.CommandName, h)
 	}
@@ -0,0 +1,151 @@
+package capv
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/netapp/cake/pkg/cluster-engine/provisioner"
+	"github.com/netapp/cake/pkg/cmds"
+
+	clusterv3 "sigs.k8s.io/cluster-api/api/v1alpha3"
+)
+
+// validateScale checks the machine counts, the control plane needs an odd count to keep etcd quorum
+func validateScale(spec provisioner.ScaleSpec) error {
+	if spec.ControlPlaneMachineCount == nil && spec.WorkerMachineCount == nil {
+		return fmt.Errorf("no machine counts to scale to")
+	}
+	if c := spec.ControlPlaneMachineCount; c != nil && (*c < 1 || *c%2 == 0) {
+		return fmt.Errorf("control plane machine count must be odd and at least 1, got %d", *c)
+	}
+	if c := spec.WorkerMachineCount; c != nil && *c < 0 {
+		return fmt.Errorf("worker machine count can't be negative, got %d", *c)
+	}
+	return nil
+}
+
+// Scale sets the replicas of a cluster's KubeadmControlPlane and a node pool's MachineDeployment,
+// then waits for the machines to be running and the nodes to be ready
+func (m *MgmtCluster) Scale(spec provisioner.ScaleSpec) error {
+	err := validateScale(spec)
+	if err != nil {
+		return err
+	}
+	if spec.ClusterName == "" {
+		spec.ClusterName = m.ClusterName
+	}
+	if spec.NodePool == "" {
+		spec.NodePool = defaultNodePool
+	}
+	kubeConfig, err := m.managementKubeconfig()
+	if err != nil {
+		return err
+	}
+	envs := map[string]string{
+		"KUBECONFIG": kubeConfig,
+	}
+
+	controlPlaneCount, err := m.replicas(envs, "kubeadmcontrolplane", spec.ClusterName, spec.ControlPlaneMachineCount)
+	if err != nil {
+		return err
+	}
+	if spec.WorkerMachineCount != nil {
+		_, err = m.replicas(envs, "machinedeployment", nodePoolName(spec.ClusterName, spec.NodePool), spec.WorkerMachineCount)
+		if err != nil {
+			return err
+		}
+	}
+	var mds clusterv3.MachineDeploymentList
+	err = kubeGetJSON(envs, &mds, "machinedeployments", "--selector=cluster.x-k8s.io/cluster-name="+spec.ClusterName)
+	if err != nil {
+		return err
+	}
+	workerCount := 0
+	for _, md := range mds.Items {
+		if md.Spec.Replicas != nil {
+			workerCount += int(*md.Spec.Replicas)
+		}
+	}
+
+	m.events <- Event{EventType: "progress", Event: fmt.Sprintf("waiting for %d control plane and %d worker machines of %s", controlPlaneCount, workerCount, spec.ClusterName)}
+	timeout := 15 * time.Minute
+	args := []string{
+		"get",
+		"machine",
+		"--selector=cluster.x-k8s.io/cluster-name=" + spec.ClusterName,
+	}
+	err = m.whileAssigningAddresses(envs, spec.ClusterName, func() error {
+		return kubeRetry(envs, args, timeout, "Running", controlPlaneCount+workerCount, nil, m.events)
+	})
+	if err != nil {
+		return err
+	}
+
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return err
+	}
+	envs = map[string]string{
+		"KUBECONFIG": filepath.Join(home, ConfigDir, spec.ClusterName, "kubeconfig"),
+	}
+	args = []string{
+		"get",
+		"nodes",
+		`--output=jsonpath={range .items[*]}{.status.conditions[?(@.type=="Ready")].status}{"\n"}{end}`,
+	}
+	err = kubeRetry(envs, args, timeout, "True", controlPlaneCount+workerCount, nil, m.events)
+	if err != nil {
+		return err
+	}
+	err = m.tagMachines(kubeConfig, spec.ClusterName)
+	if err != nil {
+		return err
+	}
+	if spec.ControlPlaneMachineCount != nil {
+		err = m.clusterConfig(spec.ClusterName).applyAntiAffinityRules(kubeConfig)
+		if err != nil {
+			return err
+		}
+	}
+
+	m.events <- Event{EventType: "progress", Event: "scaled " + spec.ClusterName}
+	return err
+}
+
+// replicas patches the replicas of the named resource when count is set and returns the desired replicas
+func (m *MgmtCluster) replicas(envs map[string]string, resource, name string, count *int) (int, error) {
+	if count == nil {
+		args := []string{
+			"get",
+			resource,
+			name,
+			"--output=jsonpath={.spec.replicas}",
+		}
+		c := cmds.NewCommandLine(envs, string(kubectl), args, nil)
+		stdout, stderr, err := c.Program().Execute()
+		if err != nil || string(stderr) != "" {
+			return 0, fmt.Errorf("err: %v, stderr: %v, cmd: %v %v", err, string(stderr), c.CommandName, c.Args)
+		}
+		replicas, err := strconv.Atoi(strings.TrimSpace(string(stdout)))
+		if err != nil {
+			return 0, fmt.Errorf("unable to read %s %s replicas, %v", resource, name, err)
+		}
+		return replicas, nil
+	}
+
+	m.events <- Event{EventType: "progress", Event: fmt.Sprintf("scaling %s %s to %d", resource, name, *count)}
+	patch := map[string]interface{}{
+		"spec": map[string]interface{}{
+			"replicas": *count,
+		},
+	}
+	err := kubePatch(envs, resource, name, patch)
+	if err != nil {
+		return 0, err
+	}
+	return *count, nil
+}
@@ -0,0 +1,30 @@
+package capv
+
+import (
+	"testing"
+
+	"github.com/netapp/cake/pkg/cluster-engine/provisioner"
+)
+
+func TestValidateScale(t *testing.T) {
+	count := func(n int) *int { return &n }
+	tests := []struct {
+		name  string
+		spec  provisioner.ScaleSpec
+		valid bool
+	}{
+		{"nothing to scale", provisioner.ScaleSpec{}, false},
+		{"three control planes", provisioner.ScaleSpec{ControlPlaneMachineCount: count(3)}, true},
+		{"even control planes", provisioner.ScaleSpec{ControlPlaneMachineCount: count(2)}, false},
+		{"no control planes", provisioner.ScaleSpec{ControlPlaneMachineCount: count(0)}, false},
+		{"no workers", provisioner.ScaleSpec{WorkerMachineCount: count(0)}, true},
+		{"negative workers", provisioner.ScaleSpec{WorkerMachineCount: count(-1)}, false},
+		{"both", provisioner.ScaleSpec{ControlPlaneMachineCount: count(5), WorkerMachineCount: count(10)}, true},
+	}
+	for _, tt := range tests {
+		err := validateScale(tt.spec)
+		if (err == nil) != tt.valid {
+			t.Errorf("%s: got err %v, want valid %v", tt.name, err, tt.valid)
+		}
+	}
+}
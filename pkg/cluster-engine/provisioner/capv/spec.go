@@ -0,0 +1,612 @@
+package capv
+
+import (
+	"bytes"
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/netapp/cake/pkg/config/types"
+
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	v3 "sigs.k8s.io/cluster-api-provider-vsphere/api/v1alpha3"
+	"sigs.k8s.io/cluster-api-provider-vsphere/pkg/services/cloudprovider"
+	clusterv3 "sigs.k8s.io/cluster-api/api/v1alpha3"
+	bootstrapv3 "sigs.k8s.io/cluster-api/bootstrap/kubeadm/api/v1alpha3"
+	kubeadmv1beta1 "sigs.k8s.io/cluster-api/bootstrap/kubeadm/types/v1beta1"
+	capiv3 "sigs.k8s.io/cluster-api/controlplane/kubeadm/api/v1alpha3"
+	"sigs.k8s.io/yaml"
+)
+
+const (
+	// clusterNamespace is the namespace of the cluster's objects on the managing cluster
+	clusterNamespace = "default"
+	// defaultPodCidr is used when no KubernetesPodCidr is set
+	defaultPodCidr = "192.168.0.0/16"
+	// sshUser is the user created on the machines for the SshAuthorizedKey
+	sshUser = "capv"
+	// defaultNodePool is the pool of workers when no NodePools are configured, it's named like clusterctl's MachineDeployment
+	defaultNodePool = "md-0"
+	// nodePoolLabel is set on a node pool's MachineDeployment, machines and nodes
+	nodePoolLabel = "cake.netapp.io/node-pool"
+)
+
+var (
+	specSeparator      = regexp.MustCompile(`(?m)^---\s*$`)
+	nodePoolNameFormat = regexp.MustCompile(`^[a-z0-9]([-a-z0-9]*[a-z0-9])?$`)
+)
+
+// defaultMachineSize is the size of machines without a size profile, and of the load balancer
+var defaultMachineSize = types.MachineSize{NumCPUs: 2, MemoryMiB: 8192, DiskGiB: 25}
+
+// storageCommands install and start the iSCSI and multipath tools Trident needs on storage nodes
+var storageCommands = []string{
+	"apt-get update",
+	"apt-get install -y open-iscsi lsscsi sg3-utils multipath-tools scsitools",
+	`echo "defaults {\n    user_friendly_names yes\n    find_multipaths yes\n}" > /etc/multipath.conf`,
+	"systemctl enable multipath-tools.service",
+	"service multipath-tools restart",
+	"systemctl enable open-iscsi.service",
+	"service open-iscsi start",
+}
+
+// specObject holds the fields needed to identify a document in a spec
+type specObject struct {
+	Kind     string `json:"kind"`
+	Metadata struct {
+		Name string `json:"name"`
+	} `json:"metadata"`
+}
+
+// splitSpec splits a multi document yaml spec into its documents
+func splitSpec(spec []byte) [][]byte {
+	var docs [][]byte
+	for _, doc := range specSeparator.Split(string(spec), -1) {
+		if len(bytes.TrimSpace([]byte(doc))) == 0 {
+			continue
+		}
+		docs = append(docs, []byte(doc))
+	}
+	return docs
+}
+
+// joinSpec joins documents into a multi document yaml spec
+func joinSpec(docs [][]byte) []byte {
+	var spec bytes.Buffer
+	for i, doc := range docs {
+		if i > 0 {
+			spec.WriteString("---\n")
+		}
+		spec.Write(bytes.TrimLeft(doc, "\n"))
+		if !bytes.HasSuffix(doc, []byte("\n")) {
+			spec.WriteString("\n")
+		}
+	}
+	return spec.Bytes()
+}
+
+// nodePoolName is the name of the MachineDeployment, KubeadmConfigTemplate and VSphereMachineTemplate of a node pool
+func nodePoolName(clusterName, pool string) string {
+	return clusterName + "-" + pool
+}
+
+// nodePools returns the configured node pools, or a single pool of WorkerMachineCount
+// workers that are storage nodes when the Solidfire addon is enabled
+func (m *MgmtCluster) nodePools() ([]NodePool, error) {
+	pools := m.NodePools
+	if len(pools) == 0 {
+		replicas, err := strconv.Atoi(m.WorkerMachineCount)
+		if err != nil {
+			return nil, fmt.Errorf("invalid worker machine count %q", m.WorkerMachineCount)
+		}
+		pools = []NodePool{{Name: defaultNodePool, Replicas: replicas, Storage: m.Addons.Solidfire.Enable}}
+	}
+
+	names := map[string]bool{}
+	for _, pool := range pools {
+		if !nodePoolNameFormat.MatchString(pool.Name) {
+			return nil, fmt.Errorf("invalid node pool name %q, it must be lowercase alphanumeric or '-'", pool.Name)
+		}
+		if names[pool.Name] {
+			return nil, fmt.Errorf("node pool %s is defined more than once", pool.Name)
+		}
+		names[pool.Name] = true
+		if pool.Replicas < 0 {
+			return nil, fmt.Errorf("node pool %s replicas can't be negative, got %d", pool.Name, pool.Replicas)
+		}
+		if pool.Storage && m.StorageNetwork == "" {
+			return nil, fmt.Errorf("node pool %s is a storage pool but no StorageNetwork is set", pool.Name)
+		}
+		for _, taint := range pool.Taints {
+			switch v1.TaintEffect(taint.Effect) {
+			case v1.TaintEffectNoSchedule, v1.TaintEffectPreferNoSchedule, v1.TaintEffectNoExecute:
+			default:
+				return nil, fmt.Errorf("node pool %s taint %s has invalid effect %q", pool.Name, taint.Key, taint.Effect)
+			}
+		}
+	}
+	return pools, nil
+}
+
+// machineSizes resolves the control plane size profile and each node pool's, nil means the default size
+func (m *MgmtCluster) machineSizes(pools []NodePool) (*types.MachineSize, map[string]*types.MachineSize, error) {
+	var controlPlane *types.MachineSize
+	if m.ControlPlaneSize != "" {
+		size, err := types.LookupMachineSize(m.ControlPlaneSize, m.Sizes)
+		if err != nil {
+			return nil, nil, fmt.Errorf("control plane size: %v", err)
+		}
+		controlPlane = &size
+	}
+	workers := map[string]*types.MachineSize{}
+	for _, pool := range pools {
+		name := pool.Size
+		if name == "" {
+			name = m.WorkerSize
+		}
+		if name == "" {
+			continue
+		}
+		size, err := types.LookupMachineSize(name, m.Sizes)
+		if err != nil {
+			return nil, nil, fmt.Errorf("node pool %s size: %v", pool.Name, err)
+		}
+		workers[pool.Name] = &size
+	}
+	return controlPlane, workers, nil
+}
+
+// clusterSpec builds the cluster's manifests, the objects of clusterctl's vSphere template
+// with the control plane sized and a MachineDeployment for each node pool
+func (m *MgmtCluster) clusterSpec() ([]byte, error) {
+	objs, err := m.clusterObjects()
+	if err != nil {
+		return nil, err
+	}
+	var docs [][]byte
+	for _, obj := range objs {
+		doc, err := yaml.Marshal(obj)
+		if err != nil {
+			return nil, fmt.Errorf("unable to write %s %s, %v", obj.Kind, obj.Metadata.Name, err)
+		}
+		docs = append(docs, doc)
+	}
+	return joinSpec(docs), nil
+}
+
+// clusterObjects returns the cluster's objects in the order they're applied
+func (m *MgmtCluster) clusterObjects() ([]manifest, error) {
+	pools, err := m.nodePools()
+	if err != nil {
+		return nil, err
+	}
+	controlPlaneSize, workerSizes, err := m.machineSizes(pools)
+	if err != nil {
+		return nil, err
+	}
+	replicas, err := strconv.Atoi(m.ControlPlaneMachineCount)
+	if err != nil {
+		return nil, fmt.Errorf("invalid control plane machine count %q", m.ControlPlaneMachineCount)
+	}
+
+	lb := m.haproxyLoadBalancer()
+	vsphereCluster := m.vsphereCluster(lb)
+
+	var cpNetworks []string
+	if m.Addons.Solidfire.Enable {
+		cpNetworks = append(cpNetworks, m.StorageNetwork)
+	}
+	cpTemplate := m.machineTemplate(m.ClusterName, m.NodeTemplate, controlPlaneSize, cpNetworks)
+	kcp := m.kubeadmControlPlane(int32(replicas), cpTemplate)
+	if m.Addons.Solidfire.Enable {
+		kcp.Spec.KubeadmConfigSpec.PostKubeadmCommands = append(kcp.Spec.KubeadmConfigSpec.PostKubeadmCommands, storageCommands...)
+	}
+	cluster := m.cluster(vsphereCluster, kcp)
+
+	objs := []manifest{
+		newManifest(cluster.TypeMeta, cluster.ObjectMeta, cluster.Spec),
+		newManifest(lb.TypeMeta, lb.ObjectMeta, lb.Spec),
+		newManifest(vsphereCluster.TypeMeta, vsphereCluster.ObjectMeta, vsphereCluster.Spec),
+		newManifest(cpTemplate.TypeMeta, cpTemplate.ObjectMeta, cpTemplate.Spec),
+		newManifest(kcp.TypeMeta, kcp.ObjectMeta, kcp.Spec),
+	}
+	for _, pool := range pools {
+		template := m.poolMachineTemplate(pool, workerSizes[pool.Name])
+		config := m.poolConfigTemplate(pool)
+		md := m.poolMachineDeployment(pool, template, config)
+		objs = append(objs,
+			newManifest(template.TypeMeta, template.ObjectMeta, template.Spec),
+			newManifest(config.TypeMeta, config.ObjectMeta, config.Spec),
+			newManifest(md.TypeMeta, md.ObjectMeta, md.Spec),
+		)
+	}
+	return objs, nil
+}
+
+func (m *MgmtCluster) cluster(vsphereCluster *v3.VSphereCluster, kcp *capiv3.KubeadmControlPlane) *clusterv3.Cluster {
+	podCidr := m.KubernetesPodCidr
+	if podCidr == "" {
+		podCidr = defaultPodCidr
+	}
+	cluster := &clusterv3.Cluster{
+		TypeMeta: metav1.TypeMeta{
+			APIVersion: clusterv3.GroupVersion.String(),
+			Kind:       "Cluster",
+		},
+		ObjectMeta: m.objectMeta(m.ClusterName, nil),
+		Spec: clusterv3.ClusterSpec{
+			ClusterNetwork: &clusterv3.ClusterNetwork{
+				Pods: &clusterv3.NetworkRanges{
+					CIDRBlocks: []string{podCidr},
+				},
+			},
+			ControlPlaneRef:   objectReference(kcp.TypeMeta, kcp.Name),
+			InfrastructureRef: objectReference(vsphereCluster.TypeMeta, vsphereCluster.Name),
+		},
+	}
+	if m.KubernetesServiceCidr != "" {
+		cluster.Spec.ClusterNetwork.Services = &clusterv3.NetworkRanges{
+			CIDRBlocks: []string{m.KubernetesServiceCidr},
+		}
+	}
+	return cluster
+}
+
+func (m *MgmtCluster) haproxyLoadBalancer() *v3.HAProxyLoadBalancer {
+	clone := m.cloneSpec(m.LoadBalancerTemplate)
+	if a := m.loadBalancerAddress; a != nil {
+		clone.Network.Devices[0].IPAddrs = []string{a.CIDR()}
+		clone.Network.Devices[0].Gateway4 = a.Gateway
+		clone.Network.Devices[0].Nameservers = a.Nameservers
+	}
+	return &v3.HAProxyLoadBalancer{
+		TypeMeta: metav1.TypeMeta{
+			APIVersion: v3.GroupVersion.String(),
+			Kind:       "HAProxyLoadBalancer",
+		},
+		ObjectMeta: m.objectMeta(m.ClusterName, m.clusterLabels()),
+		Spec: v3.HAProxyLoadBalancerSpec{
+			VirtualMachineConfiguration: clone,
+			User: &v3.SSHUser{
+				Name:           sshUser,
+				AuthorizedKeys: []string{m.SSHAuthorizedKey},
+			},
+		},
+	}
+}
+
+func (m *MgmtCluster) vsphereCluster(lb *v3.HAProxyLoadBalancer) *v3.VSphereCluster {
+	return &v3.VSphereCluster{
+		TypeMeta: metav1.TypeMeta{
+			APIVersion: v3.GroupVersion.String(),
+			Kind:       "VSphereCluster",
+		},
+		ObjectMeta: m.objectMeta(m.ClusterName, nil),
+		Spec: v3.VSphereClusterSpec{
+			Server: m.VcenterServer,
+			CloudProviderConfiguration: v3.CPIConfig{
+				Global: v3.CPIGlobalConfig{
+					SecretName:      "cloud-provider-vsphere-credentials",
+					SecretNamespace: metav1.NamespaceSystem,
+					Insecure:        true,
+				},
+				VCenter: map[string]v3.CPIVCenterConfig{
+					m.VcenterServer: {Datacenters: m.Datacenter},
+				},
+				Network: v3.CPINetworkConfig{
+					Name: m.ManagementNetwork,
+				},
+				Workspace: v3.CPIWorkspaceConfig{
+					Server:       m.VcenterServer,
+					Datacenter:   m.Datacenter,
+					Datastore:    m.Datastore,
+					ResourcePool: m.ResourcePool,
+					Folder:       m.Folder,
+				},
+				ProviderConfig: v3.CPIProviderConfig{
+					Cloud: &v3.CPICloudConfig{
+						ControllerImage: cloudprovider.DefaultCPIControllerImage,
+					},
+					Storage: &v3.CPIStorageConfig{
+						ControllerImage:     cloudprovider.DefaultCSIControllerImage,
+						NodeDriverImage:     cloudprovider.DefaultCSINodeDriverImage,
+						AttacherImage:       cloudprovider.DefaultCSIAttacherImage,
+						ProvisionerImage:    cloudprovider.DefaultCSIProvisionerImage,
+						MetadataSyncerImage: cloudprovider.DefaultCSIMetadataSyncerImage,
+						LivenessProbeImage:  cloudprovider.DefaultCSILivenessProbeImage,
+						RegistrarImage:      cloudprovider.DefaultCSIRegistrarImage,
+					},
+				},
+			},
+			LoadBalancerRef: objectReference(lb.TypeMeta, lb.Name),
+		},
+	}
+}
+
+// cloneSpec is the clone spec of the cluster's virtual machines, with the management network.
+// With static addresses each machine's management address is assigned when it's created.
+func (m *MgmtCluster) cloneSpec(template string) v3.VirtualMachineCloneSpec {
+	return v3.VirtualMachineCloneSpec{
+		Datacenter: m.Datacenter,
+		Network: v3.NetworkSpec{
+			Devices: []v3.NetworkDeviceSpec{
+				{
+					NetworkName: m.ManagementNetwork,
+					DHCP4:       !m.staticAddresses(),
+				},
+			},
+		},
+		CloneMode:    v3.LinkedClone,
+		NumCPUs:      defaultMachineSize.NumCPUs,
+		DiskGiB:      defaultMachineSize.DiskGiB,
+		MemoryMiB:    defaultMachineSize.MemoryMiB,
+		Template:     template,
+		Server:       m.VcenterServer,
+		ResourcePool: m.ResourcePool,
+		Datastore:    m.Datastore,
+		Folder:       m.Folder,
+	}
+}
+
+// machineTemplate returns a VSphereMachineTemplate cloning the node template, the workload network, when it's not
+// the management network, and the networks are attached after the management network
+func (m *MgmtCluster) machineTemplate(name, nodeTemplate string, size *types.MachineSize, networks []string) *v3.VSphereMachineTemplate {
+	clone := m.cloneSpec(nodeTemplate)
+	setMachineSize(&clone, size)
+	if m.WorkloadNetwork != "" && m.WorkloadNetwork != m.ManagementNetwork {
+		networks = append([]string{m.WorkloadNetwork}, networks...)
+	}
+	for _, network := range networks {
+		clone.Network.Devices = append(clone.Network.Devices, v3.NetworkDeviceSpec{
+			NetworkName: network,
+			DHCP4:       true,
+		})
+	}
+	return &v3.VSphereMachineTemplate{
+		TypeMeta: metav1.TypeMeta{
+			APIVersion: v3.GroupVersion.String(),
+			Kind:       "VSphereMachineTemplate",
+		},
+		ObjectMeta: m.objectMeta(name, nil),
+		Spec: v3.VSphereMachineTemplateSpec{
+			Template: v3.VSphereMachineTemplateResource{
+				Spec: v3.VSphereMachineSpec{
+					VirtualMachineCloneSpec: clone,
+				},
+			},
+		},
+	}
+}
+
+func (m *MgmtCluster) kubeadmControlPlane(replicas int32, template *v3.VSphereMachineTemplate) *capiv3.KubeadmControlPlane {
+	return &capiv3.KubeadmControlPlane{
+		TypeMeta: metav1.TypeMeta{
+			APIVersion: capiv3.GroupVersion.String(),
+			Kind:       "KubeadmControlPlane",
+		},
+		ObjectMeta: m.objectMeta(m.ClusterName, nil),
+		Spec: capiv3.KubeadmControlPlaneSpec{
+			Replicas:               &replicas,
+			Version:                m.KubernetesVersion,
+			InfrastructureTemplate: *objectReference(template.TypeMeta, template.Name),
+			KubeadmConfigSpec: bootstrapv3.KubeadmConfigSpec{
+				InitConfiguration: &kubeadmv1beta1.InitConfiguration{
+					NodeRegistration: nodeRegistration(),
+				},
+				JoinConfiguration: &kubeadmv1beta1.JoinConfiguration{
+					NodeRegistration: nodeRegistration(),
+				},
+				ClusterConfiguration: &kubeadmv1beta1.ClusterConfiguration{
+					APIServer: kubeadmv1beta1.APIServer{
+						ControlPlaneComponent: kubeadmv1beta1.ControlPlaneComponent{
+							ExtraArgs: cloudProviderArgs(),
+						},
+					},
+					ControllerManager: kubeadmv1beta1.ControlPlaneComponent{
+						ExtraArgs: cloudProviderArgs(),
+					},
+				},
+				Users:              m.users(),
+				PreKubeadmCommands: preKubeadmCommands(),
+			},
+		},
+	}
+}
+
+// poolMachineTemplate returns a node pool's VSphereMachineTemplate, storage pools get a NIC on the storage network
+func (m *MgmtCluster) poolMachineTemplate(pool NodePool, size *types.MachineSize) *v3.VSphereMachineTemplate {
+	nodeTemplate := pool.Template
+	if nodeTemplate == "" {
+		nodeTemplate = m.NodeTemplate
+	}
+	networks := append([]string{}, pool.Networks...)
+	if pool.Storage {
+		networks = append(networks, m.StorageNetwork)
+	}
+	return m.machineTemplate(nodePoolName(m.ClusterName, pool.Name), nodeTemplate, size, networks)
+}
+
+// poolConfigTemplate returns a node pool's KubeadmConfigTemplate, registering its nodes
+// with the pool's labels and taints and installing the iSCSI tools on storage nodes
+func (m *MgmtCluster) poolConfigTemplate(pool NodePool) *bootstrapv3.KubeadmConfigTemplate {
+	registration := nodeRegistration()
+	labels := []string{nodePoolLabel + "=" + pool.Name}
+	for k, v := range pool.Labels {
+		labels = append(labels, k+"="+v)
+	}
+	sort.Strings(labels)
+	registration.KubeletExtraArgs["node-labels"] = strings.Join(labels, ",")
+	for _, taint := range pool.Taints {
+		registration.Taints = append(registration.Taints, v1.Taint{
+			Key:    taint.Key,
+			Value:  taint.Value,
+			Effect: v1.TaintEffect(taint.Effect),
+		})
+	}
+
+	spec := bootstrapv3.KubeadmConfigSpec{
+		JoinConfiguration: &kubeadmv1beta1.JoinConfiguration{
+			NodeRegistration: registration,
+		},
+		Users:              m.users(),
+		PreKubeadmCommands: preKubeadmCommands(),
+	}
+	if pool.Storage {
+		spec.PostKubeadmCommands = append(spec.PostKubeadmCommands, storageCommands...)
+	}
+	return &bootstrapv3.KubeadmConfigTemplate{
+		TypeMeta: metav1.TypeMeta{
+			APIVersion: bootstrapv3.GroupVersion.String(),
+			Kind:       "KubeadmConfigTemplate",
+		},
+		ObjectMeta: m.objectMeta(nodePoolName(m.ClusterName, pool.Name), nil),
+		Spec: bootstrapv3.KubeadmConfigTemplateSpec{
+			Template: bootstrapv3.KubeadmConfigTemplateResource{
+				Spec: spec,
+			},
+		},
+	}
+}
+
+// poolMachineDeployment returns a node pool's MachineDeployment, its machines are selected by the node pool label
+func (m *MgmtCluster) poolMachineDeployment(pool NodePool, template *v3.VSphereMachineTemplate, config *bootstrapv3.KubeadmConfigTemplate) *clusterv3.MachineDeployment {
+	replicas := int32(pool.Replicas)
+	version := m.KubernetesVersion
+	poolLabels := func() map[string]string {
+		labels := m.clusterLabels()
+		labels[nodePoolLabel] = pool.Name
+		return labels
+	}
+	return &clusterv3.MachineDeployment{
+		TypeMeta: metav1.TypeMeta{
+			APIVersion: clusterv3.GroupVersion.String(),
+			Kind:       "MachineDeployment",
+		},
+		ObjectMeta: m.objectMeta(nodePoolName(m.ClusterName, pool.Name), poolLabels()),
+		Spec: clusterv3.MachineDeploymentSpec{
+			ClusterName: m.ClusterName,
+			Replicas:    &replicas,
+			Selector: metav1.LabelSelector{
+				MatchLabels: poolLabels(),
+			},
+			Template: clusterv3.MachineTemplateSpec{
+				ObjectMeta: clusterv3.ObjectMeta{
+					Labels: poolLabels(),
+				},
+				Spec: clusterv3.MachineSpec{
+					ClusterName: m.ClusterName,
+					Version:     &version,
+					Bootstrap: clusterv3.Bootstrap{
+						ConfigRef: objectReference(config.TypeMeta, config.Name),
+					},
+					InfrastructureRef: *objectReference(template.TypeMeta, template.Name),
+				},
+			},
+		},
+	}
+}
+
+func (m *MgmtCluster) objectMeta(name string, labels map[string]string) metav1.ObjectMeta {
+	return metav1.ObjectMeta{
+		Name:      name,
+		Namespace: clusterNamespace,
+		Labels:    labels,
+	}
+}
+
+func (m *MgmtCluster) clusterLabels() map[string]string {
+	return map[string]string{clusterv3.ClusterLabelName: m.ClusterName}
+}
+
+func (m *MgmtCluster) users() []bootstrapv3.User {
+	sudo := "ALL=(ALL) NOPASSWD:ALL"
+	return []bootstrapv3.User{
+		{
+			Name:              sshUser,
+			Sudo:              &sudo,
+			SSHAuthorizedKeys: []string{m.SSHAuthorizedKey},
+		},
+	}
+}
+
+func objectReference(typeMeta metav1.TypeMeta, name string) *v1.ObjectReference {
+	return &v1.ObjectReference{
+		APIVersion: typeMeta.APIVersion,
+		Kind:       typeMeta.Kind,
+		Name:       name,
+	}
+}
+
+func nodeRegistration() kubeadmv1beta1.NodeRegistrationOptions {
+	return kubeadmv1beta1.NodeRegistrationOptions{
+		Name:             "{{ ds.meta_data.hostname }}",
+		CRISocket:        "/var/run/containerd/containerd.sock",
+		KubeletExtraArgs: cloudProviderArgs(),
+	}
+}
+
+func cloudProviderArgs() map[string]string {
+	return map[string]string{
+		"cloud-provider": "external",
+	}
+}
+
+// preKubeadmCommands set the machine's hostname from the vSphere metadata
+func preKubeadmCommands() []string {
+	return []string{
+		`hostname "{{ ds.meta_data.hostname }}"`,
+		`echo "::1         ipv6-localhost ipv6-loopback" >/etc/hosts`,
+		`echo "127.0.0.1   localhost" >>/etc/hosts`,
+		`echo "127.0.0.1   {{ ds.meta_data.hostname }}" >>/etc/hosts`,
+		`echo "{{ ds.meta_data.hostname }}" >/etc/hostname`,
+	}
+}
+
+// manifest is a document of the cluster's spec, the API types marshal their status and
+// creation timestamp without omitempty so only the type, metadata and spec are kept
+type manifest struct {
+	metav1.TypeMeta `json:",inline"`
+	Metadata        manifestMeta `json:"metadata"`
+	Spec            interface{}  `json:"spec"`
+}
+
+type manifestMeta struct {
+	Name      string            `json:"name"`
+	Namespace string            `json:"namespace"`
+	Labels    map[string]string `json:"labels,omitempty"`
+}
+
+func newManifest(typeMeta metav1.TypeMeta, objectMeta metav1.ObjectMeta, spec interface{}) manifest {
+	return manifest{
+		TypeMeta: typeMeta,
+		Metadata: manifestMeta{
+			Name:      objectMeta.Name,
+			Namespace: objectMeta.Namespace,
+			Labels:    objectMeta.Labels,
+		},
+		Spec: spec,
+	}
+}
+
+// setMachineSize sets the hardware of a clone spec, the disk only grows with a full clone so it's left to
+// the sizes that ask for one, linked clones keep the template's disk
+func setMachineSize(spec *v3.VirtualMachineCloneSpec, size *types.MachineSize) {
+	if size == nil {
+		return
+	}
+	if size.NumCPUs > 0 {
+		spec.NumCPUs = size.NumCPUs
+	}
+	if size.MemoryMiB > 0 {
+		spec.MemoryMiB = size.MemoryMiB
+	}
+	if size.DiskGiB > 0 {
+		spec.DiskGiB = size.DiskGiB
+	}
+	if size.FullClone {
+		spec.CloneMode = v3.FullClone
+	}
+}
@@ -0,0 +1,230 @@
+package capv
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/netapp/cake/pkg/config/types"
+
+	v3 "sigs.k8s.io/cluster-api-provider-vsphere/api/v1alpha3"
+	clusterv3 "sigs.k8s.io/cluster-api/api/v1alpha3"
+	bootstrapv3 "sigs.k8s.io/cluster-api/bootstrap/kubeadm/api/v1alpha3"
+	capiv3 "sigs.k8s.io/cluster-api/controlplane/kubeadm/api/v1alpha3"
+	"sigs.k8s.io/yaml"
+)
+
+func TestClusterSpec(t *testing.T) {
+	m := testCluster()
+	m.Addons.Solidfire.Enable = true
+	m.ControlPlaneSize = "medium"
+	m.WorkerSize = "large"
+	m.StorageNetwork = "storage"
+	m.Sizes = map[string]types.MachineSize{"xlarge": {NumCPUs: 16, MemoryMiB: 65536, DiskGiB: 200, FullClone: true}}
+	m.NodePools = []NodePool{
+		{Name: "general", Replicas: 3},
+		{
+			Name:     "storage",
+			Replicas: 2,
+			Size:     "xlarge",
+			Template: "ubuntu-1804-kube-v1.17.3-storage",
+			Networks: []string{"backup"},
+			Labels:   map[string]string{"role": "storage"},
+			Taints:   []Taint{{Key: "storage", Value: "true", Effect: "NoSchedule"}},
+			Storage:  true,
+		},
+	}
+
+	spec, err := m.clusterSpec()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	templates := map[string]v3.VSphereMachineTemplate{}
+	configs := map[string]bootstrapv3.KubeadmConfigTemplate{}
+	mds := map[string]clusterv3.MachineDeployment{}
+	var kcp capiv3.KubeadmControlPlane
+	for _, doc := range splitSpec(spec) {
+		var obj specObject
+		if err := yaml.Unmarshal(doc, &obj); err != nil {
+			t.Fatal(err)
+		}
+		switch obj.Kind {
+		case "VSphereMachineTemplate":
+			var template v3.VSphereMachineTemplate
+			if err := yaml.Unmarshal(doc, &template); err != nil {
+				t.Fatal(err)
+			}
+			templates[template.Name] = template
+		case "KubeadmConfigTemplate":
+			var config bootstrapv3.KubeadmConfigTemplate
+			if err := yaml.Unmarshal(doc, &config); err != nil {
+				t.Fatal(err)
+			}
+			configs[config.Name] = config
+		case "KubeadmControlPlane":
+			if err := yaml.Unmarshal(doc, &kcp); err != nil {
+				t.Fatal(err)
+			}
+		case "MachineDeployment":
+			var md clusterv3.MachineDeployment
+			if err := yaml.Unmarshal(doc, &md); err != nil {
+				t.Fatal(err)
+			}
+			mds[md.Name] = md
+		}
+	}
+	if len(templates) != 3 || len(configs) != 2 || len(mds) != 2 {
+		t.Fatalf("got %d VSphereMachineTemplates, %d KubeadmConfigTemplates and %d MachineDeployments, want 3, 2 and 2", len(templates), len(configs), len(mds))
+	}
+
+	general := nodePoolName(clusterName, "general")
+	storage := nodePoolName(clusterName, "storage")
+	sizes := map[string]types.MachineSize{
+		clusterName: types.DefaultMachineSizes["medium"],
+		general:     types.DefaultMachineSizes["large"],
+		storage:     m.Sizes["xlarge"],
+	}
+	for name, want := range sizes {
+		template, ok := templates[name]
+		if !ok {
+			t.Fatalf("VSphereMachineTemplate %s not found", name)
+		}
+		got := template.Spec.Template.Spec
+		if got.NumCPUs != want.NumCPUs || got.MemoryMiB != want.MemoryMiB || got.DiskGiB != want.DiskGiB {
+			t.Errorf("%s: got %d CPUs, %d MiB, %d GiB, want %+v", name, got.NumCPUs, got.MemoryMiB, got.DiskGiB, want)
+		}
+		wantMode := v3.LinkedClone
+		if want.FullClone {
+			wantMode = v3.FullClone
+		}
+		if got.CloneMode != wantMode {
+			t.Errorf("%s: got clone mode %s, want %s", name, got.CloneMode, wantMode)
+		}
+	}
+
+	if n := len(templates[clusterName].Spec.Template.Spec.Network.Devices); n != 2 {
+		t.Errorf("control plane: got %d network devices, want the storage network added", n)
+	}
+	if !reflect.DeepEqual(kcp.Spec.KubeadmConfigSpec.PostKubeadmCommands, storageCommands) {
+		t.Errorf("control plane: got commands %v, want the storage commands", kcp.Spec.KubeadmConfigSpec.PostKubeadmCommands)
+	}
+	if n := len(templates[general].Spec.Template.Spec.Network.Devices); n != 1 {
+		t.Errorf("%s: got %d network devices, want 1", general, n)
+	}
+	storageSpec := templates[storage].Spec.Template.Spec
+	if storageSpec.Template != "ubuntu-1804-kube-v1.17.3-storage" {
+		t.Errorf("%s: got template %s", storage, storageSpec.Template)
+	}
+	var networks []string
+	for _, d := range storageSpec.Network.Devices {
+		networks = append(networks, d.NetworkName)
+	}
+	if want := []string{"NetApp HCI VDS 01-HCI_Internal_mNode_Network", "backup", "storage"}; !reflect.DeepEqual(networks, want) {
+		t.Errorf("%s: got networks %v, want %v", storage, networks, want)
+	}
+
+	if len(configs[general].Spec.Template.Spec.PostKubeadmCommands) != 0 {
+		t.Errorf("%s: expected no storage commands", general)
+	}
+	storageConfig := configs[storage].Spec.Template.Spec
+	if !reflect.DeepEqual(storageConfig.PostKubeadmCommands, storageCommands) {
+		t.Errorf("%s: got commands %v, want the storage commands", storage, storageConfig.PostKubeadmCommands)
+	}
+	registration := storageConfig.JoinConfiguration.NodeRegistration
+	if got := registration.KubeletExtraArgs["node-labels"]; got != nodePoolLabel+"=storage,role=storage" {
+		t.Errorf("%s: got node labels %s", storage, got)
+	}
+	if len(registration.Taints) != 1 || registration.Taints[0].Key != "storage" || registration.Taints[0].Effect != "NoSchedule" {
+		t.Errorf("%s: got taints %v", storage, registration.Taints)
+	}
+
+	md := mds[storage]
+	if *md.Spec.Replicas != 2 || md.Spec.Template.Spec.InfrastructureRef.Name != storage || md.Spec.Template.Spec.Bootstrap.ConfigRef.Name != storage {
+		t.Errorf("%s: got %d replicas referencing %s and %s", storage, *md.Spec.Replicas, md.Spec.Template.Spec.InfrastructureRef.Name, md.Spec.Template.Spec.Bootstrap.ConfigRef.Name)
+	}
+	if md.Spec.Selector.MatchLabels[nodePoolLabel] != "storage" || md.Spec.Template.Labels[nodePoolLabel] != "storage" {
+		t.Errorf("%s: expected the node pool label on the selector and machines", storage)
+	}
+}
+
+func TestWorkloadNetwork(t *testing.T) {
+	m := testCluster()
+	m.WorkloadNetwork = "workload"
+	m.NodePools = []NodePool{{Name: "general", Replicas: 1, Networks: []string{"backup"}}}
+	objs, err := m.clusterObjects()
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := map[string][]string{
+		clusterName:                          {m.ManagementNetwork, "workload"},
+		nodePoolName(clusterName, "general"): {m.ManagementNetwork, "workload", "backup"},
+	}
+	for _, obj := range objs {
+		template, ok := obj.Spec.(v3.VSphereMachineTemplateSpec)
+		if !ok {
+			continue
+		}
+		var networks []string
+		for _, d := range template.Template.Spec.Network.Devices {
+			networks = append(networks, d.NetworkName)
+		}
+		if !reflect.DeepEqual(networks, want[obj.Metadata.Name]) {
+			t.Errorf("%s: got networks %v, want %v", obj.Metadata.Name, networks, want[obj.Metadata.Name])
+		}
+	}
+
+	m.WorkloadNetwork = m.ManagementNetwork
+	template := m.machineTemplate(clusterName, m.NodeTemplate, nil, nil)
+	if n := len(template.Spec.Template.Spec.Network.Devices); n != 1 {
+		t.Errorf("got %d network devices, want the workload network on the management network's NIC", n)
+	}
+}
+
+func TestNodePools(t *testing.T) {
+	m := &MgmtCluster{}
+	m.WorkerMachineCount = "2"
+	m.Addons.Solidfire.Enable = true
+	m.StorageNetwork = "storage"
+	pools, err := m.nodePools()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []NodePool{{Name: defaultNodePool, Replicas: 2, Storage: true}}; !reflect.DeepEqual(pools, want) {
+		t.Errorf("got %+v, want %+v", pools, want)
+	}
+
+	tests := map[string][]NodePool{
+		"invalid name":   {{Name: "Big_Pool"}},
+		"duplicate name": {{Name: "a"}, {Name: "a"}},
+		"negative":       {{Name: "a", Replicas: -1}},
+		"taint effect":   {{Name: "a", Taints: []Taint{{Key: "a", Effect: "Never"}}}},
+	}
+	for name, pools := range tests {
+		m.NodePools = pools
+		if _, err := m.nodePools(); err == nil {
+			t.Errorf("%s: expected an error", name)
+		}
+	}
+
+	m.StorageNetwork = ""
+	m.NodePools = []NodePool{{Name: "a", Storage: true}}
+	if _, err := m.nodePools(); err == nil {
+		t.Errorf("expected an error for a storage pool without a storage network")
+	}
+}
+
+func TestLookupMachineSize(t *testing.T) {
+	sizes := map[string]types.MachineSize{"xlarge": {NumCPUs: 16}}
+
+	size, err := types.LookupMachineSize("XLarge", sizes)
+	if err != nil || size.NumCPUs != 16 {
+		t.Errorf("got %+v, %v, want the configured xlarge size", size, err)
+	}
+	size, err = types.LookupMachineSize("small", sizes)
+	if err != nil || size != types.DefaultMachineSizes["small"] {
+		t.Errorf("got %+v, %v, want the default small size", size, err)
+	}
+	if _, err = types.LookupMachineSize("huge", sizes); err == nil {
+		t.Errorf("expected an error for an unknown size")
+	}
+}
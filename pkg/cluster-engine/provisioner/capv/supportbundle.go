@@ -0,0 +1,292 @@
+package capv
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/netapp/cake/pkg/cmds"
+)
+
+// bundleTimeFormat is the layout of the timestamp in support bundle names
+const bundleTimeFormat = "20060102T150405Z"
+
+// bundleResources are described from the bootstrap and permanent clusters
+var bundleResources = []string{
+	"clusters.cluster.x-k8s.io",
+	"machines.cluster.x-k8s.io",
+	"machinedeployments.cluster.x-k8s.io",
+	"machinesets.cluster.x-k8s.io",
+	"kubeadmcontrolplanes.controlplane.cluster.x-k8s.io",
+	"kubeadmconfigs.bootstrap.cluster.x-k8s.io",
+	"vsphereclusters.infrastructure.cluster.x-k8s.io",
+	"vspheremachines.infrastructure.cluster.x-k8s.io",
+	"vspherevms.infrastructure.cluster.x-k8s.io",
+	"haproxyloadbalancers.infrastructure.cluster.x-k8s.io",
+}
+
+// bundleLocalFiles are copied from the cluster's directory, kubeconfigs, keys and credentials are left out
+var bundleLocalFiles = []string{kindConfigFile}
+
+// secretFields matches kubeconfig credentials and password, token and key fields in YAML, JSON and logs
+var secretFields = regexp.MustCompile(`(?i)((?:client-key-data|client-certificate-data|certificate-authority-data|token|password|secret|tls\.key)"?\s*[:=]\s*"?)[^\s",]+`)
+
+// redact replaces the known secret values and anything that looks like a credential
+func redact(data []byte, secrets []string) []byte {
+	for _, s := range secrets {
+		if s != "" {
+			data = bytes.ReplaceAll(data, []byte(s), []byte(redacted))
+		}
+	}
+	return secretFields.ReplaceAll(data, []byte("${1}"+redacted))
+}
+
+// secrets returns the passwords and keys from the config
+func (m *MgmtCluster) secrets() []string {
+	return []string{
+		m.VspherePassword,
+		m.Addons.Solidfire.Password,
+		m.Addons.Rancher.BootstrapPassword,
+		m.Addons.Rancher.TLSKey,
+		m.IPAM.MNode.AuthSecret,
+		m.Bintray.Token,
+	}
+}
+
+// supportBundle collects the bundle's files, a failure to collect one is recorded in errors.txt instead
+type supportBundle struct {
+	root   string
+	files  []tarFile
+	errors []string
+}
+
+func (b *supportBundle) add(name string, contents []byte) {
+	b.files = append(b.files, tarFile{Name: b.root + "/" + name, Contents: contents})
+}
+
+func (b *supportBundle) addErr(name string, err error) {
+	b.errors = append(b.errors, fmt.Sprintf("%s: %v", name, err))
+}
+
+// addCommand adds the output of a command, or its error
+func (b *supportBundle) addCommand(name string, envs map[string]string, command requiredCmd, args ...string) {
+	c := cmds.NewCommandLine(envs, string(command), args, nil)
+	stdout, stderr, err := c.Program().Execute()
+	if err != nil {
+		b.addErr(name, fmt.Errorf("err: %v, stderr: %v, cmd: %v %v", err, string(stderr), c.CommandName, c.Args))
+		if len(stdout) == 0 {
+			return
+		}
+	}
+	b.add(name, stdout)
+}
+
+// SupportBundle collects the cake log, the kind logs, the state of the Cluster API objects and the provider
+// controller logs from the bootstrap and permanent clusters, and the vSphere tasks of the cluster's virtual
+// machines into a timestamped tar.gz in the directory. Secrets are redacted. It returns the bundle's path.
+func (m *MgmtCluster) SupportBundle(dir string) (string, error) {
+	now := time.Now().UTC()
+	name := fmt.Sprintf("cake-support-bundle-%s-%s", m.ClusterName, now.Format(bundleTimeFormat))
+	b := &supportBundle{root: name}
+
+	if m.LogFile != "" {
+		m.events <- Event{EventType: "progress", Event: "collecting the cake log"}
+		if log, err := ioutil.ReadFile(m.LogFile); err == nil {
+			b.add("cake.log", log)
+		} else {
+			b.addErr("cake.log", err)
+		}
+	}
+
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "", err
+	}
+	clusterDir := filepath.Join(home, ConfigDir, m.ClusterName)
+	for _, f := range append(bundleLocalFiles, specFileName(m.ClusterName)) {
+		if contents, err := ioutil.ReadFile(filepath.Join(clusterDir, f)); err == nil {
+			b.add("files/"+f, contents)
+		}
+	}
+
+	if m.Bootstrap.Kubeconfig == "" && !m.Bootstrap.HelperVM.Enable {
+		m.collectKindLogs(b)
+	}
+	kubeConfigs := map[string]string{
+		"bootstrap": filepath.Join(clusterDir, bootstrapKubeconfig),
+		"permanent": filepath.Join(clusterDir, "kubeconfig"),
+	}
+	for _, cluster := range []string{"bootstrap", "permanent"} {
+		if _, err := os.Stat(kubeConfigs[cluster]); err != nil {
+			continue
+		}
+		m.events <- Event{EventType: "progress", Event: "collecting the state of the " + cluster + " cluster"}
+		m.collectCluster(b, cluster, kubeConfigs[cluster])
+	}
+
+	// the tasks are the tagged machines' and the cluster's, machines created by remediation aren't tagged yet
+	var vmNames []string
+	if _, err := os.Stat(kubeConfigs["permanent"]); err == nil {
+		vmNames, err = m.vsphereVMNames(kubeConfigs["permanent"], "--selector=cluster.x-k8s.io/cluster-name="+m.ClusterName,
+			"--output=jsonpath={.items[*].metadata.name}")
+		if err != nil {
+			b.addErr("vsphere-tasks.txt", err)
+		}
+	}
+	m.events <- Event{EventType: "progress", Event: "collecting vSphere tasks"}
+	if tasks, err := m.vsphereTasks(vmNames); err == nil {
+		b.add("vsphere-tasks.txt", tasks)
+	} else {
+		b.addErr("vsphere-tasks.txt", err)
+	}
+
+	if len(b.errors) > 0 {
+		b.add("errors.txt", []byte(strings.Join(b.errors, "\n")+"\n"))
+	}
+	secrets := m.secrets()
+	for i := range b.files {
+		b.files[i].Contents = redact(b.files[i].Contents, secrets)
+	}
+
+	err = os.MkdirAll(dir, 0755)
+	if err != nil {
+		return "", err
+	}
+	bundle := filepath.Join(dir, name+".tar.gz")
+	f, err := os.OpenFile(bundle, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0600)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	err = writeTar(f, b.files, now)
+	if err != nil {
+		return "", err
+	}
+	m.events <- Event{EventType: "progress", Event: "support bundle written to " + bundle}
+	return bundle, f.Close()
+}
+
+// collectKindLogs adds the logs kind exports for the bootstrap cluster
+func (m *MgmtCluster) collectKindLogs(b *supportBundle) {
+	clusters, err := kindClusters()
+	if err != nil {
+		b.addErr("kind", err)
+		return
+	}
+	exists := false
+	for _, c := range clusters {
+		exists = exists || c == m.bootstrapClusterName()
+	}
+	if !exists {
+		return
+	}
+
+	m.events <- Event{EventType: "progress", Event: "collecting the kind logs"}
+	logDir, err := ioutil.TempDir("", "cake-kind-logs-")
+	if err != nil {
+		b.addErr("kind", err)
+		return
+	}
+	defer os.RemoveAll(logDir)
+	args := []string{
+		"export",
+		"logs",
+		logDir,
+		"--name=" + m.bootstrapClusterName(),
+	}
+	err = cmds.GenericExecute(nil, string(kind), args, nil)
+	if err != nil {
+		b.addErr("kind", err)
+		return
+	}
+	err = filepath.Walk(logDir, func(path string, info os.FileInfo, err error) error {
+		if err != nil || info.IsDir() {
+			return err
+		}
+		rel, err := filepath.Rel(logDir, path)
+		if err != nil {
+			return err
+		}
+		contents, err := ioutil.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		b.add("kind/"+filepath.ToSlash(rel), contents)
+		return nil
+	})
+	if err != nil {
+		b.addErr("kind", err)
+	}
+}
+
+// collectCluster adds the pods, events, Cluster API objects and provider controller logs of a cluster
+func (m *MgmtCluster) collectCluster(b *supportBundle, cluster, kubeConfig string) {
+	envs := map[string]string{
+		"KUBECONFIG": kubeConfig,
+	}
+	b.addCommand(cluster+"/nodes.txt", envs, kubectl, "get", "nodes", "--output=wide")
+	b.addCommand(cluster+"/pods.txt", envs, kubectl, "get", "pods", "--all-namespaces", "--output=wide")
+	b.addCommand(cluster+"/events.txt", envs, kubectl, "get", "events", "--all-namespaces", "--sort-by=.lastTimestamp")
+	b.addCommand(cluster+"/cluster-api.txt", envs, kubectl, "describe", strings.Join(bundleResources, ","), "--all-namespaces")
+
+	for _, namespace := range providerNamespaces {
+		c := cmds.NewCommandLine(envs, string(kubectl), []string{
+			"get",
+			"deployments",
+			"--namespace=" + namespace,
+			"--output=jsonpath={.items[*].metadata.name}",
+		}, nil)
+		stdout, stderr, err := c.Program().Execute()
+		if err != nil || string(stderr) != "" {
+			b.addErr(cluster+"/"+namespace, fmt.Errorf("err: %v, stderr: %v, cmd: %v %v", err, string(stderr), c.CommandName, c.Args))
+			continue
+		}
+		for _, deployment := range strings.Fields(string(stdout)) {
+			prefix := cluster + "/" + namespace + "/" + deployment
+			b.addCommand(prefix+".txt", envs, kubectl, "describe", "deployment", deployment, "--namespace="+namespace)
+			b.addCommand(prefix+".log", envs, kubectl, "logs", "deployment/"+deployment, "--namespace="+namespace, "--all-containers")
+		}
+	}
+}
+
+// vsphereTasks returns the recent vSphere tasks of the cluster's tagged virtual machines and the named ones as a table
+func (m *MgmtCluster) vsphereTasks(vmNames []string) ([]byte, error) {
+	ctx := context.Background()
+	r, err := m.vsphereResource(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer r.SessionManager.Close()
+	tasks, err := r.OwnedVMTasks(ctx, m.ClusterName, vmNames...)
+	if err != nil {
+		return nil, err
+	}
+
+	var vms []string
+	for vm := range tasks {
+		vms = append(vms, vm)
+	}
+	sort.Strings(vms)
+	var out bytes.Buffer
+	w := tabwriter.NewWriter(&out, 0, 8, 2, ' ', 0)
+	fmt.Fprintln(w, "VM\tQUEUED\tTASK\tSTATE\tERROR")
+	for _, vm := range vms {
+		for _, t := range tasks[vm] {
+			var taskErr string
+			if t.Error != nil {
+				taskErr = t.Error.LocalizedMessage
+			}
+			fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\n", vm, t.QueueTime.UTC().Format(time.RFC3339), t.DescriptionId, t.State, taskErr)
+		}
+	}
+	w.Flush()
+	return out.Bytes(), nil
+}
@@ -0,0 +1,33 @@
+package capv
+
+import (
+	"testing"
+)
+
+func TestRedact(t *testing.T) {
+	tests := []struct {
+		name, in, want string
+	}{
+		{"known secret", "login as admin with NetApp1!! failed", "login as admin with REDACTED failed"},
+		{"kubeconfig", "    client-key-data: LS0tLS1CRUdJTg==\n", "    client-key-data: REDACTED\n"},
+		{"json", `{"password":"hunter2","user":"admin"}`, `{"password":"REDACTED","user":"admin"}`},
+		{"log", `level=info msg="bootstrap" token=abcdef.0123456789abcdef`, `level=info msg="bootstrap" token=REDACTED`},
+		{"nothing secret", "secretName: capv-manager-bootstrap-credentials\n", "secretName: capv-manager-bootstrap-credentials\n"},
+	}
+	for _, tt := range tests {
+		if got := string(redact([]byte(tt.in), []string{"", "NetApp1!!"})); got != tt.want {
+			t.Errorf("%s: got %q, want %q", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestSecrets(t *testing.T) {
+	m := testCluster()
+	m.IPAM.MNode.AuthSecret = "mnode-s3cret"
+	m.Bintray.Token = "bintray-t0ken"
+	in := "POST https://10.117.0.20/auth/connect/token client_secret=mnode-s3cret, GET cake-ci:bintray-t0ken@dl.bintray.com"
+	want := "POST https://10.117.0.20/auth/connect/token client_secret=REDACTED, GET cake-ci:REDACTED@dl.bintray.com"
+	if got := string(redact([]byte(in), m.secrets())); got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+}
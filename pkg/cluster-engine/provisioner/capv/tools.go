@@ -0,0 +1,279 @@
+package capv
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"runtime"
+	"strings"
+
+	"github.com/netapp/cake/pkg/artifacts"
+	"github.com/netapp/cake/pkg/cmds"
+
+	"k8s.io/apimachinery/pkg/util/version"
+)
+
+// binDir in the config directory has the required commands cake installs, it's first in the PATH
+const binDir = "bin"
+
+// pinnedTool is the release of a required command cake installs, and the versions of it that work with cake
+type pinnedTool struct {
+	version string
+	// url is the amd64 binary or tar.gz archive, {os} is replaced by linux or darwin
+	url string
+	// checksum is the URL of the sha256sum file upstream publishes for the url
+	checksum string
+	// sha256 is the hex SHA-256 of the url for each OS, for releases without a sha256sum file. A tool
+	// with neither can only be installed from the artifact repository.
+	sha256 map[string]string
+	// archivePath is the binary's path in the archive, empty when the url is the binary
+	archivePath string
+	oses        []string
+	versionArgs []string
+	// minVersion is the oldest compatible version and maxVersion the first incompatible one, when there is one
+	minVersion, maxVersion string
+}
+
+// pinnedTools are the releases of the required commands --install-tools installs. docker has to be installed.
+var pinnedTools = map[requiredCmd]pinnedTool{
+	kind: {
+		version:     "v0.8.1",
+		url:         "https://github.com/kubernetes-sigs/kind/releases/download/v0.8.1/kind-{os}-amd64",
+		checksum:    "https://github.com/kubernetes-sigs/kind/releases/download/v0.8.1/kind-{os}-amd64.sha256sum",
+		oses:        []string{"linux", "darwin"},
+		versionArgs: []string{"version"},
+		minVersion:  "v0.7.0",
+	},
+	clusterctl: {
+		version:     "v0.3.3",
+		url:         "https://github.com/kubernetes-sigs/cluster-api/releases/download/v0.3.3/clusterctl-{os}-amd64",
+		oses:        []string{"linux", "darwin"},
+		versionArgs: []string{"version"},
+		minVersion:  "v0.3.3",
+		maxVersion:  "v0.4.0",
+	},
+	kubectl: {
+		version:     "v1.18.2",
+		url:         "https://storage.googleapis.com/kubernetes-release/release/v1.18.2/bin/{os}/amd64/kubectl",
+		checksum:    "https://storage.googleapis.com/kubernetes-release/release/v1.18.2/bin/{os}/amd64/kubectl.sha256",
+		oses:        []string{"linux", "darwin"},
+		versionArgs: []string{"version", "--client", "--short"},
+		// --dry-run=client is new in v1.18
+		minVersion: "v1.18.0",
+	},
+	helm: {
+		version:     "v3.2.1",
+		url:         "https://get.helm.sh/helm-v3.2.1-{os}-amd64.tar.gz",
+		checksum:    "https://get.helm.sh/helm-v3.2.1-{os}-amd64.tar.gz.sha256sum",
+		archivePath: "{os}-amd64/helm",
+		oses:        []string{"linux", "darwin"},
+		versionArgs: []string{"version", "--short"},
+		minVersion:  "v3.0.0",
+		maxVersion:  "v4.0.0",
+	},
+	tridentctl: {
+		version:     "v20.04.0",
+		url:         "https://github.com/NetApp/trident/releases/download/v20.04.0/trident-installer-20.04.0.tar.gz",
+		archivePath: "trident-installer/tridentctl",
+		oses:        []string{"linux"},
+		versionArgs: []string{"version", "--client"},
+		minVersion:  "v20.01.0",
+	},
+}
+
+// BinDir returns the directory cake installs required commands to, ~/.cluster-engine/bin
+func BinDir() (string, error) {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(home, ConfigDir, binDir), nil
+}
+
+// InstallCommands installs the pinned releases of the missing required commands into BinDir and returns the commands
+// it can't install. Tools come from the artifact repository's bin/<os>-<arch>/<name>-<version>, verified against its
+// bin/SHA256SUMS, when there is one, or from their upstream release verified against its checksum. Without a repository,
+// tools whose release has no checksum are returned.
+func (m *MgmtCluster) InstallCommands(missing []string) ([]string, error) {
+	dir, err := BinDir()
+	if err != nil {
+		return nil, err
+	}
+	err = os.MkdirAll(dir, 0755)
+	if err != nil {
+		return nil, err
+	}
+	err = cmds.PrependPath(dir)
+	if err != nil {
+		return nil, err
+	}
+	f, err := m.fetcher()
+	if err != nil {
+		return nil, err
+	}
+
+	var notInstalled []string
+	for _, name := range missing {
+		t, ok := pinnedTools[requiredCmd(name)]
+		if !ok || (f.Repository.Target == "" && t.releaseChecksum(runtime.GOOS) == "") {
+			notInstalled = append(notInstalled, name)
+			continue
+		}
+		m.events <- Event{EventType: "progress", Event: fmt.Sprintf("installing %s %s", name, t.version)}
+		err = installTool(f, name, t, dir, runtime.GOOS, runtime.GOARCH)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return notInstalled, nil
+}
+
+// installTool fetches the tool and writes its binary to the directory
+func installTool(f *artifacts.Fetcher, name string, t pinnedTool, dir, goos, goarch string) error {
+	a := artifacts.Artifact{
+		Location:   fmt.Sprintf("bin/%s-%s/%s-%s", goos, goarch, name, t.version),
+		Checksum:   "bin/SHA256SUMS",
+		Executable: true,
+	}
+	archivePath := ""
+	if f.Repository.Target == "" {
+		if goarch != "amd64" || !contains(t.oses, goos) {
+			return fmt.Errorf("%s %s has no %s/%s release, install it or use an artifact repository", name, t.version, goos, goarch)
+		}
+		checksum := t.releaseChecksum(goos)
+		if checksum == "" {
+			return fmt.Errorf("%s %s has no checksum to verify it with, install it or use an artifact repository", name, t.version)
+		}
+		a = artifacts.Artifact{
+			Location:   strings.Replace(t.url, "{os}", goos, -1),
+			Checksum:   checksum,
+			Executable: t.archivePath == "",
+		}
+		archivePath = strings.Replace(t.archivePath, "{os}", goos, -1)
+	}
+
+	local, err := f.Fetch(a)
+	if err != nil {
+		return err
+	}
+	src, err := os.Open(local)
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+	var binary io.Reader = src
+	if archivePath != "" {
+		binary, err = archiveFile(src, archivePath)
+		if err != nil {
+			return fmt.Errorf("unable to install %s from %s, %v", name, a.Location, err)
+		}
+	}
+
+	tmp, err := ioutil.TempFile(dir, name+".")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	_, err = io.Copy(tmp, binary)
+	if err != nil {
+		tmp.Close()
+		return err
+	}
+	err = tmp.Close()
+	if err != nil {
+		return err
+	}
+	err = os.Chmod(tmp.Name(), 0755)
+	if err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), filepath.Join(dir, name))
+}
+
+// releaseChecksum returns the checksum of the tool's release for the OS, empty when it can't be verified
+func (t pinnedTool) releaseChecksum(goos string) string {
+	if t.checksum != "" {
+		return strings.Replace(t.checksum, "{os}", goos, -1)
+	}
+	return t.sha256[goos]
+}
+
+// archiveFile returns the reader of a file in a tar.gz archive
+func archiveFile(r io.Reader, name string) (io.Reader, error) {
+	gzr, err := gzip.NewReader(r)
+	if err != nil {
+		return nil, err
+	}
+	tr := tar.NewReader(gzr)
+	for {
+		header, err := tr.Next()
+		if err == io.EOF {
+			return nil, fmt.Errorf("%s is not in the archive", name)
+		}
+		if err != nil {
+			return nil, err
+		}
+		if header.Typeflag == tar.TypeReg && strings.TrimPrefix(header.Name, "./") == name {
+			return tr, nil
+		}
+	}
+}
+
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
+
+// versionPattern finds the version in the output of a tool's version command
+var versionPattern = regexp.MustCompile(`v?[0-9]+\.[0-9]+\.[0-9]+`)
+
+// CommandWarnings returns a warning for each installed required command whose version cake doesn't work with
+func (m *MgmtCluster) CommandWarnings() []string {
+	var warnings []string
+	checked := map[string]bool{}
+	for _, name := range RequiredCommands.GetAll() {
+		t, ok := pinnedTools[requiredCmd(name)]
+		if !ok || checked[name] || !cmds.NewCommandLine(nil, name, nil, nil).Program().Exists() {
+			continue
+		}
+		checked[name] = true
+		c := cmds.NewCommandLine(nil, name, t.versionArgs, nil)
+		stdout, stderr, err := c.Program().Execute()
+		if err != nil {
+			warnings = append(warnings, fmt.Sprintf("unable to check the %s version, err: %v, stderr: %v", name, err, string(stderr)))
+			continue
+		}
+		if warning := checkToolVersion(name, t, string(stdout)); warning != "" {
+			warnings = append(warnings, warning)
+		}
+	}
+	return warnings
+}
+
+// checkToolVersion returns a warning when the version in the output of the tool's version command is incompatible
+func checkToolVersion(name string, t pinnedTool, output string) string {
+	found := versionPattern.FindString(output)
+	installed, err := version.ParseGeneric(found)
+	if err != nil {
+		return fmt.Sprintf("unable to find the %s version in %q", name, strings.TrimSpace(output))
+	}
+	if installed.LessThan(version.MustParseGeneric(t.minVersion)) ||
+		(t.maxVersion != "" && !installed.LessThan(version.MustParseGeneric(t.maxVersion))) {
+		compatible := ">= " + t.minVersion
+		if t.maxVersion != "" {
+			compatible += " and < " + t.maxVersion
+		}
+		return fmt.Sprintf("%s %s is not compatible, cake needs %s (%s is tested), --install-tools installs it when it's not in the PATH",
+			name, found, compatible, t.version)
+	}
+	return ""
+}
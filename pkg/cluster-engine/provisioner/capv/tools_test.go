@@ -0,0 +1,135 @@
+package capv
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/hex"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/netapp/cake/pkg/artifacts"
+	"github.com/netapp/cake/pkg/config/types"
+)
+
+func TestCheckToolVersion(t *testing.T) {
+	tests := []struct {
+		name       string
+		output     string
+		compatible bool
+	}{
+		{"kind", "kind v0.8.1 go1.14.2 linux/amd64", true},
+		{"kind", "kind v0.6.1 go1.13.4 linux/amd64", false},
+		{"clusterctl", `clusterctl version: &version.Info{Major:"0", Minor:"3", GitVersion:"v0.3.6"}`, true},
+		{"clusterctl", `clusterctl version: &version.Info{Major:"0", Minor:"2", GitVersion:"v0.2.10"}`, false},
+		{"kubectl", "Client Version: v1.18.2", true},
+		{"kubectl", "Client Version: v1.17.3", false},
+		{"helm", "v3.2.1+gfe51cd1", true},
+		{"helm", "Client: v2.16.7+g5f2584f", false},
+		{"tridentctl", "+----------------+\n| CLIENT VERSION |\n+----------------+\n| 20.04.0        |\n+----------------+", true},
+		{"tridentctl", "unknown", false},
+	}
+	for _, tc := range tests {
+		warning := checkToolVersion(tc.name, pinnedTools[requiredCmd(tc.name)], tc.output)
+		if tc.compatible != (warning == "") {
+			t.Errorf("got warning %q for %s %q", warning, tc.name, tc.output)
+		}
+	}
+}
+
+func TestInstallTool(t *testing.T) {
+	tool := []byte("#!/bin/sh\necho helm\n")
+	var archive bytes.Buffer
+	gzw := gzip.NewWriter(&archive)
+	tw := tar.NewWriter(gzw)
+	tw.WriteHeader(&tar.Header{Name: "linux-amd64/README.md", Mode: 0644, Size: 4, Typeflag: tar.TypeReg})
+	tw.Write([]byte("helm"))
+	tw.WriteHeader(&tar.Header{Name: "linux-amd64/helm", Mode: 0755, Size: int64(len(tool)), Typeflag: tar.TypeReg})
+	tw.Write(tool)
+	tw.Close()
+	gzw.Close()
+	sum := func(b []byte) string {
+		s := sha256.Sum256(b)
+		return hex.EncodeToString(s[:])
+	}
+
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/netapp/cake/bin/linux-amd64/kind-v0.8.1":
+			w.Write(tool)
+		case "/netapp/cake/bin/SHA256SUMS":
+			w.Write([]byte(sum(tool) + "  linux-amd64/kind-v0.8.1\n"))
+		case "/helm-linux-amd64.tar.gz":
+			w.Write(archive.Bytes())
+		case "/helm-linux-amd64.tar.gz.sha256sum":
+			w.Write([]byte(sum(archive.Bytes()) + "  helm-linux-amd64.tar.gz\n"))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer s.Close()
+
+	dir, err := ioutil.TempDir("", "install_tool_test_")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	bin := filepath.Join(dir, "bin")
+	os.MkdirAll(bin, 0755)
+
+	f := artifacts.NewFetcher(types.BintraySpec{Target: s.URL, Subject: "netapp", BasePath: "cake"}, filepath.Join(dir, "cache"))
+	err = installTool(f, "kind", pinnedTools[kind], bin, "linux", "amd64")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if b, err := ioutil.ReadFile(filepath.Join(bin, "kind")); err != nil || !bytes.Equal(b, tool) {
+		t.Errorf("got %q, %v, want kind from the repository", b, err)
+	}
+	if err = installTool(f, "helm", pinnedTools[helm], bin, "linux", "amd64"); err == nil {
+		t.Error("expected an error for a tool missing from the repository")
+	}
+
+	f = artifacts.NewFetcher(types.BintraySpec{}, filepath.Join(dir, "cache"))
+	helmTool := pinnedTools[helm]
+	helmTool.url = s.URL + "/helm-{os}-amd64.tar.gz"
+	helmTool.checksum = s.URL + "/helm-{os}-amd64.tar.gz.sha256sum"
+	err = installTool(f, "helm", helmTool, bin, "linux", "amd64")
+	if err != nil {
+		t.Fatal(err)
+	}
+	info, err := os.Stat(filepath.Join(bin, "helm"))
+	if err != nil || info.Mode().Perm() != 0755 || info.Size() != int64(len(tool)) {
+		t.Errorf("got %v, %v, want helm extracted from the archive", info, err)
+	}
+
+	helmTool.checksum = ""
+	if err = installTool(f, "helm", helmTool, bin, "linux", "amd64"); err == nil || !strings.Contains(err.Error(), "checksum") {
+		t.Errorf("got %v, want an error for a tool without a checksum", err)
+	}
+	helmTool.sha256 = map[string]string{"linux": sum(archive.Bytes())}
+	if err = installTool(f, "helm", helmTool, bin, "linux", "amd64"); err != nil {
+		t.Errorf("got %v, want helm verified against its pinned checksum", err)
+	}
+	helmTool.sha256 = map[string]string{"linux": sum(tool)}
+	if err = installTool(f, "helm", helmTool, bin, "linux", "amd64"); err == nil {
+		t.Error("expected an error for a tool that doesn't match its pinned checksum")
+	}
+	if err = installTool(f, "tridentctl", pinnedTools[tridentctl], bin, "darwin", "amd64"); err == nil {
+		t.Error("expected an error for a tool without a release for the OS")
+	}
+}
+
+func TestReleaseChecksum(t *testing.T) {
+	for name, tool := range pinnedTools {
+		verifiable := tool.releaseChecksum("linux") != ""
+		if want := name != clusterctl && name != tridentctl; verifiable != want {
+			t.Errorf("got a release checksum %v for %s, want %v", verifiable, name, want)
+		}
+	}
+}
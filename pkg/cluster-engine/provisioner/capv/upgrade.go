@@ -0,0 +1,357 @@
+package capv
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/netapp/cake/pkg/cluster-engine/provisioner"
+	"github.com/netapp/cake/pkg/cmds"
+
+	"k8s.io/apimachinery/pkg/util/version"
+	v3 "sigs.k8s.io/cluster-api-provider-vsphere/api/v1alpha3"
+	clusterv3 "sigs.k8s.io/cluster-api/api/v1alpha3"
+	capiv3 "sigs.k8s.io/cluster-api/controlplane/kubeadm/api/v1alpha3"
+	"sigs.k8s.io/yaml"
+)
+
+const (
+	// maxWorkerSkew is how many minor versions the kubelet may lag behind the API server
+	maxWorkerSkew  = 2
+	upgradeTimeout = 30 * time.Minute
+)
+
+// templateVersionSuffix matches the version suffix added to upgraded VSphereMachineTemplate names
+var templateVersionSuffix = regexp.MustCompile(`-v\d+-\d+-\d+$`)
+
+// checkVersionSkew checks the control plane can be upgraded to the target version: kubeadm only upgrades
+// one minor version at a time, and the workers may not fall more than two minor versions behind
+func checkVersionSkew(controlPlane string, workers []string, target string) error {
+	current, err := version.ParseSemantic(controlPlane)
+	if err != nil {
+		return fmt.Errorf("unable to parse control plane version %s, %v", controlPlane, err)
+	}
+	to, err := version.ParseSemantic(target)
+	if err != nil {
+		return fmt.Errorf("unable to parse target version %s, %v", target, err)
+	}
+
+	if !current.LessThan(to) {
+		return fmt.Errorf("target version %s must be newer than the control plane version %s", target, controlPlane)
+	}
+	if to.Major() != current.Major() || to.Minor() > current.Minor()+1 {
+		return fmt.Errorf("control plane version %s can only be upgraded one minor version at a time, not to %s", controlPlane, target)
+	}
+
+	for _, w := range workers {
+		worker, err := version.ParseSemantic(w)
+		if err != nil {
+			return fmt.Errorf("unable to parse worker version %s, %v", w, err)
+		}
+		if worker.Major() != to.Major() || worker.Minor()+maxWorkerSkew < to.Minor() {
+			return fmt.Errorf("workers at %s would be more than %d minor versions behind %s, upgrade them first", w, maxWorkerSkew, target)
+		}
+	}
+	return nil
+}
+
+// upgradedTemplateName returns the name of the VSphereMachineTemplate for the version
+func upgradedTemplateName(name, kubernetesVersion string) string {
+	base := templateVersionSuffix.ReplaceAllString(name, "")
+	return base + "-" + strings.ReplaceAll(kubernetesVersion, ".", "-")
+}
+
+// Upgrade rolls a cluster's control plane and then its MachineDeployments to a new Kubernetes version
+// on a new node template, waiting for each rollout to finish before moving on
+func (m *MgmtCluster) Upgrade(spec provisioner.UpgradeSpec) error {
+	if spec.ClusterName == "" {
+		spec.ClusterName = m.ClusterName
+	}
+	if !strings.HasPrefix(spec.KubernetesVersion, "v") {
+		spec.KubernetesVersion = "v" + spec.KubernetesVersion
+	}
+	kubeConfig, err := m.managementKubeconfig()
+	if err != nil {
+		return err
+	}
+	envs := map[string]string{
+		"KUBECONFIG": kubeConfig,
+	}
+
+	var kcp capiv3.KubeadmControlPlane
+	err = kubeGetJSON(envs, &kcp, "kubeadmcontrolplane", spec.ClusterName)
+	if err != nil {
+		return err
+	}
+	var mds clusterv3.MachineDeploymentList
+	err = kubeGetJSON(envs, &mds, "machinedeployments", "--selector=cluster.x-k8s.io/cluster-name="+spec.ClusterName)
+	if err != nil {
+		return err
+	}
+
+	var workerVersions []string
+	for _, md := range mds.Items {
+		if md.Spec.Template.Spec.Version != nil {
+			workerVersions = append(workerVersions, *md.Spec.Template.Spec.Version)
+		}
+	}
+	err = checkVersionSkew(kcp.Spec.Version, workerVersions, spec.KubernetesVersion)
+	if err != nil {
+		return err
+	}
+
+	var cpTemplate v3.VSphereMachineTemplate
+	err = kubeGetJSON(envs, &cpTemplate, "vspheremachinetemplate", kcp.Spec.InfrastructureTemplate.Name)
+	if err != nil {
+		return err
+	}
+	catalog, err := m.catalog()
+	if err != nil {
+		return err
+	}
+	release, inCatalog := catalog.Lookup(spec.KubernetesVersion)
+	nodeTemplate, ova, checksum := spec.NodeTemplate, spec.NodeTemplateOVA, ""
+	if nodeTemplate == "" && inCatalog {
+		nodeTemplate = release.NodeTemplate
+	}
+	if ova == "" && inCatalog && nodeTemplate == release.NodeTemplate {
+		ova, checksum = release.OVA, release.Checksum
+	}
+	if nodeTemplate == "" {
+		current := cpTemplate.Spec.Template.Spec.Template
+		if !strings.Contains(current, kcp.Spec.Version) {
+			return fmt.Errorf("node template %s doesn't contain version %s, a node template must be given", current, kcp.Spec.Version)
+		}
+		nodeTemplate = strings.ReplaceAll(current, kcp.Spec.Version, spec.KubernetesVersion)
+	}
+	err = catalog.CheckTemplate(nodeTemplate, spec.KubernetesVersion)
+	if err != nil {
+		return err
+	}
+	m.events <- Event{EventType: "progress", Event: "checking node template " + nodeTemplate}
+	err = m.ensureNodeTemplate(nodeTemplate, ova, checksum)
+	if err != nil {
+		return err
+	}
+
+	m.events <- Event{EventType: "progress", Event: fmt.Sprintf("upgrading the %s control plane to %s", spec.ClusterName, spec.KubernetesVersion)}
+	cpTemplateName, err := m.applyUpgradedTemplate(envs, spec.ClusterName, cpTemplate, nodeTemplate, spec.KubernetesVersion)
+	if err != nil {
+		return err
+	}
+	patch := map[string]interface{}{
+		"spec": map[string]interface{}{
+			"version": spec.KubernetesVersion,
+			"infrastructureTemplate": map[string]interface{}{
+				"name": cpTemplateName,
+			},
+		},
+	}
+	err = kubePatch(envs, "kubeadmcontrolplane", kcp.Name, patch)
+	if err != nil {
+		return err
+	}
+	err = m.whileAssigningAddresses(envs, spec.ClusterName, func() error {
+		return waitFor(upgradeTimeout, 15*time.Second, func() error {
+			var kcp capiv3.KubeadmControlPlane
+			if err := kubeGetJSON(envs, &kcp, "kubeadmcontrolplane", spec.ClusterName); err != nil {
+				return err
+			}
+			var machines clusterv3.MachineList
+			selector := clusterv3.ClusterLabelName + "=" + spec.ClusterName + "," + clusterv3.MachineControlPlaneLabelName
+			if err := kubeGetJSON(envs, &machines, "machines", "--selector="+selector); err != nil {
+				return err
+			}
+			return controlPlaneRolledOut(kcp, machines.Items, spec.KubernetesVersion)
+		})
+	})
+	if err != nil {
+		return fmt.Errorf("control plane upgrade did not finish, %v", err)
+	}
+	// every control plane machine was replaced
+	err = m.clusterConfig(spec.ClusterName).applyAntiAffinityRules(kubeConfig)
+	if err != nil {
+		return err
+	}
+
+	for _, md := range mds.Items {
+		m.events <- Event{EventType: "progress", Event: fmt.Sprintf("upgrading MachineDeployment %s to %s", md.Name, spec.KubernetesVersion)}
+		var workerTemplate v3.VSphereMachineTemplate
+		err = kubeGetJSON(envs, &workerTemplate, "vspheremachinetemplate", md.Spec.Template.Spec.InfrastructureRef.Name)
+		if err != nil {
+			return err
+		}
+		workerTemplateName, err := m.applyUpgradedTemplate(envs, spec.ClusterName, workerTemplate, nodeTemplate, spec.KubernetesVersion)
+		if err != nil {
+			return err
+		}
+		patch := map[string]interface{}{
+			"spec": map[string]interface{}{
+				"template": map[string]interface{}{
+					"spec": map[string]interface{}{
+						"version": spec.KubernetesVersion,
+						"infrastructureRef": map[string]interface{}{
+							"name": workerTemplateName,
+						},
+					},
+				},
+			},
+		}
+		err = kubePatch(envs, "machinedeployment", md.Name, patch)
+		if err != nil {
+			return err
+		}
+		name := md.Name
+		err = m.whileAssigningAddresses(envs, spec.ClusterName, func() error {
+			return waitFor(upgradeTimeout, 15*time.Second, func() error {
+				var md clusterv3.MachineDeployment
+				if err := kubeGetJSON(envs, &md, "machinedeployment", name); err != nil {
+					return err
+				}
+				return machineDeploymentRolledOut(md)
+			})
+		})
+		if err != nil {
+			return fmt.Errorf("MachineDeployment %s upgrade did not finish, %v", name, err)
+		}
+	}
+	err = m.tagMachines(kubeConfig, spec.ClusterName)
+	if err != nil {
+		return err
+	}
+	err = m.clusterConfig(spec.ClusterName).applyAntiAffinityRules(kubeConfig)
+	if err != nil {
+		return err
+	}
+
+	m.events <- Event{EventType: "progress", Event: fmt.Sprintf("upgraded %s to %s", spec.ClusterName, spec.KubernetesVersion)}
+	return err
+}
+
+// applyUpgradedTemplate creates a copy of the VSphereMachineTemplate cloning the new node template
+// and returns its name, templates are immutable so the machines are rolled onto the new one
+func (m *MgmtCluster) applyUpgradedTemplate(envs map[string]string, clusterName string, template v3.VSphereMachineTemplate, nodeTemplate, kubernetesVersion string) (string, error) {
+	upgraded := v3.VSphereMachineTemplate{
+		TypeMeta: template.TypeMeta,
+		Spec:     template.Spec,
+	}
+	upgraded.Name = upgradedTemplateName(template.Name, kubernetesVersion)
+	upgraded.Namespace = template.Namespace
+	upgraded.Labels = template.Labels
+	upgraded.Spec.Template.Spec.Template = nodeTemplate
+
+	out, err := yaml.Marshal(upgraded)
+	if err != nil {
+		return "", fmt.Errorf("unable to write VSphereMachineTemplate, %v", err)
+	}
+	fileName := upgraded.Name + ".yaml"
+	err = writeToDisk(clusterName, fileName, out, 0644)
+	if err != nil {
+		return "", err
+	}
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "", err
+	}
+	args := []string{
+		"apply",
+		"--filename=" + filepath.Join(home, ConfigDir, clusterName, fileName),
+	}
+	err = cmds.GenericExecute(envs, string(kubectl), args, nil)
+	if err != nil {
+		return "", err
+	}
+	return upgraded.Name, nil
+}
+
+// controlPlaneRolledOut checks every control plane machine runs the version, the KubeadmControlPlane status
+// has no observed generation so it still looks rolled out right after it's patched
+func controlPlaneRolledOut(kcp capiv3.KubeadmControlPlane, machines []clusterv3.Machine, kubernetesVersion string) error {
+	var replicas int32 = 1
+	if kcp.Spec.Replicas != nil {
+		replicas = *kcp.Spec.Replicas
+	}
+	var upgraded int32
+	for _, machine := range machines {
+		if machine.Spec.Version == nil || *machine.Spec.Version != kubernetesVersion {
+			return fmt.Errorf("control plane machine %s is not at %s yet", machine.Name, kubernetesVersion)
+		}
+		if machine.DeletionTimestamp != nil || machine.Status.NodeRef == nil ||
+			machine.Status.GetTypedPhase() != clusterv3.MachinePhaseRunning {
+			return fmt.Errorf("control plane machine %s is %s", machine.Name, machine.Status.Phase)
+		}
+		upgraded++
+	}
+	s := kcp.Status
+	if upgraded != replicas || s.Replicas != replicas || s.UpdatedReplicas != replicas || s.ReadyReplicas != replicas {
+		return fmt.Errorf("control plane %s has %d/%d upgraded machines, %d/%d updated and %d/%d ready replicas",
+			kcp.Name, upgraded, replicas, s.UpdatedReplicas, replicas, s.ReadyReplicas, replicas)
+	}
+	return nil
+}
+
+func machineDeploymentRolledOut(md clusterv3.MachineDeployment) error {
+	var replicas int32 = 1
+	if md.Spec.Replicas != nil {
+		replicas = *md.Spec.Replicas
+	}
+	s := md.Status
+	if s.ObservedGeneration < md.Generation || s.Replicas != replicas || s.UpdatedReplicas != replicas || s.AvailableReplicas != replicas {
+		return fmt.Errorf("MachineDeployment %s has %d/%d updated and %d/%d available replicas", md.Name, s.UpdatedReplicas, replicas, s.AvailableReplicas, replicas)
+	}
+	return nil
+}
+
+// kubeGetJSON runs `kubectl get` with the arguments and decodes the json output into out
+func kubeGetJSON(envs map[string]string, out interface{}, args ...string) error {
+	args = append([]string{"get", "--output=json"}, args...)
+	c := cmds.NewCommandLine(envs, string(kubectl), args, nil)
+	stdout, stderr, err := c.Program().Execute()
+	if err != nil || string(stderr) != "" {
+		return fmt.Errorf("err: %v, stderr: %v, cmd: %v %v", err, string(stderr), c.CommandName, c.Args)
+	}
+	err = json.Unmarshal(stdout, out)
+	if err != nil {
+		return fmt.Errorf("error with unmarshal: %v", err.Error())
+	}
+	return nil
+}
+
+// kubePatch merge patches a resource
+func kubePatch(envs map[string]string, resource, name string, patch interface{}) error {
+	p, err := json.Marshal(patch)
+	if err != nil {
+		return err
+	}
+	args := []string{
+		"patch",
+		resource,
+		name,
+		"--type=merge",
+		"--patch=" + string(p),
+	}
+	return cmds.GenericExecute(envs, string(kubectl), args, nil)
+}
+
+// kubeCreateOrApply generates the resource `kubectl create` with the arguments would create and applies it,
+// so it's updated when it already exists
+func kubeCreateOrApply(envs map[string]string, args ...string) error {
+	args = append(append([]string{"create"}, args...), "--dry-run=client", "--output=yaml")
+	c := cmds.NewCommandLine(envs, string(kubectl), args, nil)
+	stdout, stderr, err := c.Program().Execute()
+	if err != nil || string(stderr) != "" {
+		return fmt.Errorf("err: %v, stderr: %v, cmd: %v %v", err, string(stderr), c.CommandName, c.Args)
+	}
+	c = cmds.NewCommandLine(envs, string(kubectl), []string{"apply", "--filename=-"}, nil)
+	c.Stdin = bytes.NewReader(stdout)
+	_, stderr, err = c.Program().Execute()
+	if err != nil || string(stderr) != "" {
+		return fmt.Errorf("err: %v, stderr: %v, cmd: %v %v", err, string(stderr), c.CommandName, c.Args)
+	}
+	return nil
+}
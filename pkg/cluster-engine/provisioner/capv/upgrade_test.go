@@ -0,0 +1,82 @@
+package capv
+
+import (
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	clusterv3 "sigs.k8s.io/cluster-api/api/v1alpha3"
+	capiv3 "sigs.k8s.io/cluster-api/controlplane/kubeadm/api/v1alpha3"
+)
+
+func TestCheckVersionSkew(t *testing.T) {
+	tests := []struct {
+		name         string
+		controlPlane string
+		workers      []string
+		target       string
+		valid        bool
+	}{
+		{"patch", "v1.17.3", []string{"v1.17.3"}, "v1.17.5", true},
+		{"minor", "v1.17.3", []string{"v1.17.3"}, "v1.18.2", true},
+		{"workers two behind", "v1.17.3", []string{"v1.16.8"}, "v1.18.2", true},
+		{"workers three behind", "v1.17.3", []string{"v1.15.11"}, "v1.18.2", false},
+		{"two minors", "v1.17.3", nil, "v1.19.0", false},
+		{"same version", "v1.17.3", nil, "v1.17.3", false},
+		{"downgrade", "v1.17.3", nil, "v1.16.8", false},
+		{"major", "v1.17.3", nil, "v2.0.0", false},
+		{"not a version", "v1.17.3", nil, "latest", false},
+	}
+	for _, tt := range tests {
+		err := checkVersionSkew(tt.controlPlane, tt.workers, tt.target)
+		if (err == nil) != tt.valid {
+			t.Errorf("%s: got err %v, want valid %v", tt.name, err, tt.valid)
+		}
+	}
+}
+
+func TestUpgradedTemplateName(t *testing.T) {
+	name := upgradedTemplateName("capv-mgmt-cluster-md-0", "v1.18.2")
+	if name != "capv-mgmt-cluster-md-0-v1-18-2" {
+		t.Errorf("got %s, want capv-mgmt-cluster-md-0-v1-18-2", name)
+	}
+	name = upgradedTemplateName(name, "v1.19.0")
+	if name != "capv-mgmt-cluster-md-0-v1-19-0" {
+		t.Errorf("got %s, want capv-mgmt-cluster-md-0-v1-19-0", name)
+	}
+}
+
+func TestControlPlaneRolledOut(t *testing.T) {
+	machine := func(name, version string, running bool) clusterv3.Machine {
+		m := clusterv3.Machine{}
+		m.Name = name
+		m.Spec.Version = &version
+		if running {
+			m.Status.NodeRef = &corev1.ObjectReference{Name: name}
+			m.Status.SetTypedPhase(clusterv3.MachinePhaseRunning)
+		}
+		return m
+	}
+	var replicas int32 = 1
+	kcp := capiv3.KubeadmControlPlane{}
+	kcp.Name = "c"
+	kcp.Spec.Replicas = &replicas
+	kcp.Status.Replicas, kcp.Status.UpdatedReplicas, kcp.Status.ReadyReplicas = 1, 1, 1
+
+	tests := []struct {
+		name     string
+		machines []clusterv3.Machine
+		done     bool
+	}{
+		{"just patched", []clusterv3.Machine{machine("old", "v1.17.3", true)}, false},
+		{"rolling", []clusterv3.Machine{machine("old", "v1.17.3", true), machine("new", "v1.18.2", false)}, false},
+		{"new not ready", []clusterv3.Machine{machine("new", "v1.18.2", false)}, false},
+		{"rolled out", []clusterv3.Machine{machine("new", "v1.18.2", true)}, true},
+		{"no machines", nil, false},
+	}
+	for _, tt := range tests {
+		err := controlPlaneRolledOut(kcp, tt.machines, "v1.18.2")
+		if (err == nil) != tt.done {
+			t.Errorf("%s: got err %v, want rolled out %v", tt.name, err, tt.done)
+		}
+	}
+}
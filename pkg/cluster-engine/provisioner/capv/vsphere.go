@@ -0,0 +1,215 @@
+package capv
+
+import (
+	"context"
+	"fmt"
+	"path"
+	"strings"
+
+	"github.com/netapp/cake/pkg/cmds"
+	"github.com/netapp/cake/pkg/platform/vsphere"
+	log "github.com/sirupsen/logrus"
+	"github.com/vmware/govmomi/find"
+	"github.com/vmware/govmomi/object"
+	"github.com/vmware/govmomi/vim25/mo"
+)
+
+// vsphereResource connects to vCenter and resolves the configured datacenter,
+// objects created through the resource are tagged as owned by the cluster
+func (m *MgmtCluster) vsphereResource(ctx context.Context) (*vsphere.Resource, error) {
+	sm, err := vsphere.NewManagerContext(ctx, m.VcenterServer, m.VsphereUsername, m.VspherePassword)
+	if err != nil {
+		return nil, err
+	}
+	client, err := sm.GetClientContext(ctx)
+	if err != nil {
+		sm.Close()
+		return nil, err
+	}
+
+	finder := find.NewFinder(client.Client, true)
+	dc, err := finder.Datacenter(ctx, m.Datacenter)
+	if err != nil {
+		sm.Close()
+		return nil, fmt.Errorf("unable to find datacenter %s, %v", m.Datacenter, err)
+	}
+
+	r := &vsphere.Resource{
+		SessionManager: sm,
+		ClusterID:      m.ClusterName,
+		DeployedAt:     m.deployedAt,
+	}
+	r.Datacenter = dc
+
+	return r, nil
+}
+
+// ensureNodeTemplate checks the node template exists, importing it from the OVA when it doesn't.
+// The OVA is verified against the checksum before it's imported when there is one.
+func (m *MgmtCluster) ensureNodeTemplate(templateName, ovaPath, checksum string) error {
+	ctx := context.Background()
+	r, err := m.vsphereResource(ctx)
+	if err != nil {
+		return err
+	}
+	defer r.SessionManager.Close()
+
+	_, err = r.SessionManager.GetVMContext(ctx, r.Datacenter, templateName)
+	if err == nil {
+		return nil
+	}
+	if _, ok := err.(*find.NotFoundError); !ok || ovaPath == "" {
+		return fmt.Errorf("unable to find node template %s, %v", templateName, err)
+	}
+
+	ovaPath, err = m.verifiedOVA(ovaPath, checksum)
+	if err != nil {
+		return err
+	}
+	m.events <- Event{EventType: "progress", Event: "importing node template " + templateName}
+	err = m.findInfrastructure(ctx, r)
+	if err != nil {
+		return err
+	}
+
+	_, err = r.DeployOVATemplate(templateName, ovaPath)
+	return err
+}
+
+// ensureInventory creates the configured folder and resource pool when they don't exist yet,
+// the folder defaults to nks/workloads. Only created objects are tagged, so destroy leaves existing ones alone.
+func (m *MgmtCluster) ensureInventory() error {
+	if m.Folder == "" {
+		m.Folder = path.Join(vsphereBaseFolder, vsphereWorkloadFolder)
+	}
+
+	ctx := context.Background()
+	r, err := m.vsphereResource(ctx)
+	if err != nil {
+		return err
+	}
+	defer r.SessionManager.Close()
+
+	folder, err := r.EnsureFolder(ctx, m.Folder)
+	if err != nil {
+		return err
+	}
+	m.Folder = folder.InventoryPath
+
+	if m.ResourcePool == "" {
+		return nil
+	}
+	pool, err := r.EnsureResourcePool(ctx, m.ResourcePool, &m.ResourcePoolAllocation)
+	if err != nil {
+		return err
+	}
+	m.ResourcePool = pool.InventoryPath
+
+	return nil
+}
+
+// antiAffinityRuleNames returns the names of the DRS rules for the control plane and load balancer virtual machines
+func (m *MgmtCluster) antiAffinityRuleNames() (string, string) {
+	return "cake-" + m.ClusterName + "-control-plane", "cake-" + m.ClusterName + "-load-balancer"
+}
+
+// applyAntiAffinityRules keeps the control plane virtual machines, and the load balancers
+// if there are more than one, on separate ESXi hosts so a host failure can't take out the cluster.
+// It's run again after scaling and upgrading to replace the machines in the rules, VMs being deleted are left out.
+func (m *MgmtCluster) applyAntiAffinityRules(kubeconfig string) error {
+	m.events <- Event{EventType: "progress", Event: "creating vSphere anti-affinity rules"}
+
+	controlPlane, err := m.vsphereVMNames(kubeconfig, "--selector=cluster.x-k8s.io/cluster-name="+m.ClusterName+",cluster.x-k8s.io/control-plane",
+		"--output=jsonpath={.items[*].metadata.name}")
+	if err != nil {
+		return err
+	}
+	loadBalancers, err := m.vsphereVMNames(kubeconfig, "--selector=cluster.x-k8s.io/cluster-name="+m.ClusterName,
+		`--output=jsonpath={.items[?(@.metadata.ownerReferences[0].kind=="HAProxyLoadBalancer")].metadata.name}`)
+	if err != nil {
+		return err
+	}
+
+	ctx := context.Background()
+	r, err := m.vsphereResource(ctx)
+	if err != nil {
+		return err
+	}
+	defer r.SessionManager.Close()
+
+	controlPlaneRule, loadBalancerRule := m.antiAffinityRuleNames()
+	rules := map[string][]string{
+		controlPlaneRule: controlPlane,
+		loadBalancerRule: loadBalancers,
+	}
+	for name, vmNames := range rules {
+		var vms []*object.VirtualMachine
+		for _, vmName := range vmNames {
+			vm, err := r.SessionManager.GetVMContext(ctx, r.Datacenter, vmName)
+			if _, ok := err.(*find.NotFoundError); ok {
+				continue
+			}
+			if err != nil {
+				return fmt.Errorf("unable to find virtual machine %s, %v", vmName, err)
+			}
+			vms = append(vms, vm)
+		}
+		if len(vms) < 2 {
+			log.Debugf("Skipping anti-affinity rule %s, %d virtual machines", name, len(vms))
+			continue
+		}
+		if err = r.EnsureAntiAffinityRule(ctx, name, vms...); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// vsphereVMNames returns the names of the VSphereVMs matching the kubectl get arguments
+func (m *MgmtCluster) vsphereVMNames(kubeconfig string, args ...string) ([]string, error) {
+	envs := map[string]string{
+		"KUBECONFIG": kubeconfig,
+	}
+	args = append([]string{"get", "vspherevms"}, args...)
+	c := cmds.NewCommandLine(envs, string(kubectl), args, nil)
+	stdout, stderr, err := c.Program().Execute()
+	if err != nil || string(stderr) != "" {
+		return nil, fmt.Errorf("err: %v, stderr: %v, cmd: %v %v", err, string(stderr), c.CommandName, c.Args)
+	}
+	return strings.Fields(string(stdout)), nil
+}
+
+// tagMachines tags the virtual machines CAPV created for the cluster as owned by it, it's run again after scaling
+// and upgrading, and before destroy, for the machines created since. VMs being cloned or deleted are skipped.
+func (m *MgmtCluster) tagMachines(kubeconfig, clusterName string) error {
+	m.events <- Event{EventType: "progress", Event: "tagging " + clusterName + " virtual machines in vSphere"}
+
+	names, err := m.vsphereVMNames(kubeconfig, "--selector=cluster.x-k8s.io/cluster-name="+clusterName,
+		"--output=jsonpath={.items[*].metadata.name}")
+	if err != nil {
+		return err
+	}
+
+	ctx := context.Background()
+	r, err := m.vsphereResource(ctx)
+	if err != nil {
+		return err
+	}
+	defer r.SessionManager.Close()
+	r.ClusterID = clusterName
+
+	var refs []mo.Reference
+	for _, name := range names {
+		vm, err := r.SessionManager.GetVMContext(ctx, r.Datacenter, name)
+		if _, ok := err.(*find.NotFoundError); ok {
+			continue
+		}
+		if err != nil {
+			return fmt.Errorf("unable to find virtual machine %s, %v", name, err)
+		}
+		refs = append(refs, vm)
+	}
+
+	return r.TagOwned(ctx, refs...)
+}
@@ -0,0 +1,214 @@
+package capv
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/netapp/cake/pkg/cluster-engine/provisioner"
+	"github.com/netapp/cake/pkg/cmds"
+
+	clusterv3 "sigs.k8s.io/cluster-api/api/v1alpha3"
+)
+
+// managementKubeconfig returns the location of the permanent management cluster's kubeconfig
+func (m *MgmtCluster) managementKubeconfig() (string, error) {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "", err
+	}
+	kubeConfig := filepath.Join(home, ConfigDir, m.ClusterName, "kubeconfig")
+	if _, err = os.Stat(kubeConfig); err != nil {
+		return "", fmt.Errorf("management cluster %s kubeconfig not found, %v", m.ClusterName, err)
+	}
+	return kubeConfig, nil
+}
+
+// workload returns a copy of the management cluster config for a workload cluster
+func (m *MgmtCluster) workload(spec provisioner.WorkloadCluster) *MgmtCluster {
+	w := *m
+	w.ClusterName = spec.ClusterName
+	w.Kubeconfig = ""
+	if spec.KubernetesVersion != "" && spec.KubernetesVersion != m.KubernetesVersion {
+		// the management cluster's template is for its own version, the catalog's is used instead
+		w.KubernetesVersion = spec.KubernetesVersion
+		w.NodeTemplate = ""
+	}
+	if spec.ControlPlaneMachineCount != "" {
+		w.ControlPlaneMachineCount = spec.ControlPlaneMachineCount
+	}
+	// the management cluster's node pools, and their templates, are its own, the workers are a single md-0 pool
+	w.NodePools = nil
+	if spec.WorkerMachineCount != "" {
+		w.WorkerMachineCount = spec.WorkerMachineCount
+	}
+	if w.WorkerMachineCount == "" {
+		w.WorkerMachineCount = defaultWorkerMachineCount
+	}
+	return &w
+}
+
+// clusterConfig returns the config of the management cluster or of one of its workload clusters
+func (m *MgmtCluster) clusterConfig(clusterName string) *MgmtCluster {
+	if clusterName == m.ClusterName {
+		return m
+	}
+	return m.workload(provisioner.WorkloadCluster{ClusterName: clusterName})
+}
+
+// CreateWorkloadCluster creates a cluster from the management cluster, its files
+// and kubeconfig are written to ~/.cluster-engine/<cluster name>/
+func (m *MgmtCluster) CreateWorkloadCluster(spec provisioner.WorkloadCluster) error {
+	if spec.ClusterName == "" || spec.ClusterName == m.ClusterName {
+		return fmt.Errorf("invalid workload cluster name %q", spec.ClusterName)
+	}
+	kubeConfig, err := m.managementKubeconfig()
+	if err != nil {
+		return err
+	}
+	w := m.workload(spec)
+
+	m.events <- Event{EventType: "progress", Event: "creating vSphere folder and resource pool"}
+	err = w.ensureInventory()
+	if err != nil {
+		return err
+	}
+	err = w.ensureTemplates()
+	if err != nil {
+		return err
+	}
+
+	m.events <- Event{EventType: "progress", Event: "writing CAPv spec file out for " + w.ClusterName}
+	err = w.writeSpec()
+	if err != nil {
+		return err
+	}
+
+	m.events <- Event{EventType: "progress", Event: "creating workload cluster " + w.ClusterName}
+	return w.createCluster(kubeConfig)
+}
+
+// ListClusters returns the clusters managed by the management cluster
+func (m *MgmtCluster) ListClusters() ([]provisioner.ClusterStatus, error) {
+	kubeConfig, err := m.managementKubeconfig()
+	if err != nil {
+		return nil, err
+	}
+	envs := map[string]string{
+		"KUBECONFIG": kubeConfig,
+	}
+	args := []string{
+		"get",
+		"clusters",
+		"--all-namespaces",
+		"--output=json",
+	}
+	c := cmds.NewCommandLine(envs, string(kubectl), args, nil)
+	stdout, stderr, err := c.Program().Execute()
+	if err != nil || string(stderr) != "" {
+		return nil, fmt.Errorf("err: %v, stderr: %v, cmd: %v %v", err, string(stderr), c.CommandName, c.Args)
+	}
+
+	var clusters clusterv3.ClusterList
+	err = json.Unmarshal(stdout, &clusters)
+	if err != nil {
+		return nil, fmt.Errorf("error with unmarshal: %v", err.Error())
+	}
+
+	var statuses []provisioner.ClusterStatus
+	for _, cluster := range clusters.Items {
+		statuses = append(statuses, m.clusterStatus(cluster))
+	}
+	return statuses, nil
+}
+
+// GetCluster returns a cluster managed by the management cluster
+func (m *MgmtCluster) GetCluster(name string) (provisioner.ClusterStatus, error) {
+	kubeConfig, err := m.managementKubeconfig()
+	if err != nil {
+		return provisioner.ClusterStatus{}, err
+	}
+	envs := map[string]string{
+		"KUBECONFIG": kubeConfig,
+	}
+	args := []string{
+		"get",
+		"cluster",
+		name,
+		"--output=json",
+	}
+	c := cmds.NewCommandLine(envs, string(kubectl), args, nil)
+	stdout, stderr, err := c.Program().Execute()
+	if err != nil || string(stderr) != "" {
+		return provisioner.ClusterStatus{}, fmt.Errorf("err: %v, stderr: %v, cmd: %v %v", err, string(stderr), c.CommandName, c.Args)
+	}
+
+	var cluster clusterv3.Cluster
+	err = json.Unmarshal(stdout, &cluster)
+	if err != nil {
+		return provisioner.ClusterStatus{}, fmt.Errorf("error with unmarshal: %v", err.Error())
+	}
+	return m.clusterStatus(cluster), nil
+}
+
+func (m *MgmtCluster) clusterStatus(cluster clusterv3.Cluster) provisioner.ClusterStatus {
+	status := provisioner.ClusterStatus{
+		ClusterName:         cluster.Name,
+		Namespace:           cluster.Namespace,
+		Phase:               cluster.Status.Phase,
+		ControlPlaneReady:   cluster.Status.ControlPlaneReady,
+		InfrastructureReady: cluster.Status.InfrastructureReady,
+		Management:          cluster.Name == m.ClusterName,
+	}
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return status
+	}
+	kubeConfig := filepath.Join(home, ConfigDir, cluster.Name, "kubeconfig")
+	if _, err = os.Stat(kubeConfig); err == nil {
+		status.Kubeconfig = kubeConfig
+	}
+	return status
+}
+
+// DeleteWorkloadCluster deletes a cluster created by the management cluster,
+// releases its addresses and then cleans up what is left of it in vSphere and its local files
+func (m *MgmtCluster) DeleteWorkloadCluster(name string) error {
+	if name == "" || name == m.ClusterName {
+		return fmt.Errorf("invalid workload cluster name %q, use destroy for the management cluster", name)
+	}
+	kubeConfig, err := m.managementKubeconfig()
+	if err != nil {
+		return err
+	}
+
+	// machines created by remediation aren't tagged yet, they're deleted with the cluster unless it fails
+	err = m.tagMachines(kubeConfig, name)
+	if err != nil {
+		return err
+	}
+
+	m.events <- Event{EventType: "progress", Event: "deleting workload cluster " + name}
+	envs := map[string]string{
+		"KUBECONFIG": kubeConfig,
+	}
+	args := []string{
+		"delete",
+		"cluster",
+		name,
+		"--wait=true",
+		"--timeout=" + (15 * time.Minute).String(),
+	}
+	err = cmds.GenericExecute(envs, string(kubectl), args, nil)
+	if err != nil {
+		return err
+	}
+	err = m.releaseAddresses(name)
+	if err != nil {
+		return err
+	}
+
+	return m.workload(provisioner.WorkloadCluster{ClusterName: name}).destroyOwned()
+}
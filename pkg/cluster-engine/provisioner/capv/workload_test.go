@@ -0,0 +1,53 @@
+package capv
+
+import (
+	"testing"
+
+	"github.com/netapp/cake/pkg/cluster-engine/provisioner"
+)
+
+func TestWorkload(t *testing.T) {
+	m := &MgmtCluster{}
+	m.ClusterName = "mgmt"
+	m.Kubeconfig = "mgmt kubeconfig"
+	m.KubernetesVersion = "v1.17.3"
+	m.ControlPlaneMachineCount = "1"
+	m.WorkerMachineCount = "2"
+	m.Datacenter = "dc"
+
+	w := m.workload(provisioner.WorkloadCluster{ClusterName: "tenant", WorkerMachineCount: "5"})
+	if w.ClusterName != "tenant" || w.Kubeconfig != "" {
+		t.Errorf("got cluster %s with kubeconfig %q, want tenant without kubeconfig", w.ClusterName, w.Kubeconfig)
+	}
+	if w.KubernetesVersion != "v1.17.3" || w.ControlPlaneMachineCount != "1" || w.WorkerMachineCount != "5" {
+		t.Errorf("got version %s, %s control plane and %s workers, want v1.17.3, 1 and 5",
+			w.KubernetesVersion, w.ControlPlaneMachineCount, w.WorkerMachineCount)
+	}
+	if w.Datacenter != "dc" {
+		t.Errorf("expected vSphere settings from the management cluster")
+	}
+	if m.ClusterName != "mgmt" || m.WorkerMachineCount != "2" {
+		t.Errorf("expected the management cluster config to be unchanged")
+	}
+
+	m.WorkerMachineCount = ""
+	m.NodePools = []NodePool{{Name: "gpu", Replicas: 2, Template: "ubuntu-1804-kube-v1.17.3-gpu"}}
+	for _, tt := range []struct {
+		spec    provisioner.WorkloadCluster
+		workers int
+	}{
+		{provisioner.WorkloadCluster{ClusterName: "tenant", WorkerMachineCount: "5"}, 5},
+		{provisioner.WorkloadCluster{ClusterName: "tenant", KubernetesVersion: "v1.18.2"}, 2},
+	} {
+		pools, err := m.workload(tt.spec).nodePools()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(pools) != 1 || pools[0].Name != defaultNodePool || pools[0].Replicas != tt.workers || pools[0].Template != "" {
+			t.Errorf("got node pools %+v for %+v, want %d %s workers", pools, tt.spec, tt.workers, defaultNodePool)
+		}
+	}
+	if len(m.NodePools) != 1 {
+		t.Errorf("expected the management cluster node pools to be unchanged")
+	}
+}
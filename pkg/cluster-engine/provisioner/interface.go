@@ -7,7 +7,24 @@ type Cluster interface {
 	CreatePermanent() error
 	PivotControlPlane() error
 	InstallAddons() error
+	Destroy() error
+	CreateWorkloadCluster(WorkloadCluster) error
+	ListClusters() ([]ClusterStatus, error)
+	GetCluster(name string) (ClusterStatus, error)
+	DeleteWorkloadCluster(name string) error
+	Scale(ScaleSpec) error
+	Upgrade(UpgradeSpec) error
+	ProviderUpgradePlan() ([]ProviderUpgrade, error)
+	UpgradeProviders() error
+	Render(showSecrets bool) ([]Manifest, error)
+	Backup(file, passphrase string) error
+	Restore(file, passphrase, kubeconfig string) error
+	SupportBundle(dir string) (string, error)
 	RequiredCommands() []string
+	// InstallCommands installs the missing required commands it can and returns the others
+	InstallCommands(missing []string) ([]string, error)
+	// CommandWarnings are about installed required commands with incompatible versions
+	CommandWarnings() []string
 	Events() chan interface{}
 }
 
@@ -19,16 +36,81 @@ type MgmtCluster struct {
 	SSHAuthorizedKey         string `yaml:"SshAuthorizedKey"`
 	ControlPlaneMachineCount string `yaml:"ControlPlaneMachineCount"`
 	WorkerMachineCount       string `yaml:"WorkerMachineCount"`
+	ControlPlaneSize         string `yaml:"ControlPlaneSize"`
+	WorkerSize               string `yaml:"WorkerSize"`
 	LogFile                  string `yaml:"LogFile"`
 }
 
 // K8s spec
 type K8s struct {
-	ClusterName           string `yaml:"ClusterName"`
+	ClusterName           string `yaml:"ClusterName" jsonschema:"required"`
 	CapiSpec              string `yaml:"CapiSpec"`
-	KubernetesVersion     string `yaml:"KubernetesVersion"`
+	KubernetesVersion     string `yaml:"KubernetesVersion" jsonschema:"required"`
 	Namespace             string `yaml:"Namespace"`
 	Kubeconfig            string `yaml:"Kubeconfig"`
 	KubernetesPodCidr     string `yaml:"KubernetesPodCidr"`
 	KubernetesServiceCidr string `yaml:"KubernetesServiceCidr"`
 }
+
+// WorkloadCluster spec for a cluster created by the management cluster,
+// empty fields default to the management cluster's settings
+type WorkloadCluster struct {
+	ClusterName              string
+	KubernetesVersion        string
+	ControlPlaneMachineCount string
+	WorkerMachineCount       string
+}
+
+// ClusterStatus of a cluster managed by the management cluster
+type ClusterStatus struct {
+	ClusterName         string
+	Namespace           string
+	Phase               string
+	ControlPlaneReady   bool
+	InfrastructureReady bool
+	// Management is true for the management cluster itself
+	Management bool
+	// Kubeconfig is the location of the cluster's kubeconfig, empty when it isn't on disk
+	Kubeconfig string
+}
+
+// ScaleSpec sets the machine counts of a cluster, nil counts are left unchanged
+type ScaleSpec struct {
+	// ClusterName defaults to the management cluster
+	ClusterName              string
+	ControlPlaneMachineCount *int
+	WorkerMachineCount       *int
+	// NodePool is the node pool the WorkerMachineCount is for, it defaults to md-0
+	NodePool string
+}
+
+// UpgradeSpec sets the Kubernetes version to upgrade a cluster to
+type UpgradeSpec struct {
+	// ClusterName defaults to the management cluster
+	ClusterName       string
+	KubernetesVersion string
+	// NodeTemplate for the new version, defaults to the catalog's template for the version
+	// or else the current template name with the version replaced
+	NodeTemplate string
+	// NodeTemplateOVA is imported as the NodeTemplate when the template doesn't exist,
+	// it defaults to the catalog's OVA for the version
+	NodeTemplateOVA string
+}
+
+// ProviderUpgrade is the current and available versions of a provider installed on the management cluster
+type ProviderUpgrade struct {
+	Name           string
+	Namespace      string
+	Type           string
+	CurrentVersion string
+	// NextVersion is the latest release available for the provider's contract
+	NextVersion string
+	// PinnedVersion is the version set by the components config, it's empty when the provider isn't pinned
+	PinnedVersion string
+}
+
+// Manifest is a file deploy writes and applies, Contents is YAML or JSON
+type Manifest struct {
+	Name     string
+	Contents []byte
+}
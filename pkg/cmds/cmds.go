@@ -28,6 +28,8 @@ type CommandLine struct {
 	CommandName string
 	Args        []string
 	Ctx         *context.Context
+	// Stdin is the command's input when it's set
+	Stdin io.Reader
 }
 
 // NewCommandLine constructs a new CommandLine instance
@@ -62,6 +64,7 @@ func (c *CommandSession) Execute() ([]byte, []byte, error) {
 
 	cmd.Stdout = io.MultiWriter(&stdout, filehandle)
 	cmd.Stderr = io.MultiWriter(&stderr, filehandle)
+	cmd.Stdin = c.CommandLine.Stdin
 
 	if c.CommandLine.EnvVars != nil {
 		additionalEnv := createEnvVars(c.CommandLine.EnvVars)
@@ -91,6 +94,20 @@ func (c *CommandSession) Exists() bool {
 	return true
 }
 
+// PrependPath puts dir first in the $PATH commands are looked up in and run with, unless it's already there
+func PrependPath(dir string) error {
+	path := os.Getenv("PATH")
+	for _, d := range filepath.SplitList(path) {
+		if d == dir {
+			return nil
+		}
+	}
+	if path == "" {
+		return os.Setenv("PATH", dir)
+	}
+	return os.Setenv("PATH", dir+string(os.PathListSeparator)+path)
+}
+
 // Program is the only method executed for the CommandLine
 func (c *CommandLine) Program() Command {
 	return &CommandSession{
@@ -2,6 +2,9 @@ package cmds
 
 import (
 	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
 	"reflect"
 	"strings"
 	"testing"
@@ -16,6 +19,15 @@ func TestCommandSuccessful(t *testing.T) {
 	}
 }
 
+func TestCommandStdin(t *testing.T) {
+	c := NewCommandLine(nil, "cat", nil, nil)
+	c.Stdin = strings.NewReader("kind: Secret\n")
+	stdout, stderr, err := c.Program().Execute()
+	if err != nil || string(stdout) != "kind: Secret\n" {
+		t.Errorf("expected stdin in stdout, stdout: %v, stderr: %v, err: %v", string(stdout), string(stderr), err)
+	}
+}
+
 func TestCommandNotFound(t *testing.T) {
 	cmd := "im-not-a-command"
 	c := NewCommandLine(nil, cmd, nil, nil)
@@ -84,3 +96,25 @@ func TestLinkedListRemove(t *testing.T) {
 	fmt.Printf("after: %v\n", strings.Join(root.GetAll(), " "))
 
 }
+
+func TestPrependPath(t *testing.T) {
+	defer os.Setenv("PATH", os.Getenv("PATH"))
+	dir, err := ioutil.TempDir("", "prepend_path_test_")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	ioutil.WriteFile(filepath.Join(dir, "cake-test-tool"), []byte("#!/bin/sh\necho installed\n"), 0755)
+
+	if err = PrependPath(dir); err != nil {
+		t.Fatal(err)
+	}
+	if err = PrependPath(dir); err != nil || strings.Count(os.Getenv("PATH"), dir) != 1 {
+		t.Errorf("got PATH %s, %v, want %s once", os.Getenv("PATH"), err, dir)
+	}
+	c := NewCommandLine(map[string]string{"CAKE": "test"}, "cake-test-tool", nil, nil)
+	stdout, _, err := c.Program().Execute()
+	if !c.Program().Exists() || err != nil || string(stdout) != "installed\n" {
+		t.Errorf("got %q, %v running a command in the prepended dir", stdout, err)
+	}
+}
@@ -0,0 +1,278 @@
+// Package schema generates JSON Schemas for the config file from its Go types and checks documents against them
+package schema
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+)
+
+// Draft is the JSON Schema version of the generated schemas
+const Draft = "http://json-schema.org/draft-07/schema#"
+
+// Enum is implemented by string types that only allow some values, like types.IPAMProvider
+type Enum interface {
+	Enum() []string
+}
+
+var enumType = reflect.TypeOf((*Enum)(nil)).Elem()
+
+// Schema is a JSON Schema document, or a subschema of one
+type Schema struct {
+	Schema               string             `json:"$schema,omitempty"`
+	Title                string             `json:"title,omitempty"`
+	Type                 string             `json:"type,omitempty"`
+	Properties           map[string]*Schema `json:"properties,omitempty"`
+	Required             []string           `json:"required,omitempty"`
+	AdditionalProperties interface{}        `json:"additionalProperties,omitempty"`
+	Items                *Schema            `json:"items,omitempty"`
+	Enum                 []string           `json:"enum,omitempty"`
+}
+
+// UnmarshalJSON decodes additionalProperties into false or a *Schema, so a published schema can be validated against
+func (s *Schema) UnmarshalJSON(data []byte) error {
+	type plain Schema
+	var raw struct {
+		plain
+		AdditionalProperties json.RawMessage `json:"additionalProperties,omitempty"`
+	}
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return err
+	}
+	*s = Schema(raw.plain)
+	switch string(raw.AdditionalProperties) {
+	case "":
+	case "false":
+		s.AdditionalProperties = false
+	case "true":
+		s.AdditionalProperties = true
+	default:
+		additional := &Schema{}
+		if err := json.Unmarshal(raw.AdditionalProperties, additional); err != nil {
+			return err
+		}
+		s.AdditionalProperties = additional
+	}
+	return nil
+}
+
+// Generate returns the schema of the type of v. Properties are named by their yaml tags, inline structs are merged
+// into their parent and unexported fields are left out. Objects don't allow unknown properties, like the config
+// decoders. A `jsonschema:"required"` tag makes a property required and `jsonschema:"enum=a,enum=b"` limits its values.
+func Generate(title string, v interface{}) (*Schema, error) {
+	s, err := typeSchema(reflect.TypeOf(v))
+	if err != nil {
+		return nil, err
+	}
+	s.Schema = Draft
+	s.Title = title
+	return s, nil
+}
+
+// Marshal generates the schema and returns it as indented JSON
+func Marshal(title string, v interface{}) ([]byte, error) {
+	s, err := Generate(title, v)
+	if err != nil {
+		return nil, err
+	}
+	out, err := json.MarshalIndent(s, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	return append(out, '\n'), nil
+}
+
+func typeSchema(t reflect.Type) (*Schema, error) {
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	if t.Implements(enumType) {
+		return &Schema{Type: "string", Enum: reflect.Zero(t).Interface().(Enum).Enum()}, nil
+	}
+
+	switch t.Kind() {
+	case reflect.String:
+		return &Schema{Type: "string"}, nil
+	case reflect.Bool:
+		return &Schema{Type: "boolean"}, nil
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return &Schema{Type: "integer"}, nil
+	case reflect.Float32, reflect.Float64:
+		return &Schema{Type: "number"}, nil
+	case reflect.Interface:
+		return &Schema{}, nil
+	case reflect.Slice, reflect.Array:
+		items, err := typeSchema(t.Elem())
+		if err != nil {
+			return nil, err
+		}
+		return &Schema{Type: "array", Items: items}, nil
+	case reflect.Map:
+		if t.Key().Kind() != reflect.String {
+			return nil, fmt.Errorf("map %s must have string keys", t)
+		}
+		values, err := typeSchema(t.Elem())
+		if err != nil {
+			return nil, err
+		}
+		return &Schema{Type: "object", AdditionalProperties: values}, nil
+	case reflect.Struct:
+		s := &Schema{Type: "object", Properties: map[string]*Schema{}, AdditionalProperties: false}
+		err := addFields(s, t)
+		if err != nil {
+			return nil, err
+		}
+		sort.Strings(s.Required)
+		return s, nil
+	}
+	return nil, fmt.Errorf("unsupported type %s", t)
+}
+
+// addFields adds the properties of a struct's fields to the schema
+func addFields(s *Schema, t reflect.Type) error {
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		name, inline := yamlName(f)
+		if name == "-" || (f.PkgPath != "" && !f.Anonymous) {
+			continue
+		}
+		if inline {
+			ft := f.Type
+			for ft.Kind() == reflect.Ptr {
+				ft = ft.Elem()
+			}
+			if err := addFields(s, ft); err != nil {
+				return err
+			}
+			continue
+		}
+
+		p, err := typeSchema(f.Type)
+		if err != nil {
+			return fmt.Errorf("%s.%s: %v", t.Name(), f.Name, err)
+		}
+		for _, option := range strings.Split(f.Tag.Get("jsonschema"), ",") {
+			switch {
+			case option == "required":
+				s.Required = append(s.Required, name)
+			case strings.HasPrefix(option, "enum="):
+				p.Enum = append(p.Enum, strings.TrimPrefix(option, "enum="))
+			}
+		}
+		s.Properties[name] = p
+	}
+	return nil
+}
+
+// yamlName returns the property name of a field and whether it's inlined into its parent
+func yamlName(f reflect.StructField) (string, bool) {
+	parts := strings.Split(f.Tag.Get("yaml"), ",")
+	for _, option := range parts[1:] {
+		if option == "inline" {
+			return "", true
+		}
+	}
+	if parts[0] != "" {
+		return parts[0], false
+	}
+	return f.Name, f.Anonymous && f.Type.Kind() == reflect.Struct
+}
+
+// Validate checks a document decoded from JSON or YAML against the subset of JSON Schema Generate uses,
+// it returns a problem for each property that doesn't match
+func (s *Schema) Validate(doc interface{}) []string {
+	return s.validate("", doc)
+}
+
+func (s *Schema) validate(path string, doc interface{}) []string {
+	name := path
+	if name == "" {
+		name = "config"
+	}
+	if len(s.Enum) > 0 {
+		v, _ := doc.(string)
+		found := false
+		for _, e := range s.Enum {
+			found = found || e == v
+		}
+		if !found {
+			return []string{fmt.Sprintf("%s must be one of %q", name, s.Enum)}
+		}
+	}
+
+	var problems []string
+	switch s.Type {
+	case "string", "boolean", "number", "integer", "array", "object":
+		if t := jsonType(doc); t != s.Type && !(s.Type == "number" && t == "integer") {
+			return []string{fmt.Sprintf("%s must be %s, not %s", name, article(s.Type), t)}
+		}
+	}
+	switch v := doc.(type) {
+	case []interface{}:
+		for i, item := range v {
+			problems = append(problems, s.Items.validate(fmt.Sprintf("%s[%d]", path, i), item)...)
+		}
+	case map[string]interface{}:
+		for _, r := range s.Required {
+			if _, ok := v[r]; !ok {
+				problems = append(problems, fmt.Sprintf("%s is required", join(path, r)))
+			}
+		}
+		var keys []string
+		for k := range v {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		for _, k := range keys {
+			if p, ok := s.Properties[k]; ok {
+				problems = append(problems, p.validate(join(path, k), v[k])...)
+			} else if additional, ok := s.AdditionalProperties.(*Schema); ok {
+				problems = append(problems, additional.validate(join(path, k), v[k])...)
+			} else if s.AdditionalProperties == false {
+				problems = append(problems, fmt.Sprintf("%s is not a known property", join(path, k)))
+			}
+		}
+	}
+	return problems
+}
+
+// jsonType returns the JSON Schema type of a decoded value
+func jsonType(v interface{}) string {
+	switch n := v.(type) {
+	case nil:
+		return "null"
+	case string:
+		return "string"
+	case bool:
+		return "boolean"
+	case float64:
+		if n == float64(int64(n)) {
+			return "integer"
+		}
+		return "number"
+	case int, int64:
+		return "integer"
+	case []interface{}:
+		return "array"
+	case map[string]interface{}:
+		return "object"
+	}
+	return fmt.Sprintf("%T", v)
+}
+
+func article(t string) string {
+	if t == "integer" || t == "object" || t == "array" {
+		return "an " + t
+	}
+	return "a " + t
+}
+
+func join(path, property string) string {
+	if path == "" {
+		return property
+	}
+	return path + "." + property
+}
@@ -0,0 +1,88 @@
+package schema
+
+import (
+	"encoding/json"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+type color string
+
+func (color) Enum() []string {
+	return []string{"red", "green"}
+}
+
+type base struct {
+	Name string `yaml:"name" jsonschema:"required"`
+}
+
+type testConfig struct {
+	base    `yaml:",inline"`
+	Count   int32               `yaml:"Count"`
+	Ratio   float64             `yaml:"Ratio,omitempty"`
+	Color   color               `yaml:"Color"`
+	Mode    string              `yaml:"Mode" jsonschema:"enum=,enum=fast"`
+	Labels  map[string]string   `yaml:"Labels"`
+	Items   []struct{ On bool } `yaml:"Items"`
+	Ignored string              `yaml:"-"`
+	hidden  string
+}
+
+func TestGenerate(t *testing.T) {
+	s, err := Generate("test", testConfig{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	out, err := json.Marshal(s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := `{"$schema":"http://json-schema.org/draft-07/schema#","title":"test","type":"object","properties":{` +
+		`"Color":{"type":"string","enum":["red","green"]},"Count":{"type":"integer"},` +
+		`"Items":{"type":"array","items":{"type":"object","properties":{"On":{"type":"boolean"}},"additionalProperties":false}},` +
+		`"Labels":{"type":"object","additionalProperties":{"type":"string"}},"Mode":{"type":"string","enum":["","fast"]},` +
+		`"Ratio":{"type":"number"},"name":{"type":"string"}},"required":["name"],"additionalProperties":false}`
+	if string(out) != want {
+		t.Errorf("got schema\n%s\nwant\n%s", out, want)
+	}
+
+	if _, err = Generate("test", struct{ C chan int }{}); err == nil {
+		t.Error("expected an error for an unsupported type")
+	}
+}
+
+func TestValidate(t *testing.T) {
+	s, err := Generate("test", testConfig{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	out, err := json.Marshal(s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s = &Schema{}
+	if err = json.Unmarshal(out, s); err != nil {
+		t.Fatal(err)
+	}
+
+	var valid interface{}
+	json.Unmarshal([]byte(`{"name":"a","Count":3,"Ratio":1,"Color":"red","Mode":"","Labels":{"a":"b"},"Items":[{"On":true}]}`), &valid)
+	if problems := s.Validate(valid); problems != nil {
+		t.Errorf("got problems %v", problems)
+	}
+
+	var invalid interface{}
+	json.Unmarshal([]byte(`{"Count":1.5,"Color":"blue","Labels":{"a":1},"Items":[{"On":"yes"}],"Extra":true}`), &invalid)
+	want := []string{
+		"name is required",
+		"Color must be one of [\"red\" \"green\"]",
+		"Count must be an integer, not number",
+		"Extra is not a known property",
+		"Items[0].On must be a boolean, not string",
+		"Labels.a must be a string, not integer",
+	}
+	if problems := s.Validate(invalid); !reflect.DeepEqual(problems, want) {
+		t.Errorf("got problems\n%s\nwant\n%s", strings.Join(problems, "\n"), strings.Join(want, "\n"))
+	}
+}
@@ -0,0 +1,135 @@
+package types
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"regexp"
+	"sort"
+
+	"k8s.io/apimachinery/pkg/util/version"
+	"sigs.k8s.io/yaml"
+)
+
+// KubernetesRelease maps a supported Kubernetes version to the node and load balancer templates its
+// clusters are cloned from and the OVAs they're imported from. A Checksum is the hex SHA-256 of the
+// OVA or the URL of a sha256sum file for it.
+type KubernetesRelease struct {
+	KubernetesVersion    string `yaml:"KubernetesVersion" json:"kubernetesversion"`
+	OS                   string `yaml:"OS" json:"os"`
+	NodeTemplate         string `yaml:"NodeTemplate" json:"nodetemplate"`
+	OVA                  string `yaml:"OVA" json:"ova"`
+	Checksum             string `yaml:"Checksum,omitempty" json:"checksum,omitempty"`
+	LoadBalancerTemplate string `yaml:"LoadBalancerTemplate" json:"loadbalancertemplate"`
+	LoadBalancerOVA      string `yaml:"LoadBalancerOVA" json:"loadbalancerova"`
+	LoadBalancerChecksum string `yaml:"LoadBalancerChecksum,omitempty" json:"loadbalancerchecksum,omitempty"`
+}
+
+// Catalog is a list of supported Kubernetes releases
+type Catalog struct {
+	Releases []KubernetesRelease `yaml:"Releases" json:"releases"`
+}
+
+const (
+	capvImages          = "https://storage.googleapis.com/capv-images"
+	haproxyTemplate     = "capv-haproxy-v0.6.0-rc.2"
+	haproxyOVA          = capvImages + "/extra/haproxy/release/v0.6.0-rc.2/" + haproxyTemplate + ".ova"
+	catalogNodeTemplate = "ubuntu-1804-kube-%s"
+	catalogNodeOVA      = capvImages + "/release/%s/ubuntu-1804-kube-%s.ova"
+)
+
+// DefaultCatalog are the releases available without a catalog file, the CAPV Ubuntu 18.04 images
+var DefaultCatalog = Catalog{Releases: []KubernetesRelease{
+	capvRelease("v1.16.8"),
+	capvRelease("v1.17.3"),
+}}
+
+// capvRelease is the release of a version published in the CAPV image bucket, which has a sha256sum file next to each OVA
+func capvRelease(kubernetesVersion string) KubernetesRelease {
+	ova := fmt.Sprintf(catalogNodeOVA, kubernetesVersion, kubernetesVersion)
+	return KubernetesRelease{
+		KubernetesVersion:    kubernetesVersion,
+		OS:                   "ubuntu-1804",
+		NodeTemplate:         fmt.Sprintf(catalogNodeTemplate, kubernetesVersion),
+		OVA:                  ova,
+		Checksum:             ova + ".sha256",
+		LoadBalancerTemplate: haproxyTemplate,
+		LoadBalancerOVA:      haproxyOVA,
+		LoadBalancerChecksum: haproxyOVA + ".sha256",
+	}
+}
+
+// templateVersion matches the Kubernetes version in a node template name, like ubuntu-1804-kube-v1.17.3
+var templateVersion = regexp.MustCompile(`v\d+\.\d+\.\d+`)
+
+// LoadCatalog returns the default catalog with the releases in the file added to it, a release in the
+// file replaces the default release of the same version. A file that doesn't exist is ignored.
+func LoadCatalog(file string) (Catalog, error) {
+	releases := map[string]KubernetesRelease{}
+	for _, r := range DefaultCatalog.Releases {
+		releases[r.KubernetesVersion] = r
+	}
+
+	contents, err := ioutil.ReadFile(file)
+	if err != nil && !os.IsNotExist(err) {
+		return Catalog{}, err
+	}
+	if err == nil {
+		var local Catalog
+		err = yaml.UnmarshalStrict(contents, &local)
+		if err != nil {
+			return Catalog{}, fmt.Errorf("invalid catalog %s, %v", file, err)
+		}
+		for _, r := range local.Releases {
+			if r.KubernetesVersion == "" || r.NodeTemplate == "" {
+				return Catalog{}, fmt.Errorf("invalid catalog %s, every release needs a KubernetesVersion and NodeTemplate", file)
+			}
+			if _, err = version.ParseSemantic(r.KubernetesVersion); err != nil {
+				return Catalog{}, fmt.Errorf("invalid catalog %s, %v", file, err)
+			}
+			releases[r.KubernetesVersion] = r
+		}
+	}
+
+	var c Catalog
+	for _, r := range releases {
+		c.Releases = append(c.Releases, r)
+	}
+	sort.Slice(c.Releases, func(i, j int) bool {
+		return version.MustParseSemantic(c.Releases[i].KubernetesVersion).LessThan(version.MustParseSemantic(c.Releases[j].KubernetesVersion))
+	})
+	return c, nil
+}
+
+// Versions returns the catalog's Kubernetes versions
+func (c Catalog) Versions() []string {
+	var versions []string
+	for _, r := range c.Releases {
+		versions = append(versions, r.KubernetesVersion)
+	}
+	return versions
+}
+
+// Lookup returns the release of a Kubernetes version, false when the version isn't in the catalog
+func (c Catalog) Lookup(kubernetesVersion string) (KubernetesRelease, bool) {
+	for _, r := range c.Releases {
+		if r.KubernetesVersion == kubernetesVersion {
+			return r, true
+		}
+	}
+	return KubernetesRelease{}, false
+}
+
+// CheckTemplate returns an error when the node template is for another Kubernetes version,
+// either the catalog has it for another version or its name contains another version
+func (c Catalog) CheckTemplate(template, kubernetesVersion string) error {
+	for _, r := range c.Releases {
+		if r.NodeTemplate == template && r.KubernetesVersion != kubernetesVersion {
+			return fmt.Errorf("node template %s is for Kubernetes %s, not %s", template, r.KubernetesVersion, kubernetesVersion)
+		}
+	}
+	if v := templateVersion.FindString(template); v != "" && v != kubernetesVersion {
+		return fmt.Errorf("node template %s is for Kubernetes %s, not %s", template, v, kubernetesVersion)
+	}
+	return nil
+}
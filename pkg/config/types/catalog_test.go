@@ -0,0 +1,73 @@
+package types
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestLoadCatalog(t *testing.T) {
+	dir, err := ioutil.TempDir("", "catalog_test_")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	c, err := LoadCatalog(filepath.Join(dir, "missing.yaml"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(c, DefaultCatalog) {
+		t.Errorf("got catalog %+v without a file, want the default", c)
+	}
+
+	file := filepath.Join(dir, "catalog.yaml")
+	ioutil.WriteFile(file, []byte(`Releases:
+- KubernetesVersion: v1.17.3
+  OS: centos-7
+  NodeTemplate: centos-7-kube-v1.17.3
+  OVA: https://example.com/centos-7-kube-v1.17.3.ova
+- KubernetesVersion: v1.9.11
+  NodeTemplate: ubuntu-1804-kube-v1.9.11
+`), 0644)
+	c, err = LoadCatalog(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"v1.9.11", "v1.16.8", "v1.17.3"}; !reflect.DeepEqual(c.Versions(), want) {
+		t.Errorf("got versions %v, want %v", c.Versions(), want)
+	}
+	if r, ok := c.Lookup("v1.17.3"); !ok || r.NodeTemplate != "centos-7-kube-v1.17.3" {
+		t.Errorf("got release %+v, want the file's", r)
+	}
+
+	ioutil.WriteFile(file, []byte("Releases:\n- KubernetesVersion: latest\n  NodeTemplate: ubuntu\n"), 0644)
+	if _, err = LoadCatalog(file); err == nil {
+		t.Error("expected an error for an invalid version")
+	}
+}
+
+func TestCheckTemplate(t *testing.T) {
+	c := Catalog{Releases: []KubernetesRelease{
+		{KubernetesVersion: "v1.16.8", NodeTemplate: "k8s-old"},
+		{KubernetesVersion: "v1.17.3", NodeTemplate: "ubuntu-1804-kube-v1.17.3"},
+	}}
+	tests := []struct {
+		template, version string
+		valid             bool
+	}{
+		{"ubuntu-1804-kube-v1.17.3", "v1.17.3", true},
+		{"ubuntu-1804-kube-v1.17.3", "v1.16.8", false},
+		{"k8s-old", "v1.17.3", false},
+		{"centos-7-kube-v1.16.8", "v1.17.3", false},
+		{"my-template", "v1.17.3", true},
+	}
+	for _, tt := range tests {
+		err := c.CheckTemplate(tt.template, tt.version)
+		if (err == nil) != tt.valid {
+			t.Errorf("CheckTemplate(%s, %s) = %v, want valid %v", tt.template, tt.version, err, tt.valid)
+		}
+	}
+}
@@ -1,7 +1,14 @@
 package types
 
-// ConfigSpec holds information needed to register HCI with NKS
+import (
+	"fmt"
+	"strings"
+)
+
+// ConfigSpec holds information needed to register HCI with NKS, it's the v1alpha1 config file
 type ConfigSpec struct {
+	APIVersion            string        `yaml:"apiVersion" json:"apiVersion" jsonschema:"enum=cake.netapp.io/v1alpha1"`
+	Kind                  string        `yaml:"kind" json:"kind" jsonschema:"enum=Config"`
 	Provider              string        `yaml:"Provider" json:"provider"`
 	VCenterURL            string        `yaml:"VCenterURL" json:"vcenterurl"`
 	VCenterUser           string        `yaml:"VCenterUser" json:"vcenteruser"`
@@ -34,6 +41,8 @@ type Configuration struct {
 	Components ComponentSpec `yaml:"Components,omitempty" json:"components,omitempty"`
 	Bintray    BintraySpec   `yaml:"Bintray,omitempty" json:"bintray,omitempty"`
 
+	Sizes map[string]MachineSize `yaml:"Sizes,omitempty" json:"sizes,omitempty"`
+
 	Observability ObservabilitySpec `yaml:"Observability,omitempty" json:"observability,omitempty"`
 }
 
@@ -54,6 +63,38 @@ func (spec *ClusterSpec) NodeCount() int {
 	return spec.MasterCount + spec.WorkerCount
 }
 
+// MachineSize sets the virtual hardware of a node
+type MachineSize struct {
+	NumCPUs   int32 `yaml:"NumCPUs" json:"numcpus"`
+	MemoryMiB int64 `yaml:"MemoryMiB" json:"memorymib"`
+	DiskGiB   int32 `yaml:"DiskGiB" json:"diskgib"`
+	// FullClone clones the node template fully so the disk can grow to DiskGiB, linked clones are much
+	// faster but keep the template's disk
+	FullClone bool `yaml:"FullClone" json:"fullclone"`
+}
+
+// DefaultMachineSizes are the size profiles available without any configuration
+var DefaultMachineSizes = map[string]MachineSize{
+	"small":  {NumCPUs: 2, MemoryMiB: 8192, DiskGiB: 25},
+	"medium": {NumCPUs: 4, MemoryMiB: 16384, DiskGiB: 50},
+	"large":  {NumCPUs: 8, MemoryMiB: 32768, DiskGiB: 100},
+}
+
+// LookupMachineSize returns the named size profile, sizes take precedence over the defaults.
+// Names are case insensitive.
+func LookupMachineSize(name string, sizes map[string]MachineSize) (MachineSize, error) {
+	name = strings.ToLower(name)
+	for n, size := range sizes {
+		if strings.ToLower(n) == name {
+			return size, nil
+		}
+	}
+	if size, ok := DefaultMachineSizes[name]; ok {
+		return size, nil
+	}
+	return MachineSize{}, fmt.Errorf("unknown machine size %q", name)
+}
+
 // ComponentSpec sets versions for binaries and images that must be downloaded
 type ComponentSpec struct {
 	ChandlerImage                 string `yaml:"ChandlerImage,omitempty" json:"chandlerimage,omitempty"`
@@ -100,10 +141,15 @@ const (
 	Infoblox       IPAMProvider = "Infoblox"
 )
 
+// Enum returns the IPAM providers
+func (IPAMProvider) Enum() []string {
+	return []string{string(DHCP), string(MNodeIPService), string(Infoblox)}
+}
+
 type IPAMConfig struct {
 	Provider IPAMProvider   `yaml:"Provider" json:"provider"`
-	MNode    MNodeConfig    `yaml:"MNodeConfig,omitempty" json:"mnodeconfig,omitempty"`
-	Infoblox InfobloxConfig `yaml:"InfobloxConfig,omitempty" json:"infobloxconfig,omitempty"`
+	MNode    MNodeConfig    `yaml:"MNodeConfig,omitempty" json:"mnodeconfig,omitempty" mapstructure:"MNodeConfig"`
+	Infoblox InfobloxConfig `yaml:"InfobloxConfig,omitempty" json:"infobloxconfig,omitempty" mapstructure:"InfobloxConfig"`
 }
 
 type MNodeConfig struct {
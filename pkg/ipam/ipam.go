@@ -0,0 +1,44 @@
+// Package ipam reserves static IP addresses for virtual machines from an IP address management service
+package ipam
+
+import (
+	"context"
+	"net"
+	"strconv"
+)
+
+// Client reserves and releases addresses. Reservations are named after the machine they're for and
+// owned by a cluster, so whatever is left of a cluster's reservations can be released when it's deleted.
+type Client interface {
+	// Reserve returns the address reserved for name on the network, reserving one if there isn't one yet
+	Reserve(ctx context.Context, name, network string) (Address, error)
+	// Release releases the address reserved for name, it's not an error if there isn't one
+	Release(ctx context.Context, name string) error
+	// List returns the owner's reservations
+	List(ctx context.Context) ([]Address, error)
+}
+
+// Address is a reserved address with the settings of its subnet
+type Address struct {
+	Name        string   `json:"name"`
+	Network     string   `json:"network"`
+	Owner       string   `json:"owner"`
+	IP          string   `json:"address"`
+	Prefix      int      `json:"prefix"`
+	Gateway     string   `json:"gateway"`
+	Nameservers []string `json:"nameservers"`
+}
+
+// CIDR returns the address with its prefix length, like 10.0.0.5/24
+func (a Address) CIDR() string {
+	return a.IP + "/" + strconv.Itoa(a.Prefix)
+}
+
+// Netmask returns the subnet mask of the address, like 255.255.255.0
+func (a Address) Netmask() string {
+	bits := 32
+	if ip := net.ParseIP(a.IP); ip != nil && ip.To4() == nil {
+		bits = 128
+	}
+	return net.IP(net.CIDRMask(a.Prefix, bits)).String()
+}
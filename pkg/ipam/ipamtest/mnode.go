@@ -0,0 +1,175 @@
+// Package ipamtest provides a fake management node IP service for tests
+package ipamtest
+
+import (
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+
+	"github.com/netapp/cake/pkg/config/types"
+	"github.com/netapp/cake/pkg/ipam"
+)
+
+const (
+	// Secret is the client secret the fake auth service accepts
+	Secret = "fake-secret"
+	// Network is the only network the fake IP service has addresses on
+	Network = "VM Network"
+
+	token      = "fake-token"
+	tokenPath  = "/auth/connect/token"
+	apiPath    = "/ipam/v1/reservations"
+	firstHost  = 10
+	subnetSize = 24
+)
+
+// MNodeServer is a TLS httptest server with the auth and IP services of a management node. It reserves
+// addresses from 10.20.0.10 to 10.20.0.254 on the Network, with 10.20.0.1 as the gateway and nameserver.
+type MNodeServer struct {
+	*httptest.Server
+
+	mu           sync.Mutex
+	reservations map[string]ipam.Address
+}
+
+// NewMNodeServer starts a fake management node, Close it when done
+func NewMNodeServer() *MNodeServer {
+	s := &MNodeServer{reservations: map[string]ipam.Address{}}
+	mux := http.NewServeMux()
+	mux.HandleFunc(tokenPath, s.token)
+	mux.HandleFunc(apiPath, s.authenticated(s.reservationList))
+	mux.HandleFunc(apiPath+"/", s.authenticated(s.reservation))
+	s.Server = httptest.NewTLSServer(mux)
+	return s
+}
+
+// Config returns the IPAM config of the fake management node
+func (s *MNodeServer) Config() types.MNodeConfig {
+	return types.MNodeConfig{
+		IP:          s.Listener.Addr().String(),
+		Path:        "ipam",
+		Version:     "v1",
+		AuthHostURL: s.URL + tokenPath,
+		AuthSecret:  Secret,
+		TLSInsecure: true,
+	}
+}
+
+// Reservations returns the reserved addresses by name
+func (s *MNodeServer) Reservations() map[string]ipam.Address {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	reservations := map[string]ipam.Address{}
+	for name, a := range s.reservations {
+		reservations[name] = a
+	}
+	return reservations
+}
+
+func (s *MNodeServer) token(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost || r.FormValue("grant_type") != "client_credentials" ||
+		r.FormValue("client_id") != ipam.MNodeClientID || r.FormValue("client_secret") != Secret {
+		http.Error(w, "invalid client", http.StatusUnauthorized)
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]interface{}{"access_token": token, "token_type": "Bearer", "expires_in": 3600})
+}
+
+func (s *MNodeServer) authenticated(handler http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer "+token {
+			http.Error(w, "invalid token", http.StatusUnauthorized)
+			return
+		}
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		handler(w, r)
+	}
+}
+
+// reservationList lists an owner's reservations and reserves addresses
+func (s *MNodeServer) reservationList(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		owner := r.URL.Query().Get("owner")
+		addresses := []ipam.Address{}
+		for _, a := range s.reservations {
+			if a.Owner == owner {
+				addresses = append(addresses, a)
+			}
+		}
+		writeJSON(w, http.StatusOK, addresses)
+	case http.MethodPost:
+		var req ipam.Address
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.Name == "" || req.Owner == "" {
+			http.Error(w, "a reservation needs a name and owner", http.StatusBadRequest)
+			return
+		}
+		if req.Network != Network {
+			http.Error(w, fmt.Sprintf("no subnet on network %q", req.Network), http.StatusBadRequest)
+			return
+		}
+		if a, ok := s.reservations[req.Name]; ok {
+			writeJSON(w, http.StatusOK, a)
+			return
+		}
+		ip := s.freeAddress()
+		if ip == "" {
+			http.Error(w, "no free addresses", http.StatusConflict)
+			return
+		}
+		a := ipam.Address{
+			Name:        req.Name,
+			Network:     req.Network,
+			Owner:       req.Owner,
+			IP:          ip,
+			Prefix:      subnetSize,
+			Gateway:     "10.20.0.1",
+			Nameservers: []string{"10.20.0.1"},
+		}
+		s.reservations[a.Name] = a
+		writeJSON(w, http.StatusCreated, a)
+	default:
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// reservation releases a reservation
+func (s *MNodeServer) reservation(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodDelete {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	name := strings.TrimPrefix(r.URL.Path, apiPath+"/")
+	if _, ok := s.reservations[name]; !ok {
+		http.NotFound(w, r)
+		return
+	}
+	delete(s.reservations, name)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// freeAddress returns the lowest address that isn't reserved
+func (s *MNodeServer) freeAddress() string {
+	used := map[string]bool{}
+	for _, a := range s.reservations {
+		used[a.IP] = true
+	}
+	for host := firstHost; host < 255; host++ {
+		ip := net.IPv4(10, 20, 0, byte(host)).String()
+		if !used[ip] {
+			return ip
+		}
+	}
+	return ""
+}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
@@ -0,0 +1,185 @@
+package ipam
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"path"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/netapp/cake/pkg/config/types"
+)
+
+// MNodeClientID is the OAuth client the management node's auth service knows cake by
+const MNodeClientID = "mnode-client"
+
+// mnodeClient talks to the NetApp HCI management node IP service at https://<IP>/<Path>/<Version>,
+// authenticating with a client credentials token from the AuthHostURL. It's experimental, the
+// reservations API and the OAuth client are assumed and not written against a published spec.
+type mnodeClient struct {
+	config types.MNodeConfig
+	owner  string
+	base   url.URL
+	http   *http.Client
+
+	mu      sync.Mutex
+	token   string
+	expires time.Time
+}
+
+// NewMNodeClient returns a client of the management node IP service for the owner's reservations
+func NewMNodeClient(config types.MNodeConfig, owner string) (Client, error) {
+	if config.IP == "" || config.AuthHostURL == "" || config.AuthSecret == "" {
+		return nil, fmt.Errorf("the MNode IP service needs an IP, AuthHostURL and AuthSecret")
+	}
+	if owner == "" {
+		return nil, fmt.Errorf("IP address reservations need an owner")
+	}
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.TLSClientConfig = &tls.Config{InsecureSkipVerify: config.TLSInsecure}
+	return &mnodeClient{
+		config: config,
+		owner:  owner,
+		base:   url.URL{Scheme: "https", Host: config.IP, Path: path.Join("/", config.Path, config.Version)},
+		http:   &http.Client{Transport: transport, Timeout: 30 * time.Second},
+	}, nil
+}
+
+// Reserve reserves an address for name on the network, the service returns the existing reservation if there is one
+func (c *mnodeClient) Reserve(ctx context.Context, name, network string) (Address, error) {
+	var a Address
+	body := Address{Name: name, Network: network, Owner: c.owner}
+	err := c.do(ctx, http.MethodPost, "reservations", nil, body, &a)
+	if err != nil {
+		return a, fmt.Errorf("unable to reserve an IP address for %s, %v", name, err)
+	}
+	if a.IP == "" || a.Prefix == 0 {
+		return a, fmt.Errorf("the IP service reserved no address for %s", name)
+	}
+	return a, nil
+}
+
+// Release releases the address reserved for name
+func (c *mnodeClient) Release(ctx context.Context, name string) error {
+	err := c.do(ctx, http.MethodDelete, "reservations/"+url.PathEscape(name), nil, nil, nil)
+	if err != nil && err != errNotFound {
+		return fmt.Errorf("unable to release the IP address of %s, %v", name, err)
+	}
+	return nil
+}
+
+// List returns the owner's reservations
+func (c *mnodeClient) List(ctx context.Context) ([]Address, error) {
+	var addresses []Address
+	err := c.do(ctx, http.MethodGet, "reservations", url.Values{"owner": {c.owner}}, nil, &addresses)
+	if err != nil {
+		return nil, fmt.Errorf("unable to list the IP addresses of %s, %v", c.owner, err)
+	}
+	return addresses, nil
+}
+
+var errNotFound = fmt.Errorf("not found")
+
+// do sends an authenticated request to the IP service and decodes the response into out
+func (c *mnodeClient) do(ctx context.Context, method, resource string, query url.Values, in, out interface{}) error {
+	token, err := c.accessToken(ctx)
+	if err != nil {
+		return err
+	}
+	u := c.base
+	u.Path = path.Join(u.Path, resource)
+	u.RawQuery = query.Encode()
+	var body io.Reader
+	if in != nil {
+		b, err := json.Marshal(in)
+		if err != nil {
+			return err
+		}
+		body = bytes.NewReader(b)
+	}
+	req, err := http.NewRequest(method, u.String(), body)
+	if err != nil {
+		return err
+	}
+	req = req.WithContext(ctx)
+	req.Header.Set("Authorization", "Bearer "+token)
+	req.Header.Set("Accept", "application/json")
+	if in != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode == http.StatusNotFound {
+		return errNotFound
+	}
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return responseError(resp)
+	}
+	if out == nil {
+		return nil
+	}
+	err = json.NewDecoder(resp.Body).Decode(out)
+	if err != nil {
+		return fmt.Errorf("error with unmarshal: %v", err)
+	}
+	return nil
+}
+
+// accessToken returns the cached token, or a new one from the auth service when it's about to expire
+func (c *mnodeClient) accessToken(ctx context.Context) (string, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.token != "" && time.Now().Before(c.expires) {
+		return c.token, nil
+	}
+
+	form := url.Values{
+		"grant_type":    {"client_credentials"},
+		"client_id":     {MNodeClientID},
+		"client_secret": {c.config.AuthSecret},
+	}
+	req, err := http.NewRequest(http.MethodPost, c.config.AuthHostURL, strings.NewReader(form.Encode()))
+	if err != nil {
+		return "", err
+	}
+	req = req.WithContext(ctx)
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("unable to authenticate with %s, %v", c.config.AuthHostURL, err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("unable to authenticate with %s, %v", c.config.AuthHostURL, responseError(resp))
+	}
+	var token struct {
+		AccessToken string `json:"access_token"`
+		ExpiresIn   int    `json:"expires_in"`
+	}
+	err = json.NewDecoder(resp.Body).Decode(&token)
+	if err != nil || token.AccessToken == "" {
+		return "", fmt.Errorf("invalid token from %s, %v", c.config.AuthHostURL, err)
+	}
+	c.token = token.AccessToken
+	// renew the token a minute before it expires
+	c.expires = time.Now().Add(time.Duration(token.ExpiresIn)*time.Second - time.Minute)
+	return c.token, nil
+}
+
+// responseError returns the status and body of a failed request
+func responseError(resp *http.Response) error {
+	b, _ := ioutil.ReadAll(io.LimitReader(resp.Body, 1024))
+	return fmt.Errorf("%s: %s", resp.Status, strings.TrimSpace(string(b)))
+}
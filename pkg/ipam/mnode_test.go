@@ -0,0 +1,79 @@
+package ipam_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/netapp/cake/pkg/ipam"
+	"github.com/netapp/cake/pkg/ipam/ipamtest"
+)
+
+func TestMNodeClient(t *testing.T) {
+	s := ipamtest.NewMNodeServer()
+	defer s.Close()
+	ctx := context.Background()
+
+	c, err := ipam.NewMNodeClient(s.Config(), "mgmt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	first, err := c.Reserve(ctx, "mgmt-abcde", ipamtest.Network)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if first.CIDR() != "10.20.0.10/24" || first.Netmask() != "255.255.255.0" || first.Gateway != "10.20.0.1" {
+		t.Errorf("got address %+v", first)
+	}
+	again, err := c.Reserve(ctx, "mgmt-abcde", ipamtest.Network)
+	if err != nil || again.IP != first.IP {
+		t.Errorf("got %+v, %v reserving again, want the same address", again, err)
+	}
+	second, err := c.Reserve(ctx, "mgmt-md-0-fghij", ipamtest.Network)
+	if err != nil || second.IP != "10.20.0.11" {
+		t.Errorf("got %+v, %v, want the next address", second, err)
+	}
+	if _, err = c.Reserve(ctx, "mgmt-klmno", "Storage Network"); err == nil {
+		t.Error("expected an error for a network without a subnet")
+	}
+
+	other, err := ipam.NewMNodeClient(s.Config(), "workload")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = other.Reserve(ctx, "workload-pqrst", ipamtest.Network); err != nil {
+		t.Fatal(err)
+	}
+	addresses, err := c.List(ctx)
+	if err != nil || len(addresses) != 2 {
+		t.Errorf("got %+v, %v, want the owner's 2 addresses", addresses, err)
+	}
+
+	if err = c.Release(ctx, first.Name); err != nil {
+		t.Fatal(err)
+	}
+	if err = c.Release(ctx, first.Name); err != nil {
+		t.Errorf("got %v releasing twice", err)
+	}
+	if _, ok := s.Reservations()[first.Name]; ok || len(s.Reservations()) != 2 {
+		t.Errorf("got reservations %+v after release", s.Reservations())
+	}
+
+	config := s.Config()
+	config.AuthSecret = "wrong"
+	c, err = ipam.NewMNodeClient(config, "mgmt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = c.List(ctx); err == nil {
+		t.Error("expected an error with the wrong secret")
+	}
+	config.TLSInsecure = false
+	config.AuthSecret = ipamtest.Secret
+	c, _ = ipam.NewMNodeClient(config, "mgmt")
+	if _, err = c.List(ctx); err == nil {
+		t.Error("expected an error for the self-signed certificate")
+	}
+	if _, err = ipam.NewMNodeClient(config, ""); err == nil {
+		t.Error("expected an error without an owner")
+	}
+}
@@ -94,3 +94,20 @@ network:
       {{- end }}
   {{- end }}
 `
+
+// GenerateMetadata templates the metadata values and returns them as extra config
+func GenerateMetadata(metadataValues *MetadataValues) (Config, error) {
+	metadata, err := GetMetadata(metadataValues)
+	if err != nil {
+		return nil, fmt.Errorf("unable to get cloud init metadata, %v", err)
+	}
+
+	var cloudinitMetadataConfig Config
+
+	err = cloudinitMetadataConfig.SetCloudInitMetadata(metadata)
+	if err != nil {
+		return nil, fmt.Errorf("unable to set cloud init metadata in extra config, %v", err)
+	}
+
+	return cloudinitMetadataConfig, nil
+}
@@ -0,0 +1,149 @@
+package vsphere
+
+import (
+	"context"
+	"fmt"
+
+	log "github.com/sirupsen/logrus"
+	"github.com/vmware/govmomi/find"
+	"github.com/vmware/govmomi/object"
+	"github.com/vmware/govmomi/vim25/types"
+)
+
+// EnsureAntiAffinityRule creates or updates a DRS rule keeping the virtual machines on separate hosts,
+// the virtual machines must all run in the same vSphere cluster
+func (r *Resource) EnsureAntiAffinityRule(ctx context.Context, name string, vms ...*object.VirtualMachine) error {
+	if len(vms) < 2 {
+		return fmt.Errorf("anti-affinity rule %s needs at least 2 virtual machines, got %d", name, len(vms))
+	}
+
+	cluster, err := vmCluster(ctx, vms[0])
+	if err != nil {
+		return err
+	}
+	var refs []types.ManagedObjectReference
+	for _, vm := range vms {
+		c, err := vmCluster(ctx, vm)
+		if err != nil {
+			return err
+		}
+		if c.Reference() != cluster.Reference() {
+			return fmt.Errorf("virtual machine %s is not in cluster %s", vm.Reference(), cluster.Reference())
+		}
+		refs = append(refs, vm.Reference())
+	}
+
+	config, err := cluster.Configuration(ctx)
+	if err != nil {
+		return fmt.Errorf("unable to get cluster configuration, %v", err)
+	}
+	if config.DrsConfig.Enabled == nil || !*config.DrsConfig.Enabled {
+		log.Warnf("DRS is disabled on cluster %s, anti-affinity rule %s will not be enforced", cluster.Reference(), name)
+	}
+
+	rule := &types.ClusterAntiAffinityRuleSpec{
+		ClusterRuleInfo: types.ClusterRuleInfo{
+			Name:    name,
+			Enabled: types.NewBool(true),
+		},
+		Vm: refs,
+	}
+	operation := types.ArrayUpdateOperationAdd
+	for _, existing := range config.Rule {
+		info := existing.GetClusterRuleInfo()
+		if info.Name == name {
+			operation = types.ArrayUpdateOperationEdit
+			rule.Key = info.Key
+			break
+		}
+	}
+
+	log.Debugf("Setting anti-affinity rule %s on cluster %s", name, cluster.Reference())
+	return reconfigureRules(ctx, cluster, types.ClusterRuleSpec{
+		ArrayUpdateSpec: types.ArrayUpdateSpec{Operation: operation},
+		Info:            rule,
+	})
+}
+
+// DeleteRules removes the named DRS rules from every cluster in the datacenter, missing rules are ignored
+func (r *Resource) DeleteRules(ctx context.Context, names ...string) error {
+	client, err := r.SessionManager.GetClientContext(ctx)
+	if err != nil {
+		return fmt.Errorf("unable to get vSphere client, %v", err)
+	}
+	finder := find.NewFinder(client.Client, true)
+	finder.SetDatacenter(r.Datacenter)
+	clusters, err := finder.ClusterComputeResourceList(ctx, "*")
+	if err != nil {
+		if _, ok := err.(*find.NotFoundError); ok {
+			return nil
+		}
+		return fmt.Errorf("unable to list clusters, %v", err)
+	}
+
+	for _, cluster := range clusters {
+		config, err := cluster.Configuration(ctx)
+		if err != nil {
+			return fmt.Errorf("unable to get cluster configuration, %v", err)
+		}
+		var specs []types.ClusterRuleSpec
+		for _, existing := range config.Rule {
+			info := existing.GetClusterRuleInfo()
+			if !containsString(names, info.Name) {
+				continue
+			}
+			log.Debugf("Deleting DRS rule %s on cluster %s", info.Name, cluster.Reference())
+			specs = append(specs, types.ClusterRuleSpec{
+				ArrayUpdateSpec: types.ArrayUpdateSpec{
+					Operation: types.ArrayUpdateOperationRemove,
+					RemoveKey: info.Key,
+				},
+			})
+		}
+		if len(specs) == 0 {
+			continue
+		}
+		if err = reconfigureRules(ctx, cluster, specs...); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func reconfigureRules(ctx context.Context, cluster *object.ClusterComputeResource, rules ...types.ClusterRuleSpec) error {
+	task, err := cluster.Reconfigure(ctx, &types.ClusterConfigSpecEx{RulesSpec: rules}, true)
+	if err != nil {
+		return fmt.Errorf("unable to reconfigure cluster rules, %v", err)
+	}
+	if err = task.Wait(ctx); err != nil {
+		return fmt.Errorf("reconfigure cluster rules task failed, %v", err)
+	}
+	return nil
+}
+
+// vmCluster returns the vSphere cluster a virtual machine runs in
+func vmCluster(ctx context.Context, vm *object.VirtualMachine) (*object.ClusterComputeResource, error) {
+	pool, err := vm.ResourcePool(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("unable to get resource pool of %s, %v", vm.Reference(), err)
+	}
+	owner, err := pool.Owner(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("unable to get owner of resource pool %s, %v", pool.Reference(), err)
+	}
+	cluster, ok := owner.(*object.ClusterComputeResource)
+	if !ok {
+		return nil, fmt.Errorf("virtual machine %s is not in a vSphere cluster", vm.Reference())
+	}
+	return cluster, nil
+}
+
+func containsString(list []string, s string) bool {
+	for _, item := range list {
+		if item == s {
+			return true
+		}
+	}
+	return false
+}
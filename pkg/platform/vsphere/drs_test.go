@@ -0,0 +1,63 @@
+package vsphere
+
+import (
+	"context"
+	"testing"
+
+	"github.com/vmware/govmomi/object"
+	"github.com/vmware/govmomi/vim25/types"
+)
+
+func TestAntiAffinityRules(t *testing.T) {
+	sm, cleanup := newSimulatorManager(t)
+	defer cleanup()
+	r := newSimulatorResource(t, sm)
+
+	ctx := context.Background()
+	var vms []*object.VirtualMachine
+	for _, name := range []string{"DC0_C0_RP0_VM0", "DC0_C0_RP0_VM1"} {
+		vm, err := sm.GetVMContext(ctx, r.Datacenter, name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		vms = append(vms, vm)
+	}
+
+	if err := r.EnsureAntiAffinityRule(ctx, "test-control-plane", vms[:1]...); err == nil {
+		t.Errorf("expected a rule with a single VM to be rejected")
+	}
+	if err := r.EnsureAntiAffinityRule(ctx, "test-control-plane", vms...); err != nil {
+		t.Fatal(err)
+	}
+	// applying the rule again updates it in place
+	if err := r.EnsureAntiAffinityRule(ctx, "test-control-plane", vms...); err != nil {
+		t.Fatal(err)
+	}
+
+	cluster, err := vmCluster(ctx, vms[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	config, err := cluster.Configuration(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(config.Rule) != 1 {
+		t.Fatalf("got %d rules, want 1", len(config.Rule))
+	}
+	rule, ok := config.Rule[0].(*types.ClusterAntiAffinityRuleSpec)
+	if !ok || rule.Name != "test-control-plane" || len(rule.Vm) != 2 {
+		t.Errorf("got rule %+v, want an anti-affinity rule with both VMs", config.Rule[0])
+	}
+
+	if err = r.DeleteRules(ctx, "test-control-plane", "test-load-balancer"); err != nil {
+		t.Fatal(err)
+	}
+	config, err = cluster.Configuration(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(config.Rule) != 0 {
+		t.Errorf("got %d rules after delete, want 0", len(config.Rule))
+	}
+}
@@ -0,0 +1,174 @@
+package vsphere
+
+import (
+	"context"
+	"fmt"
+	"path"
+	"strings"
+
+	log "github.com/sirupsen/logrus"
+	"github.com/vmware/govmomi/find"
+	"github.com/vmware/govmomi/object"
+	"github.com/vmware/govmomi/vim25"
+	"github.com/vmware/govmomi/vim25/mo"
+	"github.com/vmware/govmomi/vim25/types"
+)
+
+// EnsureFolder returns the VM folder at the inventory path, creating any missing folders along the way.
+// A relative path is relative to the datacenter's VM folder, created folders are tagged as owned.
+func (r *Resource) EnsureFolder(ctx context.Context, folderPath string) (*object.Folder, error) {
+	client, err := r.SessionManager.GetClientContext(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("unable to get vSphere client, %v", err)
+	}
+	finder := find.NewFinder(client.Client, true)
+	finder.SetDatacenter(r.Datacenter)
+
+	dcFolders, err := r.Datacenter.Folders(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("unable to get datacenter folders, %v", err)
+	}
+	folder := dcFolders.VmFolder
+	if !path.IsAbs(folderPath) {
+		folderPath = path.Join(folder.InventoryPath, folderPath)
+	}
+	if !strings.HasPrefix(folderPath, folder.InventoryPath+"/") {
+		return nil, fmt.Errorf("folder %s is not in the VM folder %s", folderPath, folder.InventoryPath)
+	}
+
+	current := folder.InventoryPath
+	for _, name := range strings.Split(strings.TrimPrefix(folderPath, current+"/"), "/") {
+		if name == "" {
+			continue
+		}
+		current = path.Join(current, name)
+		existing, err := finder.Folder(ctx, current)
+		if err == nil {
+			folder = existing
+			continue
+		}
+		if _, ok := err.(*find.NotFoundError); !ok {
+			return nil, fmt.Errorf("unable to find folder %s, %v", current, err)
+		}
+
+		log.Debugf("Creating folder %s", current)
+		folder, err = folder.CreateFolder(ctx, name)
+		if err != nil {
+			return nil, fmt.Errorf("unable to create folder %s, %v", current, err)
+		}
+		folder.InventoryPath = current
+		if err = r.TagOwned(ctx, folder); err != nil {
+			return nil, err
+		}
+	}
+
+	return folder, nil
+}
+
+// EnsureResourcePool returns the resource pool at the inventory path, creating it and any missing parent
+// pools when needed. Pools are created with the given allocation, existing pools are left as they are.
+func (r *Resource) EnsureResourcePool(ctx context.Context, poolPath string, allocation *ResourceAllocation) (*object.ResourcePool, error) {
+	client, err := r.SessionManager.GetClientContext(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("unable to get vSphere client, %v", err)
+	}
+	finder := find.NewFinder(client.Client, true)
+	finder.SetDatacenter(r.Datacenter)
+
+	return r.ensureResourcePool(ctx, finder, path.Clean(poolPath), allocation)
+}
+
+func (r *Resource) ensureResourcePool(ctx context.Context, finder *find.Finder, poolPath string, allocation *ResourceAllocation) (*object.ResourcePool, error) {
+	pool, err := finder.ResourcePool(ctx, poolPath)
+	if err == nil {
+		return pool, nil
+	}
+	if _, ok := err.(*find.NotFoundError); !ok {
+		return nil, fmt.Errorf("unable to find resource pool %s, %v", poolPath, err)
+	}
+
+	parentPath, name := path.Split(poolPath)
+	parentPath = path.Clean(parentPath)
+	if name == "" || parentPath == "." || parentPath == "/" {
+		return nil, fmt.Errorf("resource pool %s not found, %v", poolPath, err)
+	}
+	// parents are created without an allocation of their own
+	parent, err := r.ensureResourcePool(ctx, finder, parentPath, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	log.Debugf("Creating resource pool %s", poolPath)
+	pool, err = parent.Create(ctx, name, resourceConfigSpec(allocation))
+	if err != nil {
+		return nil, fmt.Errorf("unable to create resource pool %s, %v", poolPath, err)
+	}
+	pool.InventoryPath = path.Join(parent.InventoryPath, name)
+	if err = r.TagOwned(ctx, pool); err != nil {
+		return nil, err
+	}
+
+	return pool, nil
+}
+
+// resourceConfigSpec converts an allocation into a resource pool config spec
+func resourceConfigSpec(allocation *ResourceAllocation) types.ResourceConfigSpec {
+	spec := types.DefaultResourceConfigSpec()
+	if allocation == nil {
+		return spec
+	}
+
+	spec.CpuAllocation.Reservation = types.NewInt64(allocation.CPUReservationMHz)
+	if allocation.CPULimitMHz > 0 {
+		spec.CpuAllocation.Limit = types.NewInt64(allocation.CPULimitMHz)
+	}
+	spec.MemoryAllocation.Reservation = types.NewInt64(allocation.MemoryReservationMiB)
+	if allocation.MemoryLimitMiB > 0 {
+		spec.MemoryAllocation.Limit = types.NewInt64(allocation.MemoryLimitMiB)
+	}
+	return spec
+}
+
+// deleteIfEmpty destroys a folder or resource pool when nothing is left in it,
+// other object types are ignored
+func deleteIfEmpty(ctx context.Context, client *vim25.Client, ref types.ManagedObjectReference) error {
+	var task *object.Task
+	var err error
+
+	switch ref.Type {
+	case "Folder":
+		var props mo.Folder
+		folder := object.NewFolder(client, ref)
+		if err = folder.Properties(ctx, ref, []string{"name", "childEntity"}, &props); err != nil {
+			return fmt.Errorf("unable to get folder properties, %v", err)
+		}
+		if len(props.ChildEntity) > 0 {
+			log.Debugf("Folder %s is not empty, will not delete", props.Name)
+			return nil
+		}
+		log.Debugf("Deleting folder %s", props.Name)
+		task, err = folder.Destroy(ctx)
+	case "ResourcePool":
+		var props mo.ResourcePool
+		pool := object.NewResourcePool(client, ref)
+		if err = pool.Properties(ctx, ref, []string{"name", "vm", "resourcePool"}, &props); err != nil {
+			return fmt.Errorf("unable to get resource pool properties, %v", err)
+		}
+		if len(props.Vm) > 0 || len(props.ResourcePool) > 0 {
+			log.Debugf("Resource pool %s is not empty, will not delete", props.Name)
+			return nil
+		}
+		log.Debugf("Deleting resource pool %s", props.Name)
+		task, err = pool.Destroy(ctx)
+	default:
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("unable to delete %s, %v", ref, err)
+	}
+
+	if err = task.Wait(ctx); err != nil {
+		return fmt.Errorf("delete task for %s failed, %v", ref, err)
+	}
+	return nil
+}
@@ -0,0 +1,82 @@
+package vsphere
+
+import (
+	"context"
+	"testing"
+
+	"github.com/vmware/govmomi/vim25/mo"
+)
+
+func TestEnsureInventory(t *testing.T) {
+	sm, cleanup := newSimulatorManager(t)
+	defer cleanup()
+	r := newSimulatorResource(t, sm)
+	r.ClusterID = "test-cluster"
+
+	ctx := context.Background()
+	existingPools, err := sm.GetResourcePools(r.Datacenter)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	folder, err := r.EnsureFolder(ctx, "nks/workloads")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if folder.InventoryPath != "/DC0/vm/nks/workloads" {
+		t.Errorf("got folder %s, want /DC0/vm/nks/workloads", folder.InventoryPath)
+	}
+	again, err := r.EnsureFolder(ctx, "/DC0/vm/nks/workloads")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if again.Reference() != folder.Reference() {
+		t.Errorf("expected the existing folder to be reused")
+	}
+
+	allocation := &ResourceAllocation{CPUReservationMHz: 1000, MemoryReservationMiB: 2048, MemoryLimitMiB: 4096}
+	pool, err := r.EnsureResourcePool(ctx, "DC0_C0/Resources/nks/workloads", allocation)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var props mo.ResourcePool
+	if err = pool.Properties(ctx, pool.Reference(), []string{"config"}, &props); err != nil {
+		t.Fatal(err)
+	}
+	memory := props.Config.MemoryAllocation
+	if *memory.Reservation != 2048 || *memory.Limit != 4096 {
+		t.Errorf("got memory reservation %d and limit %d, want 2048 and 4096", *memory.Reservation, *memory.Limit)
+	}
+	if *props.Config.CpuAllocation.Limit != -1 {
+		t.Errorf("got cpu limit %d, want unlimited", *props.Config.CpuAllocation.Limit)
+	}
+
+	owned, err := r.ListOwned(ctx, r.ClusterID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(owned) != 4 {
+		t.Errorf("got %d owned objects, want the 2 folders and 2 resource pools", len(owned))
+	}
+
+	// the pre-existing root pool and VM folder are not owned and must survive
+	if err = r.DeleteOwned(ctx, r.ClusterID); err != nil {
+		t.Fatal(err)
+	}
+	folders, err := sm.GetFolders()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, f := range folders {
+		if f.Name() == "nks" {
+			t.Errorf("expected owned folder %s to be deleted", f.InventoryPath)
+		}
+	}
+	pools, err := sm.GetResourcePools(r.Datacenter)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(pools) != len(existingPools) {
+		t.Errorf("got %d resource pools, want the %d that existed before", len(pools), len(existingPools))
+	}
+}
@@ -28,7 +28,7 @@ import (
 func (r *Resource) DeployOVATemplate(templateName, templatePath string) (*object.VirtualMachine, error) {
 	ctx := context.TODO()
 
-	vSphereClient, err := r.SessionManager.GetClient()
+	vSphereClient, err := r.SessionManager.GetClientContext(ctx)
 	if err != nil {
 		return nil, fmt.Errorf("unable to get vSphere client, %v", err)
 	}
@@ -78,11 +78,15 @@ func (r *Resource) DeployOVATemplate(templateName, templatePath string) (*object
 		return nil, fmt.Errorf("unable to mark virtual machine as a template, %v", err)
 	}
 
+	if err := r.TagOwned(ctx, vm); err != nil {
+		return nil, fmt.Errorf("unable to tag template, %v", err)
+	}
+
 	return vm, nil
 }
 
 func createVirtualMachine(ctx context.Context, cisp types.OvfCreateImportSpecParams, ovaPath string, vSphere *Resource) (*object.VirtualMachine, error) {
-	vSphereClient, err := vSphere.SessionManager.GetClient()
+	vSphereClient, err := vSphere.SessionManager.GetClientContext(ctx)
 	if err != nil {
 		return nil, fmt.Errorf("unable to get vSphere client, %v", err)
 	}
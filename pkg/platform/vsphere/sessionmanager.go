@@ -5,34 +5,66 @@ import (
 	"fmt"
 	"net/url"
 	"strings"
+	"sync"
+	"time"
 
 	"github.com/vmware/govmomi/find"
 	"github.com/vmware/govmomi/object"
+	"github.com/vmware/govmomi/session"
+	"github.com/vmware/govmomi/vapi/rest"
+	"github.com/vmware/govmomi/vim25"
+	"github.com/vmware/govmomi/vim25/methods"
+	"github.com/vmware/govmomi/vim25/soap"
 
 	log "github.com/sirupsen/logrus"
 	"github.com/vmware/govmomi"
 )
 
+const (
+	// keepAliveInterval is how long a session can sit idle before a keepalive request is sent,
+	// vCenter expires idle sessions after 30 minutes by default
+	keepAliveInterval = 5 * time.Minute
+	// logoutTimeout bounds how long Close waits on vCenter to end the session
+	logoutTimeout = 30 * time.Second
+)
+
 // SessionManager manages vSphere client sessions
 type SessionManager interface {
 	GetClient() (*govmomi.Client, error)
+	GetClientContext(ctx context.Context) (*govmomi.Client, error)
 	GetDatacenters() ([]*object.Datacenter, error)
+	GetDatacentersContext(ctx context.Context) ([]*object.Datacenter, error)
 	GetNetworks(*object.Datacenter) ([]object.NetworkReference, error)
+	GetNetworksContext(ctx context.Context, dc *object.Datacenter) ([]object.NetworkReference, error)
 	GetFolders() ([]*object.Folder, error)
+	GetFoldersContext(ctx context.Context) ([]*object.Folder, error)
 	GetDatastores(*object.Datacenter) ([]*object.Datastore, error)
+	GetDatastoresContext(ctx context.Context, dc *object.Datacenter) ([]*object.Datastore, error)
 	GetResourcePools(*object.Datacenter) ([]*object.ResourcePool, error)
+	GetResourcePoolsContext(ctx context.Context, dc *object.Datacenter) ([]*object.ResourcePool, error)
 	GetVM(dc *object.Datacenter, name string) (*object.VirtualMachine, error)
+	GetVMContext(ctx context.Context, dc *object.Datacenter, name string) (*object.VirtualMachine, error)
+	GetRestClient() (*rest.Client, error)
+	GetRestClientContext(ctx context.Context) (*rest.Client, error)
+	Close() error
 }
 
 type sessionManager struct {
-	client   *govmomi.Client
-	server   string
-	username string
-	password string
+	sync.Mutex
+	client     *govmomi.Client
+	restClient *rest.Client
+	server     string
+	username   string
+	password   string
 }
 
-// NewManager returns a new SessionManager
+// NewManager returns a new SessionManager, the server is a vCenter URL or address, https is assumed without a scheme
 func NewManager(server string, username string, password string) (SessionManager, error) {
+	return NewManagerContext(context.TODO(), server, username, password)
+}
+
+// NewManagerContext returns a new SessionManager, verifying the connection with the given context
+func NewManagerContext(ctx context.Context, server string, username string, password string) (SessionManager, error) {
 
 	sm := sessionManager{
 		server:   server,
@@ -41,7 +73,7 @@ func NewManager(server string, username string, password string) (SessionManager
 	}
 
 	// Verify connection
-	_, err := sm.GetClient()
+	_, err := sm.GetClientContext(ctx)
 	if err != nil {
 		return nil, fmt.Errorf("unable to verify connection, %v", err)
 	}
@@ -51,20 +83,44 @@ func NewManager(server string, username string, password string) (SessionManager
 
 // GetClient returns a govmomi client with an active session
 func (m *sessionManager) GetClient() (*govmomi.Client, error) {
+	return m.GetClientContext(context.TODO())
+}
+
+// GetClientContext returns a govmomi client with an active session.
+// The client is created once and kept alive in the background, an expired
+// session is logged back in on the same client instead of creating a new one.
+func (m *sessionManager) GetClientContext(ctx context.Context) (*govmomi.Client, error) {
+	m.Lock()
+	defer m.Unlock()
 
-	ctx := context.TODO()
+	return m.getClient(ctx)
+}
 
+// getClient returns a govmomi client with an active session, the caller must hold the lock
+func (m *sessionManager) getClient(ctx context.Context) (*govmomi.Client, error) {
 	if m.client != nil {
-		sessionActive, err := m.client.SessionManager.SessionIsActive(ctx)
-		if err == nil && sessionActive {
+		// UserSession only needs a valid session, unlike SessionIsActive which
+		// requires the Sessions.ValidateSession privilege and fails for most users
+		userSession, err := m.client.SessionManager.UserSession(ctx)
+		if err == nil && userSession != nil {
 			log.Debug("Using existing govmomi session")
 			return m.client, nil
 		}
+
+		log.Debug("govmomi session expired, logging in again")
+		if err = m.client.Login(ctx, m.userInfo()); err != nil {
+			return nil, fmt.Errorf("unable to login to vSphere, %v", err)
+		}
+		return m.client, nil
 	}
 
 	log.Debug("Creating new govmomi client")
 
-	nonAuthURL, err := url.Parse(m.server)
+	server := m.server
+	if !strings.Contains(server, "://") {
+		server = "https://" + server
+	}
+	nonAuthURL, err := url.Parse(server)
 	if err != nil {
 		return nil, fmt.Errorf("unable to parse vCenter url, %v", err)
 	}
@@ -73,19 +129,19 @@ func (m *sessionManager) GetClient() (*govmomi.Client, error) {
 		nonAuthURL.Path = nonAuthURL.Path + "sdk"
 	}
 
-	authenticatedURL, err := url.Parse(nonAuthURL.String())
+	soapClient := soap.NewClient(nonAuthURL, true)
+	vimClient, err := vim25.NewClient(ctx, soapClient)
 	if err != nil {
-		return nil, fmt.Errorf("unable to parse vCenter url, %v", err)
+		return nil, fmt.Errorf("unable to create new vSphere client, %v", err)
 	}
+	vimClient.RoundTripper = session.KeepAliveHandler(vimClient.RoundTripper, keepAliveInterval, keepAlive)
 
-	authenticatedURL.User = url.UserPassword(m.username, m.password)
-
-	client, err := govmomi.NewClient(ctx, nonAuthURL, true)
-	if err != nil {
-		return nil, fmt.Errorf("unable to create new vSphere client, %v", err)
+	client := &govmomi.Client{
+		Client:         vimClient,
+		SessionManager: session.NewManager(vimClient),
 	}
 
-	if err = client.Login(ctx, authenticatedURL.User); err != nil {
+	if err = client.Login(ctx, m.userInfo()); err != nil {
 		return nil, fmt.Errorf("unable to login to vSphere, %v", err)
 	}
 
@@ -95,15 +151,96 @@ func (m *sessionManager) GetClient() (*govmomi.Client, error) {
 
 }
 
+// GetRestClient returns a vAPI REST client with an active session
+func (m *sessionManager) GetRestClient() (*rest.Client, error) {
+	return m.GetRestClientContext(context.TODO())
+}
+
+// GetRestClientContext returns a vAPI REST client with an active session,
+// the REST API is needed for tagging
+func (m *sessionManager) GetRestClientContext(ctx context.Context) (*rest.Client, error) {
+	m.Lock()
+	defer m.Unlock()
+
+	client, err := m.getClient(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	if m.restClient != nil {
+		restSession, err := m.restClient.Session(ctx)
+		if err == nil && restSession != nil {
+			log.Debug("Using existing vAPI session")
+			return m.restClient, nil
+		}
+	}
+
+	log.Debug("Creating new vAPI client")
+	restClient := rest.NewClient(client.Client)
+	if err = restClient.Login(ctx, m.userInfo()); err != nil {
+		return nil, fmt.Errorf("unable to login to vSphere REST API, %v", err)
+	}
+	m.restClient = restClient
+
+	return m.restClient, nil
+}
+
+// Close logs out of the vSphere sessions, if any
+func (m *sessionManager) Close() error {
+	m.Lock()
+	defer m.Unlock()
+
+	ctx, cancel := context.WithTimeout(context.Background(), logoutTimeout)
+	defer cancel()
+
+	if m.restClient != nil {
+		err := m.restClient.Logout(ctx)
+		m.restClient = nil
+		if err != nil {
+			log.Debugf("unable to logout of vSphere REST API, %v", err)
+		}
+	}
+
+	if m.client == nil {
+		return nil
+	}
+
+	err := m.client.Logout(ctx)
+	m.client = nil
+	if err != nil {
+		return fmt.Errorf("unable to logout of vSphere, %v", err)
+	}
+
+	return nil
+}
+
+func (m *sessionManager) userInfo() *url.Userinfo {
+	return url.UserPassword(m.username, m.password)
+}
+
+// keepAlive is run by the session keepalive handler when the client has been idle,
+// returning an error stops the keepalive until the next login
+func keepAlive(tripper soap.RoundTripper) error {
+	_, err := methods.GetCurrentTime(context.Background(), tripper)
+	if err != nil {
+		log.Warnf("vSphere session keepalive failed, %v", err)
+	}
+	return err
+}
+
 func (m *sessionManager) GetDatacenters() ([]*object.Datacenter, error) {
+	return m.GetDatacentersContext(context.TODO())
+}
+
+func (m *sessionManager) GetDatacentersContext(ctx context.Context) ([]*object.Datacenter, error) {
 	var err error
 
-	client, err := m.GetClient()
+	client, err := m.GetClientContext(ctx)
 	if err != nil {
 		return nil, err
 	}
 	finder := find.NewFinder(client.Client, true)
-	datacenters, err := finder.DatacenterList(context.TODO(), "*")
+	datacenters, err := finder.DatacenterList(ctx, "*")
 	if err != nil {
 		return nil, err
 	}
@@ -112,15 +249,19 @@ func (m *sessionManager) GetDatacenters() ([]*object.Datacenter, error) {
 }
 
 func (m *sessionManager) GetDatastores(dc *object.Datacenter) ([]*object.Datastore, error) {
+	return m.GetDatastoresContext(context.TODO(), dc)
+}
+
+func (m *sessionManager) GetDatastoresContext(ctx context.Context, dc *object.Datacenter) ([]*object.Datastore, error) {
 	var err error
 
-	client, err := m.GetClient()
+	client, err := m.GetClientContext(ctx)
 	if err != nil {
 		return nil, err
 	}
 	finder := find.NewFinder(client.Client, true)
 	finder.SetDatacenter(dc)
-	datastores, err := finder.DatastoreList(context.TODO(), "*")
+	datastores, err := finder.DatastoreList(ctx, "*")
 	if err != nil {
 		return nil, err
 	}
@@ -129,15 +270,19 @@ func (m *sessionManager) GetDatastores(dc *object.Datacenter) ([]*object.Datasto
 }
 
 func (m *sessionManager) GetNetworks(dc *object.Datacenter) ([]object.NetworkReference, error) {
+	return m.GetNetworksContext(context.TODO(), dc)
+}
+
+func (m *sessionManager) GetNetworksContext(ctx context.Context, dc *object.Datacenter) ([]object.NetworkReference, error) {
 	var err error
 
-	client, err := m.GetClient()
+	client, err := m.GetClientContext(ctx)
 	if err != nil {
 		return nil, err
 	}
 	finder := find.NewFinder(client.Client, true)
 	finder.SetDatacenter(dc)
-	networks, err := finder.NetworkList(context.TODO(), "*")
+	networks, err := finder.NetworkList(ctx, "*")
 	if err != nil {
 		return nil, err
 	}
@@ -146,14 +291,18 @@ func (m *sessionManager) GetNetworks(dc *object.Datacenter) ([]object.NetworkRef
 }
 
 func (m *sessionManager) GetFolders() ([]*object.Folder, error) {
+	return m.GetFoldersContext(context.TODO())
+}
+
+func (m *sessionManager) GetFoldersContext(ctx context.Context) ([]*object.Folder, error) {
 	var err error
 
-	client, err := m.GetClient()
+	client, err := m.GetClientContext(ctx)
 	if err != nil {
 		return nil, err
 	}
 	finder := find.NewFinder(client.Client, true)
-	folders, err := finder.FolderList(context.TODO(), "*")
+	folders, err := finder.FolderList(ctx, "*")
 	if err != nil {
 		return nil, err
 	}
@@ -162,15 +311,19 @@ func (m *sessionManager) GetFolders() ([]*object.Folder, error) {
 }
 
 func (m *sessionManager) GetResourcePools(dc *object.Datacenter) ([]*object.ResourcePool, error) {
+	return m.GetResourcePoolsContext(context.TODO(), dc)
+}
+
+func (m *sessionManager) GetResourcePoolsContext(ctx context.Context, dc *object.Datacenter) ([]*object.ResourcePool, error) {
 	var err error
 
-	client, err := m.GetClient()
+	client, err := m.GetClientContext(ctx)
 	if err != nil {
 		return nil, err
 	}
 	finder := find.NewFinder(client.Client, true)
 	finder.SetDatacenter(dc)
-	folders, err := finder.ResourcePoolList(context.TODO(), "*")
+	folders, err := finder.ResourcePoolList(ctx, "*")
 	if err != nil {
 		return nil, err
 	}
@@ -179,13 +332,17 @@ func (m *sessionManager) GetResourcePools(dc *object.Datacenter) ([]*object.Reso
 }
 
 func (m *sessionManager) GetVM(dc *object.Datacenter, name string) (*object.VirtualMachine, error) {
-	client, err := m.GetClient()
+	return m.GetVMContext(context.TODO(), dc, name)
+}
+
+func (m *sessionManager) GetVMContext(ctx context.Context, dc *object.Datacenter, name string) (*object.VirtualMachine, error) {
+	client, err := m.GetClientContext(ctx)
 	if err != nil {
 		return nil, err
 	}
 	finder := find.NewFinder(client.Client, true)
 	finder.SetDatacenter(dc)
-	vm, err := finder.VirtualMachine(context.TODO(), name)
+	vm, err := finder.VirtualMachine(ctx, name)
 	if err != nil {
 		return nil, err
 	}
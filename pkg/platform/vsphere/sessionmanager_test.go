@@ -0,0 +1,108 @@
+package vsphere
+
+import (
+	"context"
+	"testing"
+
+	"github.com/vmware/govmomi/simulator"
+	_ "github.com/vmware/govmomi/vapi/simulator"
+)
+
+func newSimulatorManager(t *testing.T) (*sessionManager, func()) {
+	model := simulator.VPX()
+	if err := model.Create(); err != nil {
+		t.Fatal(err)
+	}
+	model.Service.RegisterEndpoints = true
+	s := model.Service.NewServer()
+	password, _ := s.URL.User.Password()
+
+	sm, err := NewManager(s.URL.Scheme+"://"+s.URL.Host+"/", s.URL.User.Username(), password)
+	if err != nil {
+		s.Close()
+		model.Remove()
+		t.Fatal(err)
+	}
+
+	return sm.(*sessionManager), func() {
+		s.Close()
+		model.Remove()
+	}
+}
+
+func TestSessionReused(t *testing.T) {
+	sm, cleanup := newSimulatorManager(t)
+	defer cleanup()
+
+	first, err := sm.GetClient()
+	if err != nil {
+		t.Fatal(err)
+	}
+	second, err := sm.GetClientContext(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if first != second {
+		t.Errorf("expected the existing client to be reused")
+	}
+}
+
+func TestSessionRelogin(t *testing.T) {
+	sm, cleanup := newSimulatorManager(t)
+	defer cleanup()
+
+	ctx := context.Background()
+	client, err := sm.GetClientContext(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// end the session behind the manager's back
+	if err = client.SessionManager.Logout(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	relogged, err := sm.GetClientContext(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if relogged != client {
+		t.Errorf("expected expired session to be logged in on the same client")
+	}
+	userSession, err := relogged.SessionManager.UserSession(ctx)
+	if err != nil || userSession == nil {
+		t.Errorf("expected an active session, err: %v", err)
+	}
+}
+
+func TestSessionClose(t *testing.T) {
+	sm, cleanup := newSimulatorManager(t)
+	defer cleanup()
+
+	ctx := context.Background()
+	client, err := sm.GetClientContext(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = sm.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if sm.client != nil {
+		t.Errorf("expected client to be cleared after Close")
+	}
+	userSession, err := client.SessionManager.UserSession(ctx)
+	if err == nil && userSession != nil {
+		t.Errorf("expected session to be logged out after Close")
+	}
+	// closing twice is a no-op
+	if err = sm.Close(); err != nil {
+		t.Errorf("expected second Close to succeed, got %v", err)
+	}
+
+	datacenters, err := sm.GetDatacentersContext(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(datacenters) == 0 {
+		t.Errorf("expected datacenters after logging in again")
+	}
+}
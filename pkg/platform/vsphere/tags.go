@@ -0,0 +1,301 @@
+package vsphere
+
+import (
+	"context"
+	"fmt"
+	"path"
+	"sort"
+	"strings"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+	"github.com/vmware/govmomi/find"
+	"github.com/vmware/govmomi/object"
+	"github.com/vmware/govmomi/vapi/tags"
+	"github.com/vmware/govmomi/vim25/mo"
+	"github.com/vmware/govmomi/vim25/types"
+)
+
+const (
+	// ownerCategoryPrefix prefixes the tag category created for each cluster ID
+	ownerCategoryPrefix = "cake-"
+	// deploymentTimeFormat is the layout of the deployment timestamp in tag names
+	deploymentTimeFormat = "20060102T150405Z"
+)
+
+// OwnedObject is a vSphere object tagged as created by a cake deployment
+type OwnedObject struct {
+	Reference  types.ManagedObjectReference
+	Name       string
+	ClusterID  string
+	DeployedAt time.Time
+}
+
+// ownerCategoryName returns the tag category name for a cluster ID
+func ownerCategoryName(clusterID string) string {
+	return ownerCategoryPrefix + clusterID
+}
+
+// ownerTagName returns the tag name for a deployment of a cluster ID
+func ownerTagName(clusterID string, deployedAt time.Time) string {
+	return clusterID + "-" + deployedAt.UTC().Format(deploymentTimeFormat)
+}
+
+// TagOwned tags the objects as owned by the resource's cluster ID and deployment time,
+// it is a no-op when the resource has no cluster ID
+func (r *Resource) TagOwned(ctx context.Context, refs ...mo.Reference) error {
+	if r.ClusterID == "" || len(refs) == 0 {
+		return nil
+	}
+	if r.DeployedAt.IsZero() {
+		r.DeployedAt = time.Now()
+	}
+
+	restClient, err := r.SessionManager.GetRestClientContext(ctx)
+	if err != nil {
+		return fmt.Errorf("unable to get vSphere REST client, %v", err)
+	}
+	m := tags.NewManager(restClient)
+
+	categoryID, err := ensureCategory(ctx, m, ownerCategoryName(r.ClusterID))
+	if err != nil {
+		return err
+	}
+	tagID, err := ensureTag(ctx, m, categoryID, ownerTagName(r.ClusterID, r.DeployedAt))
+	if err != nil {
+		return err
+	}
+
+	for _, ref := range refs {
+		log.Debugf("Tagging %s as owned by %s", ref.Reference(), r.ClusterID)
+		if err = m.AttachTag(ctx, tagID, ref); err != nil {
+			return fmt.Errorf("unable to tag %s, %v", ref.Reference(), err)
+		}
+	}
+
+	return nil
+}
+
+func ensureCategory(ctx context.Context, m *tags.Manager, name string) (string, error) {
+	category, err := getCategory(ctx, m, name)
+	if err != nil {
+		return "", err
+	}
+	if category != nil {
+		return category.ID, nil
+	}
+
+	id, err := m.CreateCategory(ctx, &tags.Category{
+		Name:        name,
+		Description: "objects created by cake",
+		Cardinality: "MULTIPLE",
+	})
+	if err != nil {
+		return "", fmt.Errorf("unable to create tag category %s, %v", name, err)
+	}
+	return id, nil
+}
+
+func ensureTag(ctx context.Context, m *tags.Manager, categoryID, name string) (string, error) {
+	existing, err := m.GetTagsForCategory(ctx, categoryID)
+	if err != nil {
+		return "", fmt.Errorf("unable to list tags, %v", err)
+	}
+	for _, t := range existing {
+		if t.Name == name {
+			return t.ID, nil
+		}
+	}
+
+	id, err := m.CreateTag(ctx, &tags.Tag{
+		Name:       name,
+		CategoryID: categoryID,
+	})
+	if err != nil {
+		return "", fmt.Errorf("unable to create tag %s, %v", name, err)
+	}
+	return id, nil
+}
+
+// getCategory returns the category with the given name or nil if it does not exist
+func getCategory(ctx context.Context, m *tags.Manager, name string) (*tags.Category, error) {
+	categories, err := m.GetCategories(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("unable to list tag categories, %v", err)
+	}
+	for i := range categories {
+		if categories[i].Name == name {
+			return &categories[i], nil
+		}
+	}
+	return nil, nil
+}
+
+// ListOwners returns the cluster IDs that own objects in vSphere
+func (r *Resource) ListOwners(ctx context.Context) ([]string, error) {
+	restClient, err := r.SessionManager.GetRestClientContext(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("unable to get vSphere REST client, %v", err)
+	}
+
+	categories, err := tags.NewManager(restClient).GetCategories(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("unable to list tag categories, %v", err)
+	}
+
+	var owners []string
+	for _, c := range categories {
+		if strings.HasPrefix(c.Name, ownerCategoryPrefix) {
+			owners = append(owners, strings.TrimPrefix(c.Name, ownerCategoryPrefix))
+		}
+	}
+	return owners, nil
+}
+
+// ListOwned returns every object tagged as owned by the cluster ID
+func (r *Resource) ListOwned(ctx context.Context, clusterID string) ([]OwnedObject, error) {
+	restClient, err := r.SessionManager.GetRestClientContext(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("unable to get vSphere REST client, %v", err)
+	}
+	client, err := r.SessionManager.GetClientContext(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("unable to get vSphere client, %v", err)
+	}
+	m := tags.NewManager(restClient)
+	finder := find.NewFinder(client.Client, true)
+
+	category, err := getCategory(ctx, m, ownerCategoryName(clusterID))
+	if err != nil || category == nil {
+		return nil, err
+	}
+	tagList, err := m.GetTagsForCategory(ctx, category.ID)
+	if err != nil {
+		return nil, fmt.Errorf("unable to list tags, %v", err)
+	}
+
+	var owned []OwnedObject
+	for _, t := range tagList {
+		deployedAt, _ := time.Parse(deploymentTimeFormat, strings.TrimPrefix(t.Name, clusterID+"-"))
+		refs, err := m.ListAttachedObjects(ctx, t.ID)
+		if err != nil {
+			return nil, fmt.Errorf("unable to list objects tagged %s, %v", t.Name, err)
+		}
+		for _, ref := range refs {
+			o := OwnedObject{
+				Reference:  ref.Reference(),
+				ClusterID:  clusterID,
+				DeployedAt: deployedAt,
+			}
+			if e, err := finder.Element(ctx, ref.Reference()); err == nil {
+				o.Name = path.Base(e.Path)
+			}
+			owned = append(owned, o)
+		}
+	}
+	return owned, nil
+}
+
+// DeleteOwned deletes the virtual machines and templates owned by the cluster ID, then any owned
+// folders and resource pools that are left empty, and finally the ownership tags themselves
+func (r *Resource) DeleteOwned(ctx context.Context, clusterID string) error {
+	owned, err := r.ListOwned(ctx, clusterID)
+	if err != nil {
+		return err
+	}
+	client, err := r.SessionManager.GetClientContext(ctx)
+	if err != nil {
+		return fmt.Errorf("unable to get vSphere client, %v", err)
+	}
+	finder := find.NewFinder(client.Client, true)
+
+	// virtual machines first so the folders and resource pools holding them can be emptied
+	var containers []OwnedObject
+	for _, o := range owned {
+		if o.Reference.Type != "VirtualMachine" {
+			containers = append(containers, o)
+			continue
+		}
+		ref, err := finder.ObjectReference(ctx, o.Reference)
+		if err != nil {
+			if _, ok := err.(*find.NotFoundError); ok {
+				continue
+			}
+			return fmt.Errorf("unable to find %s, %v", o.Reference, err)
+		}
+		log.Debugf("Deleting %s owned by %s", o.Name, clusterID)
+		if err = DeleteVM(ref.(*object.VirtualMachine)); err != nil {
+			return err
+		}
+	}
+
+	// deepest inventory paths first so child folders and pools go before their parents
+	depth := map[types.ManagedObjectReference]int{}
+	for _, o := range containers {
+		if e, err := finder.Element(ctx, o.Reference); err == nil {
+			depth[o.Reference] = strings.Count(e.Path, "/")
+		}
+	}
+	sort.SliceStable(containers, func(i, j int) bool {
+		return depth[containers[i].Reference] > depth[containers[j].Reference]
+	})
+	for _, o := range containers {
+		if err = deleteIfEmpty(ctx, client.Client, o.Reference); err != nil {
+			return err
+		}
+	}
+
+	return r.deleteOwnerTags(ctx, clusterID)
+}
+
+func (r *Resource) deleteOwnerTags(ctx context.Context, clusterID string) error {
+	restClient, err := r.SessionManager.GetRestClientContext(ctx)
+	if err != nil {
+		return fmt.Errorf("unable to get vSphere REST client, %v", err)
+	}
+	client, err := r.SessionManager.GetClientContext(ctx)
+	if err != nil {
+		return fmt.Errorf("unable to get vSphere client, %v", err)
+	}
+	m := tags.NewManager(restClient)
+	finder := find.NewFinder(client.Client, true)
+
+	category, err := getCategory(ctx, m, ownerCategoryName(clusterID))
+	if err != nil || category == nil {
+		return err
+	}
+	tagList, err := m.GetTagsForCategory(ctx, category.ID)
+	if err != nil {
+		return fmt.Errorf("unable to list tags, %v", err)
+	}
+	inUse := false
+	for i := range tagList {
+		refs, err := m.ListAttachedObjects(ctx, tagList[i].ID)
+		if err != nil {
+			return fmt.Errorf("unable to list objects tagged %s, %v", tagList[i].Name, err)
+		}
+		tagged := false
+		for _, ref := range refs {
+			if _, err := finder.Element(ctx, ref.Reference()); err == nil {
+				log.Debugf("Keeping tag %s, %s is still tagged", tagList[i].Name, ref.Reference())
+				tagged = true
+				break
+			}
+		}
+		if tagged {
+			inUse = true
+			continue
+		}
+		if err = m.DeleteTag(ctx, &tagList[i]); err != nil {
+			return fmt.Errorf("unable to delete tag %s, %v", tagList[i].Name, err)
+		}
+	}
+	if inUse {
+		return nil
+	}
+
+	if err = m.DeleteCategory(ctx, category); err != nil {
+		return fmt.Errorf("unable to delete tag category %s, %v", category.Name, err)
+	}
+	return nil
+}
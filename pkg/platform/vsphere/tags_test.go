@@ -0,0 +1,103 @@
+package vsphere
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/vmware/govmomi/vapi/tags"
+)
+
+func TestOwnership(t *testing.T) {
+	sm, cleanup := newSimulatorManager(t)
+	defer cleanup()
+	r := newSimulatorResource(t, sm)
+	r.ClusterID = "test-cluster"
+	r.DeployedAt = time.Date(2020, 4, 20, 10, 30, 0, 0, time.UTC)
+
+	template, err := sm.GetVM(r.Datacenter, "DC0_H0_VM0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = r.CloneTemplate(template, "owned", "", "", "capv", nil, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	ctx := context.Background()
+	owners, err := r.ListOwners(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(owners) != 1 || owners[0] != r.ClusterID {
+		t.Errorf("got owners %v, want [%s]", owners, r.ClusterID)
+	}
+
+	owned, err := r.ListOwned(ctx, r.ClusterID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(owned) != 1 || owned[0].Name != "owned" || !owned[0].DeployedAt.Equal(r.DeployedAt) {
+		t.Fatalf("got owned objects %+v, want the cloned VM deployed at %v", owned, r.DeployedAt)
+	}
+
+	if err = r.DeleteOwned(ctx, r.ClusterID); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = sm.GetVM(r.Datacenter, "owned"); err == nil {
+		t.Errorf("expected owned VM to be deleted")
+	}
+	owners, err = r.ListOwners(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(owners) != 0 {
+		t.Errorf("expected tag category to be deleted, got owners %v", owners)
+	}
+}
+
+func TestDeleteOwnerTagsKeepsTagsInUse(t *testing.T) {
+	sm, cleanup := newSimulatorManager(t)
+	defer cleanup()
+	r := newSimulatorResource(t, sm)
+	r.ClusterID = "test-cluster"
+	ctx := context.Background()
+
+	restClient, err := sm.GetRestClientContext(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	m := tags.NewManager(restClient)
+	categoryID, err := ensureCategory(ctx, m, ownerCategoryName(r.ClusterID))
+	if err != nil {
+		t.Fatal(err)
+	}
+	deployments := []time.Time{
+		time.Date(2020, 4, 20, 10, 30, 0, 0, time.UTC),
+		time.Date(2020, 4, 21, 10, 30, 0, 0, time.UTC),
+		time.Date(2020, 4, 22, 10, 30, 0, 0, time.UTC),
+	}
+	for _, deployedAt := range deployments {
+		if _, err = ensureTag(ctx, m, categoryID, ownerTagName(r.ClusterID, deployedAt)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	vm, err := sm.GetVM(r.Datacenter, "DC0_H0_VM1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	r.DeployedAt = deployments[1]
+	if err = r.TagOwned(ctx, vm); err != nil {
+		t.Fatal(err)
+	}
+
+	if err = r.deleteOwnerTags(ctx, r.ClusterID); err != nil {
+		t.Fatal(err)
+	}
+	remaining, err := m.GetTagsForCategory(ctx, categoryID)
+	if err != nil {
+		t.Fatalf("got %v, want the category kept for the tag in use", err)
+	}
+	if len(remaining) != 1 || remaining[0].Name != ownerTagName(r.ClusterID, deployments[1]) {
+		t.Errorf("got tags %+v, want only the one in use", remaining)
+	}
+}
@@ -97,3 +97,46 @@ func hasCreationTask(taskInfos []vim25types.TaskInfo) bool {
 	}
 	return false
 }
+
+// OwnedVMTasks returns the recent tasks of the virtual machines owned by the cluster ID, and of the named
+// virtual machines that exist, keyed by virtual machine name
+func (r *Resource) OwnedVMTasks(ctx context.Context, clusterID string, vmNames ...string) (map[string][]vim25types.TaskInfo, error) {
+	owned, err := r.ListOwned(ctx, clusterID)
+	if err != nil {
+		return nil, err
+	}
+	client, err := r.SessionManager.GetClientContext(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("unable to get vSphere client, %v", err)
+	}
+
+	tasks := map[string][]vim25types.TaskInfo{}
+	for _, o := range owned {
+		if o.Reference.Type != "VirtualMachine" {
+			continue
+		}
+		vmTasks, err := getTasksForVM(object.NewVirtualMachine(client.Client, o.Reference))
+		if err != nil {
+			return nil, errors.Wrapf(err, "could not get tasks for VM %s", o.Name)
+		}
+		tasks[o.Name] = vmTasks
+	}
+	for _, name := range vmNames {
+		if _, ok := tasks[name]; ok {
+			continue
+		}
+		vm, err := r.SessionManager.GetVMContext(ctx, r.Datacenter, name)
+		if _, ok := err.(*find.NotFoundError); ok {
+			continue
+		}
+		if err != nil {
+			return nil, fmt.Errorf("unable to find virtual machine %s, %v", name, err)
+		}
+		vmTasks, err := getTasksForVM(vm)
+		if err != nil {
+			return nil, errors.Wrapf(err, "could not get tasks for VM %s", name)
+		}
+		tasks[name] = vmTasks
+	}
+	return tasks, nil
+}
@@ -0,0 +1,37 @@
+package vsphere
+
+import (
+	"context"
+	"testing"
+)
+
+func TestOwnedVMTasks(t *testing.T) {
+	sm, cleanup := newSimulatorManager(t)
+	defer cleanup()
+	r := newSimulatorResource(t, sm)
+	r.ClusterID = "test-cluster"
+
+	template, err := sm.GetVM(r.Datacenter, "DC0_H0_VM0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = r.CloneTemplate(template, "owned", "", "", "capv", nil, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	tasks, err := r.OwnedVMTasks(context.Background(), r.ClusterID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := tasks["owned"]; !ok || len(tasks) != 1 {
+		t.Errorf("got tasks for %v, want the owned VM", tasks)
+	}
+
+	tasks, err = r.OwnedVMTasks(context.Background(), r.ClusterID, "owned", "DC0_H0_VM1", "missing")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := tasks["DC0_H0_VM1"]; !ok || len(tasks) != 2 {
+		t.Errorf("got tasks for %v, want the owned and the named VM", tasks)
+	}
+}
@@ -1,6 +1,8 @@
 package vsphere
 
 import (
+	"time"
+
 	"github.com/vmware/govmomi/object"
 )
 
@@ -8,6 +10,10 @@ import (
 type Resource struct {
 	Infrastructure
 	SessionManager SessionManager
+	// ClusterID tags the objects the resource creates as owned by a cake deployment, none are tagged when empty
+	ClusterID string
+	// DeployedAt is the deployment timestamp recorded in the ownership tag, defaults to the time of the first tag
+	DeployedAt time.Time
 }
 
 // Infrastructure stores information about the underlying vSphere infrastructure
@@ -18,3 +24,24 @@ type Infrastructure struct {
 	ResourcePool *object.ResourcePool
 	Network      object.NetworkReference
 }
+
+// NetworkAttachment describes a NIC to attach to a cloned virtual machine
+type NetworkAttachment struct {
+	Network object.NetworkReference
+	// DHCP4 ignores the static address settings below when true
+	DHCP4       bool
+	IPAddress   string
+	Netmask     string
+	Gateway     string
+	NameServers []string
+	DNSSearch   []string
+}
+
+// ResourceAllocation sets the CPU and memory reservations and limits of a resource pool,
+// a zero limit leaves the resource unlimited
+type ResourceAllocation struct {
+	CPUReservationMHz    int64 `yaml:"CPUReservationMHz" json:"cpureservationmhz"`
+	CPULimitMHz          int64 `yaml:"CPULimitMHz" json:"cpulimitmhz"`
+	MemoryReservationMiB int64 `yaml:"MemoryReservationMiB" json:"memoryreservationmib"`
+	MemoryLimitMiB       int64 `yaml:"MemoryLimitMiB" json:"memorylimitmib"`
+}
@@ -5,19 +5,35 @@ import (
 	"fmt"
 	"time"
 
+	caketypes "github.com/netapp/cake/pkg/config/types"
 	"github.com/netapp/cake/pkg/platform/vsphere/cloudinit"
 	log "github.com/sirupsen/logrus"
 	"github.com/vmware/govmomi/object"
 	"github.com/vmware/govmomi/vim25/types"
 )
 
-func (r *Resource) CloneTemplate(template *object.VirtualMachine, name string, bootScript, publicKey, osUser string) (*object.VirtualMachine, error) {
+// CloneTemplate clones the template into a new virtual machine with a NIC for each network attachment,
+// if no attachments are given a single DHCP NIC on the resource network is used.
+// A nil size keeps the hardware of the template.
+func (r *Resource) CloneTemplate(template *object.VirtualMachine, name string, bootScript, publicKey, osUser string, networks []NetworkAttachment, size *caketypes.MachineSize) (*object.VirtualMachine, error) {
 
 	// give whole clone process a 10 minute timeout
 	d := time.Now().Add(10 * time.Minute)
 	ctx, cancel := context.WithDeadline(context.Background(), d)
 	defer cancel()
 
+	if len(networks) == 0 {
+		networks = []NetworkAttachment{{Network: r.Network, DHCP4: true}}
+	}
+	for i, n := range networks {
+		if n.Network == nil {
+			return nil, fmt.Errorf("network attachment %d has no network", i)
+		}
+		if !n.DHCP4 && n.IPAddress == "" {
+			return nil, fmt.Errorf("network attachment %d needs an IP address or DHCP", i)
+		}
+	}
+
 	cloudinitUserDataConfig, err := cloudinit.GenerateUserData(bootScript, publicKey, osUser)
 	if err != nil {
 		return nil, fmt.Errorf("unable to generate user data, %v", err)
@@ -52,15 +68,27 @@ func (r *Resource) CloneTemplate(template *object.VirtualMachine, name string, b
 		deviceSpecs = append(deviceSpecs, nicspec)
 	}
 
-	nic := types.VirtualVmxnet3{}
-	nic.Backing, err = r.Network.EthernetCardBackingInfo(ctx)
-	if err != nil {
-		return nil, fmt.Errorf("unable to get information on NIC, %v", err)
+	for i, n := range networks {
+		nic := types.VirtualVmxnet3{}
+		nic.Backing, err = n.Network.EthernetCardBackingInfo(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("unable to get information on NIC, %v", err)
+		}
+		// negative keys are placeholders so vSphere assigns the real ones in the order added
+		nic.Key = int32(-100 - i)
+		nicspec := &types.VirtualDeviceConfigSpec{}
+		nicspec.Operation = types.VirtualDeviceConfigSpecOperationAdd
+		nicspec.Device = &nic
+		deviceSpecs = append(deviceSpecs, nicspec)
+	}
+
+	if size != nil {
+		resizeSpecs, err := applySize(spec.Config, l, size)
+		if err != nil {
+			return nil, fmt.Errorf("unable to resize %s, %v", name, err)
+		}
+		deviceSpecs = append(deviceSpecs, resizeSpecs...)
 	}
-	nicspec := &types.VirtualDeviceConfigSpec{}
-	nicspec.Operation = types.VirtualDeviceConfigSpecOperationAdd
-	nicspec.Device = &nic
-	deviceSpecs = append(deviceSpecs, nicspec)
 
 	spec.Config.DeviceChange = deviceSpecs
 
@@ -75,11 +103,46 @@ func (r *Resource) CloneTemplate(template *object.VirtualMachine, name string, b
 		return nil, fmt.Errorf("clone task failed, %v", err)
 	}
 
-	vm, err := r.SessionManager.GetVM(r.Datacenter, name)
+	vm, err := r.SessionManager.GetVMContext(ctx, r.Datacenter, name)
 	if err != nil {
 		return nil, fmt.Errorf("unable to find virtual machine, %v", err)
 	}
 
+	if err = r.TagOwned(ctx, vm); err != nil {
+		return nil, fmt.Errorf("unable to tag virtual machine, %v", err)
+	}
+
+	macs, err := macAddresses(vm)
+	if err != nil {
+		return nil, err
+	}
+	if len(macs) != len(networks) {
+		return nil, fmt.Errorf("expected %d NICs on %s, found %d", len(networks), name, len(macs))
+	}
+
+	metadataValues := &cloudinit.MetadataValues{Hostname: name}
+	for i, n := range networks {
+		metadataValues.Networks = append(metadataValues.Networks, cloudinit.NetworkConfig{
+			MACAddress:  macs[i],
+			DHCP4:       n.DHCP4,
+			IPAddress:   n.IPAddress,
+			Netmask:     n.Netmask,
+			Gateway:     n.Gateway,
+			NameServers: n.NameServers,
+			DNSSearch:   n.DNSSearch,
+		})
+	}
+	cloudinitMetadataConfig, err := cloudinit.GenerateMetadata(metadataValues)
+	if err != nil {
+		return nil, fmt.Errorf("unable to generate metadata, %v", err)
+	}
+
+	log.Debugf("setting cloud-init metadata on %s", name)
+	task, err = vm.Reconfigure(ctx, types.VirtualMachineConfigSpec{ExtraConfig: cloudinitMetadataConfig})
+	if err != nil {
+		return nil, fmt.Errorf("unable to reconfigure VM, %v", err)
+	}
+
 	err = task.Wait(ctx)
 	if err != nil {
 		return nil, fmt.Errorf("reconfigure task failed, %v", err)
@@ -99,6 +162,60 @@ func (r *Resource) CloneTemplate(template *object.VirtualMachine, name string, b
 	return vm, nil
 }
 
+// applySize sets the CPU and memory of the config spec and returns the device change growing the root disk
+func applySize(config *types.VirtualMachineConfigSpec, devices object.VirtualDeviceList, size *caketypes.MachineSize) ([]types.BaseVirtualDeviceConfigSpec, error) {
+	if size.NumCPUs > 0 {
+		config.NumCPUs = size.NumCPUs
+	}
+	if size.MemoryMiB > 0 {
+		config.MemoryMB = size.MemoryMiB
+	}
+	if size.DiskGiB <= 0 {
+		return nil, nil
+	}
+
+	disks := devices.SelectByType((*types.VirtualDisk)(nil))
+	if len(disks) == 0 {
+		return nil, fmt.Errorf("template has no disk to grow")
+	}
+	disk := disks[0].(*types.VirtualDisk)
+	capacityInKB := int64(size.DiskGiB) * 1024 * 1024
+	if capacityInKB < disk.CapacityInKB {
+		return nil, fmt.Errorf("disk cannot shrink from %d GiB to %d GiB", disk.CapacityInKB/1024/1024, size.DiskGiB)
+	}
+	if capacityInKB == disk.CapacityInKB {
+		return nil, nil
+	}
+	disk.CapacityInKB = capacityInKB
+	disk.CapacityInBytes = capacityInKB * 1024
+
+	diskspec := &types.VirtualDeviceConfigSpec{}
+	diskspec.Operation = types.VirtualDeviceConfigSpecOperationEdit
+	diskspec.Device = disk
+
+	return []types.BaseVirtualDeviceConfigSpec{diskspec}, nil
+}
+
+// macAddresses returns the MAC addresses vSphere assigned to the VM's NICs, in device order
+func macAddresses(vm *object.VirtualMachine) ([]string, error) {
+	vmProps, err := getProperties(vm)
+	if err != nil {
+		return nil, err
+	}
+
+	var macs []string
+	nics := object.VirtualDeviceList(vmProps.Config.Hardware.Device).SelectByType((*types.VirtualEthernetCard)(nil))
+	for _, dev := range nics {
+		nic := dev.(types.BaseVirtualEthernetCard).GetVirtualEthernetCard()
+		if nic.MacAddress == "" {
+			return nil, fmt.Errorf("NIC %d on %s has no MAC address assigned", nic.Key, vm.InventoryPath)
+		}
+		macs = append(macs, nic.MacAddress)
+	}
+
+	return macs, nil
+}
+
 func DeleteVM(vm *object.VirtualMachine) error {
 	ctx := context.TODO()
 
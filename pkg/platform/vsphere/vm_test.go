@@ -0,0 +1,139 @@
+package vsphere
+
+import (
+	"context"
+	"encoding/base64"
+	"strings"
+	"testing"
+
+	caketypes "github.com/netapp/cake/pkg/config/types"
+	"github.com/vmware/govmomi/find"
+	"github.com/vmware/govmomi/object"
+	"github.com/vmware/govmomi/vim25/types"
+)
+
+func newSimulatorResource(t *testing.T, sm *sessionManager) *Resource {
+	ctx := context.Background()
+	client, err := sm.GetClientContext(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	finder := find.NewFinder(client.Client, true)
+	dc, err := finder.DefaultDatacenter(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	finder.SetDatacenter(dc)
+
+	r := new(Resource)
+	r.SessionManager = sm
+	r.Datacenter = dc
+	if r.Datastore, err = finder.DefaultDatastore(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if r.Folder, err = finder.DefaultFolder(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if r.ResourcePool, err = finder.ResourcePool(ctx, "DC0_C0/Resources"); err != nil {
+		t.Fatal(err)
+	}
+	if r.Network, err = finder.Network(ctx, "VM Network"); err != nil {
+		t.Fatal(err)
+	}
+	return r
+}
+
+func TestCloneTemplateNetworks(t *testing.T) {
+	sm, cleanup := newSimulatorManager(t)
+	defer cleanup()
+	r := newSimulatorResource(t, sm)
+
+	template, err := sm.GetVM(r.Datacenter, "DC0_H0_VM0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	finder := find.NewFinder(template.Client(), true)
+	finder.SetDatacenter(r.Datacenter)
+	storage, err := finder.Network(context.Background(), "DC0_DVPG0")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	networks := []NetworkAttachment{
+		{Network: r.Network, IPAddress: "10.0.0.10", Netmask: "255.255.255.0", Gateway: "10.0.0.1", NameServers: []string{"10.0.0.2"}},
+		{Network: storage, IPAddress: "10.1.0.10", Netmask: "255.255.255.0"},
+	}
+	vm, err := r.CloneTemplate(template, "helper", "#!/bin/bash", "ssh-rsa AAAA", "capv", networks, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	macs, err := macAddresses(vm)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(macs) != 2 {
+		t.Fatalf("expected 2 NICs, got %d", len(macs))
+	}
+
+	metadata := extraConfigValue(t, vm, "guestinfo.metadata")
+	for _, want := range []string{macs[0], macs[1], "address: 10.0.0.10", "gateway: 10.0.0.1", "address: 10.1.0.10"} {
+		if !strings.Contains(metadata, want) {
+			t.Errorf("expected metadata to contain %q, got:\n%s", want, metadata)
+		}
+	}
+}
+
+func TestCloneTemplateRequiresAddress(t *testing.T) {
+	r := new(Resource)
+	networks := []NetworkAttachment{{Network: object.NewNetwork(nil, types.ManagedObjectReference{})}}
+	_, err := r.CloneTemplate(nil, "helper", "", "", "", networks, nil)
+	if err == nil {
+		t.Errorf("expected an error for a static NIC without an address")
+	}
+}
+
+func TestApplySize(t *testing.T) {
+	disk := &types.VirtualDisk{CapacityInKB: 25 * 1024 * 1024}
+	devices := object.VirtualDeviceList{disk}
+
+	config := &types.VirtualMachineConfigSpec{}
+	specs, err := applySize(config, devices, &caketypes.MachineSize{NumCPUs: 4, MemoryMiB: 16384, DiskGiB: 50})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if config.NumCPUs != 4 || config.MemoryMB != 16384 {
+		t.Errorf("got %d CPUs and %d MiB, want 4 CPUs and 16384 MiB", config.NumCPUs, config.MemoryMB)
+	}
+	if len(specs) != 1 {
+		t.Fatalf("expected a disk edit, got %d device changes", len(specs))
+	}
+	grown := specs[0].GetVirtualDeviceConfigSpec().Device.(*types.VirtualDisk)
+	if grown.CapacityInKB != 50*1024*1024 {
+		t.Errorf("got %d KB, want %d", grown.CapacityInKB, 50*1024*1024)
+	}
+
+	_, err = applySize(config, object.VirtualDeviceList{&types.VirtualDisk{CapacityInKB: 100 * 1024 * 1024}}, &caketypes.MachineSize{DiskGiB: 50})
+	if err == nil {
+		t.Errorf("expected an error shrinking a disk")
+	}
+}
+
+func extraConfigValue(t *testing.T, vm *object.VirtualMachine, key string) string {
+	props, err := getProperties(vm)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, o := range props.Config.ExtraConfig {
+		option := o.GetOptionValue()
+		if option.Key == key {
+			decoded, err := base64.StdEncoding.DecodeString(option.Value.(string))
+			if err != nil {
+				t.Fatal(err)
+			}
+			return string(decoded)
+		}
+	}
+	t.Fatalf("extra config %s not found", key)
+	return ""
+}